@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	secrets "token-toolkit/jwt-rotation"
+	"token-toolkit/jwt-rotation/storage"
+)
+
+const cliUsage = `Usage: locksmith <command> [flags]
+
+Commands:
+  rotate   rotate the secret once, rolling back if a -canary-url or -canary-cmd fails
+  status   print when the secret was last rotated and, with ROTATION_SCHEDULE set, when it is next due
+  publish  publish a pending secret that verifiers accept but nothing signs with yet
+  promote  make the pending secret current once the propagation delay has passed
+  advance  run whichever staged rotation step is due, suitable for a schedule;
+           does nothing inside the blackout windows set in ROTATION_BLACKOUTS
+  revoke   stop accepting a secret immediately, e.g. revoke -kid abc123 -reason "leaked"
+  rollback make the previous secret current again, e.g. rollback -reason "consumer cached the old key"
+  jwks     print the public keys of the keyring as a JWKS, or write them with -out to a file,
+           s3://bucket/key, gs://bucket/object or https://<account>.blob.core.windows.net/<container>/<blob>
+
+Run without arguments to start the interactive UI.
+Provider settings can also be given as environment variables (e.g. SECRET_ID).
+`
+
+// runs the non-interactive command line interface.
+func runCLI(args []string) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprint(os.Stderr, cliUsage)
+		return nil
+	}
+
+	command := args[0]
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	var names []string
+	for _, backend := range storage.Backends() {
+		names = append(names, backend.Name)
+		storage.BindFlags(fs, backend.NewConfig())
+	}
+	provider := fs.String("provider", "", "storage provider: "+strings.Join(names, ", "))
+	notify := fs.String("notify", "", "comma separated notifiers to use: sentry, slack")
+	kid := fs.String("kid", "", "id of the secret to revoke")
+	reason := fs.String("reason", "", "why the secret is revoked or rolled back, included in the notification")
+	retire := fs.Bool("retire", false, "on rollback, revoke the faulty secret instead of keeping it for verification")
+	yes := fs.Bool("yes", false, "do not ask for confirmation")
+	canaryURLs := fs.String("canary-url", "", "comma separated URLs that must answer 2xx to a probe token after rotate")
+	canaryCommand := fs.String("canary-cmd", "", "command that must succeed with the probe token in $LOCKSMITH_CANARY_TOKEN after rotate")
+	canaryTimeout := fs.Duration("canary-timeout", secrets.DefaultCanaryTimeout, "how long canaries may fail before the rotation is rolled back")
+	propagationDelay := fs.Duration("propagation-delay", 5*time.Minute, "how long a pending secret is published before it can be promoted")
+	out := fs.String("out", "", "where jwks writes the key set: a file path, s3://, gs:// or an Azure blob URL")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	cfg, err := newProviderConfig(*provider)
+	if err != nil {
+		return err
+	}
+	if err := storage.LoadConfig(cfg, storage.EnvSource(""), storage.FlagSource(fs)); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var notifierNames []string
+	for _, name := range strings.Split(*notify, ",") {
+		switch strings.TrimSpace(strings.ToLower(name)) {
+		case "sentry":
+			notifierNames = append(notifierNames, "Sentry")
+		case "slack":
+			notifierNames = append(notifierNames, "Slack")
+		}
+	}
+
+	switch command {
+	case "rotate":
+		policy := defaultPolicy()
+		policy.CanaryTimeout = *canaryTimeout
+		canaries := parseCanaries(*canaryURLs, *canaryCommand)
+		if err := rotateOnce(ctx, *provider, cfg, policy, buildNotifier(notifierNames), canaries...); err != nil {
+			return err
+		}
+		fmt.Println("Secret rotated successfully!")
+	case "publish", "promote", "advance":
+		policy := defaultPolicy()
+		policy.PropagationDelay = *propagationDelay
+		if err := policy.LoadScheduleEnv(); err != nil {
+			return err
+		}
+		if command == "advance" {
+			if err := policy.CheckBlackout(time.Now()); err != nil {
+				fmt.Printf("Skipping rotation: %v\n", err)
+				return nil
+			}
+		}
+		secretManager, err := openManager(ctx, *provider, cfg, policy, buildNotifier(notifierNames))
+		if err != nil {
+			return err
+		}
+		return runStage(ctx, command, secretManager, policy)
+	case "revoke":
+		if *kid == "" {
+			return fmt.Errorf("revoke needs the -kid of the secret to revoke")
+		}
+		secretManager, err := openManager(ctx, *provider, cfg, defaultPolicy(), buildNotifier(notifierNames))
+		if err != nil {
+			return err
+		}
+		revocation, err := secretManager.Revoke(ctx, *kid, *reason)
+		if err != nil {
+			return err
+		}
+		fmt.Println(revocationSummary(revocation))
+	case "rollback":
+		secretManager, err := openManager(ctx, *provider, cfg, defaultPolicy(), buildNotifier(notifierNames))
+		if err != nil {
+			return err
+		}
+		previous := secretManager.PreviousSecret()
+		if previous == nil {
+			return secrets.ErrNoPreviousSecret
+		}
+		prompt := fmt.Sprintf("Roll back from secret %s to %s?", secretManager.GetSecrets()[0].ID, previous.ID)
+		if !*yes && !confirm(prompt) {
+			return fmt.Errorf("rollback cancelled")
+		}
+		rollback, err := secretManager.Rollback(ctx, *reason, *retire)
+		if err != nil {
+			return err
+		}
+		fmt.Println(rollbackSummary(rollback))
+	case "jwks":
+		policy := defaultPolicy()
+		policy.PropagationDelay = *propagationDelay
+		if err := policy.LoadScheduleEnv(); err != nil {
+			return err
+		}
+		return exportJWKS(ctx, *provider, cfg, policy, *out)
+	case "status":
+		lastRotated, nextRotation, err := rotationTimes(ctx, *provider, cfg)
+		if err != nil {
+			return err
+		}
+		fmt.Println(rotationTimesSummary(lastRotated, nextRotation))
+	default:
+		fmt.Fprint(os.Stderr, cliUsage)
+		return fmt.Errorf("unknown command: %s", command)
+	}
+	return nil
+}
+
+// builds the canaries given on the command line.
+func parseCanaries(urls, command string) []secrets.Canary {
+	var canaries []secrets.Canary
+	for _, url := range strings.Split(urls, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			canaries = append(canaries, secrets.NewHTTPCanary(url))
+		}
+	}
+	if fields := strings.Fields(command); len(fields) > 0 {
+		canaries = append(canaries, secrets.NewCommandCanary(fields[0], fields[1:]...))
+	}
+	return canaries
+}
+
+// asks a yes/no question on the terminal, anything but yes counts as no.
+func confirm(prompt string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", prompt)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
+
+// runs one step of a staged rotation.
+func runStage(ctx context.Context, command string, secretManager *secrets.JWTManager, policy secrets.RotationPolicy) error {
+	switch command {
+	case "publish":
+		secret, err := secretManager.PublishPending(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Pending secret %s published, it can be promoted at %s\n",
+			secret.ID, secret.CreatedAt.Add(policy.PropagationDelay).Format(time.RFC3339))
+	case "promote":
+		secret, err := secretManager.PromotePending(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Secret %s is now current\n", secret.ID)
+	case "advance":
+		phase, err := secretManager.AdvanceRotation(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rotation phase: %s\n", phase)
+	}
+	return nil
+}
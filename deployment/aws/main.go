@@ -3,7 +3,6 @@ package main
 import (
 	"context"
 	"log"
-	"os"
 	"time"
 
 	secrets "token-toolkit/jwt-rotation"
@@ -13,26 +12,61 @@ import (
 	"github.com/aws/aws-lambda-go/lambda"
 )
 
-func HandleRequest(ctx context.Context) (string, error) {
-	// Configuration will be passed via environment variables in Lambda
-	config := map[string]string{
-		"secretID": os.Getenv("SECRET_ID"),
-		"region":   os.Getenv("REGION"),
+// HandleRequest runs one step of a Secrets Manager rotation when invoked by
+// RotateSecret, and a full rotation when invoked on a schedule or by hand.
+func HandleRequest(ctx context.Context, event rotationEvent) (string, error) {
+	if event.Step != "" {
+		return handleRotationStep(ctx, event)
 	}
 
-	storageProvider := storage.NewAWSSecretsManager()
-	if err := storageProvider.Setup(ctx, config); err != nil {
+	// Configuration will be passed via environment variables in Lambda
+	storageProvider, err := storage.Open(ctx, "aws", storage.EnvSource(""))
+	if err != nil {
 		log.Printf("Error setting up storage: %v", err)
 		return "Error", err
 	}
 
+	policy, err := rotationPolicy()
+	if err != nil {
+		log.Printf("Invalid rotation schedule: %v", err)
+		return "Error", err
+	}
+
+	generator, err := secrets.KeyGeneratorFromEnv()
+	if err != nil {
+		log.Printf("Invalid signing algorithm: %v", err)
+		return "Error", err
+	}
+
+	secretManager, err := secrets.NewJWTManagerWithGenerator(ctx, policy, generator, storageProvider, newNotifier())
+	if err != nil {
+		log.Printf("Failed to create secret manager: %v", err)
+		return "Error", err
+	}
+
+	if _, err := secretManager.RotateSecret(ctx); err != nil {
+		log.Printf("Failed to rotate secret: %v", err)
+		return "Error", err
+	}
+
+	return "Secret rotated successfully!", nil
+}
+
+// the schedule itself lives in the secret's rotation rules, the environment
+// only adds the blackout windows.
+func rotationPolicy() (secrets.RotationPolicy, error) {
 	policy := secrets.RotationPolicy{
 		RotationInterval: 0, // Not needed for Lambda, it's triggered by schedule
 		GracePeriod:      48 * time.Hour,
+		StorageTimeout:   30 * time.Second,
 	}
+	err := policy.LoadScheduleEnv()
+	return policy, err
+}
 
-	// In the Lambda, we'll initialize all available notifiers
-	// based on the environment variables provided.
+// In the Lambda, we'll initialize all available notifiers
+// based on the environment variables provided.
+func newNotifier() secrets.Notifier {
 	var notifiersList []secrets.Notifier
 	sentryNotifier, err := notifiers.NewSentryNotifier()
 	if err != nil {
@@ -50,20 +84,7 @@ func HandleRequest(ctx context.Context) (string, error) {
 		notifiersList = append(notifiersList, slackNotifier)
 	}
 
-	notifier := notifiers.NewMultiNotifier(notifiersList...)
-
-	secretManager, err := secrets.NewJWTManager(policy, 64, storageProvider, notifier)
-	if err != nil {
-		log.Printf("Failed to create secret manager: %v", err)
-		return "Error", err
-	}
-
-	if _, err := secretManager.RotateSecret(); err != nil {
-		log.Printf("Failed to rotate secret: %v", err)
-		return "Error", err
-	}
-
-	return "Secret rotated successfully!", nil
+	return notifiers.NewMultiNotifier(notifiersList...)
 }
 
 func main() {
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	secrets "token-toolkit/jwt-rotation"
+	"token-toolkit/jwt-rotation/storage"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// rotationEvent is the payload Secrets Manager sends to a rotation function,
+// once for each step of a rotation started by RotateSecret.
+type rotationEvent struct {
+	SecretID           string `json:"SecretId"`
+	ClientRequestToken string `json:"ClientRequestToken"`
+	Step               string `json:"Step"`
+}
+
+const (
+	stepCreateSecret = "createSecret"
+	stepSetSecret    = "setSecret"
+	stepTestSecret   = "testSecret"
+	stepFinishSecret = "finishSecret"
+)
+
+// handleRotationStep implements the rotation function protocol. The version
+// named by the ClientRequestToken is labelled AWSPENDING by RotateSecret,
+// createSecret writes a new secret to it, testSecret checks that it signs and
+// validates tokens and finishSecret moves AWSCURRENT to it. The version that
+// held AWSCURRENT keeps validating tokens for the grace period.
+func handleRotationStep(ctx context.Context, event rotationEvent) (string, error) {
+	log.Printf("Running rotation step %s for version %s", event.Step, event.ClientRequestToken)
+
+	store, err := storage.Open(ctx, "aws", storage.EnvSource(""), storage.MapSource(map[string]string{"secretID": event.SecretID}))
+	if err != nil {
+		log.Printf("Error setting up storage: %v", err)
+		return "Error", err
+	}
+	awsStore, ok := store.(*storage.AWSSecretsManager)
+	if !ok {
+		return "Error", fmt.Errorf("unexpected storage type %T", store)
+	}
+
+	state, err := awsStore.RotationState(ctx, event.ClientRequestToken)
+	if err != nil {
+		log.Printf("Rotation step %s rejected: %v", event.Step, err)
+		return "Error", err
+	}
+	if state == storage.StateActive {
+		// The rotation already finished, Secrets Manager retries steps.
+		return fmt.Sprintf("Version %s is already current", event.ClientRequestToken), nil
+	}
+
+	policy, err := rotationPolicy()
+	if err != nil {
+		log.Printf("Invalid rotation schedule: %v", err)
+		return "Error", err
+	}
+
+	// Secrets Manager runs the steps back to back, so there is nothing to wait for between them.
+	generator, err := secrets.KeyGeneratorFromEnv()
+	if err != nil {
+		log.Printf("Invalid signing algorithm: %v", err)
+		return "Error", err
+	}
+
+	secretManager, err := secrets.NewJWTManagerWithGenerator(ctx, policy, generator, awsStore.ForVersion(event.ClientRequestToken), newNotifier())
+	if err != nil {
+		log.Printf("Failed to create secret manager: %v", err)
+		return "Error", err
+	}
+
+	switch event.Step {
+	case stepCreateSecret:
+		err = createSecret(ctx, awsStore, secretManager, policy, event.ClientRequestToken)
+	case stepSetSecret:
+		// The keyring only lives in Secrets Manager, there is no other system
+		// that needs to learn the new secret.
+	case stepTestSecret:
+		err = testSecret(ctx, awsStore, secretManager, event.ClientRequestToken)
+	case stepFinishSecret:
+		err = finishSecret(ctx, awsStore, secretManager, event.ClientRequestToken)
+	default:
+		err = fmt.Errorf("unknown rotation step %q", event.Step)
+	}
+	if err != nil {
+		log.Printf("Rotation step %s failed: %v", event.Step, err)
+		return "Error", err
+	}
+
+	return fmt.Sprintf("Rotation step %s completed", event.Step), nil
+}
+
+// writes a new pending secret to the version, unless a previous attempt already did.
+// Inside a blackout window the step fails before writing anything, the version
+// keeps its AWSPENDING label and the rotation is retried with the same token.
+// A pending secret left in another version by an earlier rotation is demoted
+// and replaced, so the value always ends up in the version being rotated to.
+func createSecret(ctx context.Context, store *storage.AWSSecretsManager, manager *secrets.JWTManager, policy secrets.RotationPolicy, versionID string) error {
+	_, err := store.GetVersion(ctx, versionID)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		return err
+	}
+	if err := policy.CheckBlackout(time.Now()); err != nil {
+		return err
+	}
+
+	secret, err := manager.PublishPending(ctx)
+	if err != nil {
+		return err
+	}
+	stored, err := store.GetVersion(ctx, versionID)
+	if errors.Is(err, storage.ErrNotFound) {
+		log.Printf("Superseding pending secret %s left by an earlier rotation", secret.ID)
+		if err := store.SetState(ctx, secret.ID, storage.StatePrevious); err != nil {
+			return fmt.Errorf("failed to supersede pending secret %s: %w", secret.ID, err)
+		}
+		if secret, err = manager.PublishPending(ctx); err != nil {
+			return err
+		}
+		stored, err = store.GetVersion(ctx, versionID)
+	}
+	if err != nil {
+		return err
+	}
+	if stored.ID != secret.ID {
+		return fmt.Errorf("version %s holds secret %s, not the pending secret %s", versionID, stored.ID, secret.ID)
+	}
+	log.Printf("Created pending secret %s", secret.ID)
+	return nil
+}
+
+// signs a short-lived token with the pending secret and validates it against the keyring.
+func testSecret(ctx context.Context, store *storage.AWSSecretsManager, manager *secrets.JWTManager, versionID string) error {
+	pending, err := pendingSecret(ctx, store, manager, versionID)
+	if err != nil {
+		return err
+	}
+
+	signed, err := secrets.SignTokenWithSecret(pending, jwt.RegisteredClaims{
+		Subject:   "rotation-test",
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to sign test token: %w", err)
+	}
+	if _, err := manager.ValidateToken(signed); err != nil {
+		return fmt.Errorf("pending secret %s does not validate tokens: %w", pending.ID, err)
+	}
+	return nil
+}
+
+// promotes the pending secret, moving AWSCURRENT to its version.
+func finishSecret(ctx context.Context, store *storage.AWSSecretsManager, manager *secrets.JWTManager, versionID string) error {
+	if _, err := pendingSecret(ctx, store, manager, versionID); err != nil {
+		return err
+	}
+	secret, err := manager.PromotePending(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("Promoted secret %s", secret.ID)
+	return nil
+}
+
+// returns the pending secret of the keyring after checking it is the one stored in the version.
+func pendingSecret(ctx context.Context, store *storage.AWSSecretsManager, manager *secrets.JWTManager, versionID string) (*secrets.Secret, error) {
+	stored, err := store.GetVersion(ctx, versionID)
+	if err != nil {
+		return nil, err
+	}
+	pending := manager.PendingSecret()
+	if pending == nil || pending.ID != stored.ID {
+		return nil, fmt.Errorf("secret %s in version %s is not the pending secret", stored.ID, versionID)
+	}
+	return pending, nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	secrets "token-toolkit/jwt-rotation"
+	"token-toolkit/jwt-rotation/storage"
+	"token-toolkit/jwt-rotation/storage/storagetest"
+)
+
+func TestRotationStepsAreIdempotent(t *testing.T) {
+	ctx := context.Background()
+	backend := storagetest.NewFakeAWS(t)
+	store := backend.(*storage.AWSSecretsManager)
+	policy := secrets.RotationPolicy{GracePeriod: time.Hour}
+
+	// Every invocation of the function starts from storage, as a new manager.
+	newManager := func(versionID string) *secrets.JWTManager {
+		t.Helper()
+		manager, err := secrets.NewJWTManager(ctx, policy, 32, store.ForVersion(versionID), nil)
+		if err != nil {
+			t.Fatalf("NewJWTManager failed: %v", err)
+		}
+		return manager
+	}
+	current := newManager("").GetSecrets()[0].ID
+
+	const versionID = "rotation-1"
+	storagetest.StartAWSRotation(t, backend, versionID)
+
+	// Secrets Manager retries a step when it does not hear back in time.
+	var created string
+	for attempt := 1; attempt <= 2; attempt++ {
+		if err := createSecret(ctx, store, newManager(versionID), policy, versionID); err != nil {
+			t.Fatalf("createSecret attempt %d failed: %v", attempt, err)
+		}
+		stored, err := store.GetVersion(ctx, versionID)
+		if err != nil {
+			t.Fatalf("GetVersion failed: %v", err)
+		}
+		if stored.State != storage.StatePending {
+			t.Errorf("version state after attempt %d = %q, want %q", attempt, stored.State, storage.StatePending)
+		}
+		if created != "" && stored.ID != created {
+			t.Errorf("attempt %d replaced pending secret %s with %s", attempt, created, stored.ID)
+		}
+		created = stored.ID
+	}
+	all, err := store.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("GetAll failed: %v", err)
+	}
+	if len(all) != 2 {
+		t.Errorf("stored %d secrets after retried createSecret, want the current and one pending", len(all))
+	}
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		if err := testSecret(ctx, store, newManager(versionID), versionID); err != nil {
+			t.Fatalf("testSecret attempt %d failed: %v", attempt, err)
+		}
+	}
+
+	if err := finishSecret(ctx, store, newManager(versionID), versionID); err != nil {
+		t.Fatalf("finishSecret failed: %v", err)
+	}
+	state, err := store.RotationState(ctx, versionID)
+	if err != nil || state != storage.StateActive {
+		t.Fatalf("RotationState after finishSecret = %q, %v; want %q", state, err, storage.StateActive)
+	}
+	manager := newManager("")
+	if got := manager.GetSecrets()[0].ID; got != created {
+		t.Errorf("active secret = %s, want %s", got, created)
+	}
+	if previous := manager.PreviousSecret(); previous == nil || previous.ID != current {
+		t.Errorf("previous secret = %v, want %s", previous, current)
+	}
+}
+
+func TestCreateSecretRespectsBlackouts(t *testing.T) {
+	ctx := context.Background()
+	backend := storagetest.NewFakeAWS(t)
+	store := backend.(*storage.AWSSecretsManager)
+	policy := secrets.RotationPolicy{
+		GracePeriod: time.Hour,
+		Blackouts:   []secrets.BlackoutWindow{{Start: time.Now().Add(-time.Hour), End: time.Now().Add(time.Hour)}},
+	}
+	if _, err := secrets.NewJWTManager(ctx, policy, 32, store, nil); err != nil {
+		t.Fatalf("NewJWTManager failed: %v", err)
+	}
+
+	const versionID = "rotation-1"
+	storagetest.StartAWSRotation(t, backend, versionID)
+	manager, err := secrets.NewJWTManager(ctx, policy, 32, store.ForVersion(versionID), nil)
+	if err != nil {
+		t.Fatalf("NewJWTManager failed: %v", err)
+	}
+	if err := createSecret(ctx, store, manager, policy, versionID); err == nil {
+		t.Fatal("createSecret inside a blackout window succeeded")
+	}
+	// The version keeps its label, so the rotation is retried with the same token.
+	if state, err := store.RotationState(ctx, versionID); err != nil || state != storage.StatePending {
+		t.Errorf("RotationState = %q, %v; want %q", state, err, storage.StatePending)
+	}
+	if manager.PendingSecret() != nil {
+		t.Error("createSecret published a pending secret inside a blackout window")
+	}
+}
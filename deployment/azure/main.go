@@ -2,7 +2,8 @@
 // The structure of an Azure Function in Go involves a function.json
 // and a go file with the function logic.
 
-// Example function.json:
+// Example function.json, the deploy script sets ROTATION_TIMER_SCHEDULE
+// to the NCRONTAB form of the rotation schedule:
 // {
 //  "scriptFile": "main.go",
 //  "bindings": [
@@ -10,7 +11,7 @@
 //     "name": "myTimer",
 //     "type": "timerTrigger",
 //     "direction": "in",
-//      "schedule": "0 */5 * * * *"
+//      "schedule": "%ROTATION_TIMER_SCHEDULE%"
 //    }
 //  ]
 // }
@@ -20,7 +21,6 @@ package main
 import (
 	"context"
 	"log"
-	"os"
 	"time"
 
 	secrets "token-toolkit/jwt-rotation"
@@ -30,13 +30,8 @@ import (
 
 // Run is the entry point for the Azure Function.
 func Run(ctx context.Context, myTimer interface{}) {
-	config := map[string]string{
-		"vaultURI":   os.Getenv("VAULT_URI"),
-		"secretName": os.Getenv("SECRET_NAME"),
-	}
-
-	storageProvider := storage.NewAzureKeyVault()
-	if err := storageProvider.Setup(ctx, config); err != nil {
+	storageProvider, err := storage.Open(ctx, "azure", storage.EnvSource(""))
+	if err != nil {
 		log.Printf("Error setting up storage: %v", err)
 		return
 	}
@@ -44,6 +39,21 @@ func Run(ctx context.Context, myTimer interface{}) {
 	policy := secrets.RotationPolicy{
 		RotationInterval: 0, // Not needed, triggered by schedule
 		GracePeriod:      48 * time.Hour,
+		StorageTimeout:   30 * time.Second,
+	}
+	if err := policy.LoadScheduleEnv(); err != nil {
+		log.Printf("Invalid rotation schedule: %v", err)
+		return
+	}
+
+	// The timer trigger has no blackout windows or jitter, so they are applied here.
+	if err := policy.CheckBlackout(time.Now()); err != nil {
+		log.Printf("Skipping rotation: %v", err)
+		return
+	}
+	if err := policy.WaitJitter(ctx); err != nil {
+		log.Printf("Function ended before rotating: %v", err)
+		return
 	}
 
 	var notifiersList []secrets.Notifier
@@ -65,13 +75,19 @@ func Run(ctx context.Context, myTimer interface{}) {
 
 	notifier := notifiers.NewMultiNotifier(notifiersList...)
 
-	secretManager, err := secrets.NewJWTManager(policy, 64, storageProvider, notifier)
+	generator, err := secrets.KeyGeneratorFromEnv()
+	if err != nil {
+		log.Printf("Invalid signing algorithm: %v", err)
+		return
+	}
+
+	secretManager, err := secrets.NewJWTManagerWithGenerator(ctx, policy, generator, storageProvider, notifier)
 	if err != nil {
 		log.Printf("Failed to create secret manager: %v", err)
 		return
 	}
 
-	if _, err := secretManager.RotateSecret(); err != nil {
+	if _, err := secretManager.RotateSecret(ctx); err != nil {
 		log.Printf("Failed to rotate secret: %v", err)
 		return
 	}
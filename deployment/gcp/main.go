@@ -1,11 +1,9 @@
 package gcp
 
 import (
-	"context"
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"time"
 
 	secrets "token-toolkit/jwt-rotation"
@@ -15,15 +13,10 @@ import (
 
 // Google Cloud Function that rotates a JWT secret.
 func RotateSecret(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+	ctx := r.Context()
 	// Configuration will be passed via environment variables in the Cloud Function
-	config := map[string]string{
-		"projectID": os.Getenv("PROJECT_ID"),
-		"secretID":  os.Getenv("SECRET_ID"),
-	}
-
-	storageProvider := storage.NewGCPSecretManager()
-	if err := storageProvider.Setup(ctx, config); err != nil {
+	storageProvider, err := storage.Open(ctx, "gcp", storage.EnvSource(""))
+	if err != nil {
 		log.Printf("Error setting up storage: %v", err)
 		http.Error(w, "Error setting up storage", http.StatusInternalServerError)
 		return
@@ -32,6 +25,23 @@ func RotateSecret(w http.ResponseWriter, r *http.Request) {
 	policy := secrets.RotationPolicy{
 		RotationInterval: 0, // Not needed, triggered by scheduler
 		GracePeriod:      48 * time.Hour,
+		StorageTimeout:   30 * time.Second,
+	}
+	if err := policy.LoadScheduleEnv(); err != nil {
+		log.Printf("Invalid rotation schedule: %v", err)
+		http.Error(w, "Invalid rotation schedule", http.StatusInternalServerError)
+		return
+	}
+
+	// Cloud Scheduler has no blackout windows or jitter, so they are applied here.
+	if err := policy.CheckBlackout(time.Now()); err != nil {
+		log.Printf("Skipping rotation: %v", err)
+		fmt.Fprintf(w, "Skipped: %v\n", err)
+		return
+	}
+	if err := policy.WaitJitter(ctx); err != nil {
+		http.Error(w, "Request ended before rotating", http.StatusServiceUnavailable)
+		return
 	}
 
 	var notifiersList []secrets.Notifier
@@ -53,14 +63,21 @@ func RotateSecret(w http.ResponseWriter, r *http.Request) {
 
 	notifier := notifiers.NewMultiNotifier(notifiersList...)
 
-	secretManager, err := secrets.NewJWTManager(policy, 64, storageProvider, notifier)
+	generator, err := secrets.KeyGeneratorFromEnv()
+	if err != nil {
+		log.Printf("Invalid signing algorithm: %v", err)
+		http.Error(w, "Invalid signing algorithm", http.StatusInternalServerError)
+		return
+	}
+
+	secretManager, err := secrets.NewJWTManagerWithGenerator(ctx, policy, generator, storageProvider, notifier)
 	if err != nil {
 		log.Printf("Failed to create secret manager: %v", err)
 		http.Error(w, "Failed to create secret manager", http.StatusInternalServerError)
 		return
 	}
 
-	if _, err := secretManager.RotateSecret(); err != nil {
+	if _, err := secretManager.RotateSecret(ctx); err != nil {
 		log.Printf("Failed to rotate secret: %v", err)
 		http.Error(w, "Failed to rotate secret", http.StatusInternalServerError)
 		return
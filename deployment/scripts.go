@@ -2,8 +2,12 @@ package deployment
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"text/template"
+	"time"
+
+	secrets "token-toolkit/jwt-rotation"
 )
 
 // holds the configuration needed to generate a deployment script.
@@ -20,6 +24,23 @@ type ScriptData struct {
 	FunctionAppName    string
 	StorageAccountName string
 	ResourceGroupName  string
+	// the cron expression rotations run on, "@daily" when empty.
+	Schedule string
+	// the most each rotation is randomly delayed.
+	Jitter time.Duration
+	// blackout windows in the format secrets.ParseBlackoutWindows reads.
+	Blackouts string
+	// the JWT signing algorithm of new secrets, HS256 when empty.
+	Algorithm string
+}
+
+// adds the schedule rendered for each cloud scheduler to the script data.
+type scriptVars struct {
+	ScriptData
+	AWSSchedule            string
+	AWSRotationWindow      string
+	CloudSchedulerSchedule string
+	AzureTimerSchedule     string
 }
 
 const (
@@ -27,7 +48,7 @@ const (
 # Deployment script for AWS Lambda
 
 echo "--- Building Go binary for Lambda ---"
-GOOS=linux go build -o main deployment/aws/main.go
+GOOS=linux go build -o main ./deployment/aws
 
 echo "--- Creating deployment package ---"
 zip deployment.zip main
@@ -35,12 +56,20 @@ zip deployment.zip main
 echo "--- Deploying to AWS ---"
 # Note: This script assumes you have configured your AWS CLI and have the necessary permissions.
 
-# You may need to create an IAM role with permissions for Secrets Manager, CloudWatch Logs,
-# and give EventBridge permissions to invoke this Lambda.
+# You may need to create an IAM role with permissions for Secrets Manager (including
+# DescribeSecret and UpdateSecretVersionStage) and CloudWatch Logs.
 # Replace this with the ARN of the role you create.
 IAM_ROLE_ARN="REPLACE_WITH_YOUR_LAMBDA_EXECUTION_ROLE_ARN"
 FUNCTION_NAME="jwtSecretRotator"
-SCHEDULE="rate(24 hours)"
+# Generated from the rotation schedule {{json .Schedule}}. Secrets Manager picks a
+# random time within the rotation window, which stands in for the jitter.
+SCHEDULE="{{.AWSSchedule}}"
+ROTATION_RULES="{\"ScheduleExpression\": \"$SCHEDULE\"{{if .AWSRotationWindow}}, \"Duration\": \"{{.AWSRotationWindow}}\"{{end}}}"
+
+# Blackout windows are checked by the function in the createSecret step.
+cat > lambda-env.json <<'EOF'
+{"Variables": {"SECRET_ID": {{json .SecretID}}, "REGION": {{json .Region}}, "SENTRY_DSN": {{json .SentryDSN}}, "SLACK_BOT_TOKEN": {{json .SlackBotToken}}, "SLACK_CHANNEL_ID": {{json .SlackChannelID}}, "ROTATION_BLACKOUTS": {{json .Blackouts}}, "JWT_ALGORITHM": {{json .Algorithm}}}}
+EOF
 
 aws lambda create-function \
   --function-name "$FUNCTION_NAME" \
@@ -48,29 +77,30 @@ aws lambda create-function \
   --role "$IAM_ROLE_ARN" \
   --handler main \
   --zip-file fileb://deployment.zip \
-  --environment "Variables={SECRET_ID={{.SecretID}},REGION={{.Region}},SENTRY_DSN={{.SentryDSN}},SLACK_BOT_TOKEN={{.SlackBotToken}},SLACK_CHANNEL_ID={{.SlackChannelID}}}"
-
-echo "--- Creating EventBridge rule for scheduled rotation ---"
-RULE_NAME="jwtSecretRotationSchedule"
-aws events put-rule \
-  --name "$RULE_NAME" \
-  --schedule-expression "$SCHEDULE"
+  --environment file://lambda-env.json
 
 LAMBDA_ARN=$(aws lambda get-function --function-name "$FUNCTION_NAME" --query 'Configuration.FunctionArn' --output text)
+SECRET_ARN=$(aws secretsmanager describe-secret --secret-id "{{.SecretID}}" --region "{{.Region}}" --query 'ARN' --output text)
 
-aws events put-targets \
-  --rule "$RULE_NAME" \
-  --targets "Id=1,Arn=$LAMBDA_ARN"
-
+echo "--- Allowing Secrets Manager to invoke the rotation function ---"
 aws lambda add-permission \
   --function-name "$FUNCTION_NAME" \
-  --statement-id "EventBridgeInvoke" \
+  --statement-id "SecretsManagerInvoke" \
   --action "lambda:InvokeFunction" \
-  --principal events.amazonaws.com \
-  --source-arn $(aws events describe-rule --name "$RULE_NAME" --query 'Arn' --output text)
+  --principal secretsmanager.amazonaws.com \
+  --source-arn "$SECRET_ARN"
+
+echo "--- Enabling Secrets Manager rotation ---"
+# Secrets Manager drives the createSecret, setSecret, testSecret and finishSecret
+# steps, and the rotation shows up in the console under the secret's rotation configuration.
+aws secretsmanager rotate-secret \
+  --secret-id "{{.SecretID}}" \
+  --region "{{.Region}}" \
+  --rotation-lambda-arn "$LAMBDA_ARN" \
+  --rotation-rules "$ROTATION_RULES"
 
 echo "--- Cleaning up ---"
-rm main deployment.zip
+rm main deployment.zip lambda-env.json
 
 echo "--- Deployment complete! ---"
 `
@@ -82,22 +112,38 @@ echo "--- Deploying to Google Cloud ---"
 # Note: This script assumes you have authenticated with the gcloud CLI and have the necessary permissions.
 
 FUNCTION_NAME="rotateJwtSecret"
-SCHEDULE="every 24 hours"
+# Generated from the rotation schedule {{json .Schedule}}, evaluated in UTC.
+SCHEDULE="{{.CloudSchedulerSchedule}}"
 SCHEDULER_JOB_NAME="jwt-rotation-scheduler"
 
+# Jitter and blackout windows are applied by the function, keep the jitter below its timeout.
+cat > function-env.yaml <<'EOF'
+PROJECT_ID: {{json .ProjectID}}
+SECRET_ID: {{json .SecretID}}
+SENTRY_DSN: {{json .SentryDSN}}
+SLACK_BOT_TOKEN: {{json .SlackBotToken}}
+SLACK_CHANNEL_ID: {{json .SlackChannelID}}
+ROTATION_JITTER: {{json .Jitter.String}}
+ROTATION_BLACKOUTS: {{json .Blackouts}}
+JWT_ALGORITHM: {{json .Algorithm}}
+EOF
+
 gcloud functions deploy "$FUNCTION_NAME" \
   --runtime go116 \
   --trigger-http \
   --allow-unauthenticated \
   --source deployment/gcp \
   --entry-point RotateSecret \
-  --set-env-vars "PROJECT_ID={{.ProjectID}},SECRET_ID={{.SecretID}},SENTRY_DSN={{.SentryDSN}},SLACK_BOT_TOKEN={{.SlackBotToken}},SLACK_CHANNEL_ID={{.SlackChannelID}}"
+  --env-vars-file function-env.yaml
+
+rm function-env.yaml
 
 FUNCTION_URL=$(gcloud functions describe "$FUNCTION_NAME" --format 'value(https_trigger.url)')
 
 echo "--- Creating Cloud Scheduler job ---"
 gcloud scheduler jobs create http "$SCHEDULER_JOB_NAME" \
   --schedule="$SCHEDULE" \
+  --time-zone="Etc/UTC" \
   --uri="$FUNCTION_URL" \
   --http-method=GET
 
@@ -130,8 +176,12 @@ az functionapp create \
   --runtime golang
 
 # Set environment variables
+# The timer trigger reads its NCRONTAB schedule from ROTATION_TIMER_SCHEDULE, generated
+# from the rotation schedule {{json .Schedule}}. Jitter and blackout windows are applied
+# by the function, keep the jitter below its timeout.
 az functionapp config appsettings set --name "$FUNCTION_APP" --resource-group "$RESOURCE_GROUP" \
-  --settings "VAULT_URI={{.VaultURI}} SECRET_NAME={{.SecretName}} SENTRY_DSN={{.SentryDSN}} SLACK_BOT_TOKEN={{.SlackBotToken}} SLACK_CHANNEL_ID={{.SlackChannelID}}"
+  --settings "VAULT_URI={{.VaultURI}}" "SECRET_NAME={{.SecretName}}" "SENTRY_DSN={{.SentryDSN}}" "SLACK_BOT_TOKEN={{.SlackBotToken}}" "SLACK_CHANNEL_ID={{.SlackChannelID}}" \
+  "ROTATION_TIMER_SCHEDULE={{.AzureTimerSchedule}}" "ROTATION_JITTER={{.Jitter}}" "ROTATION_BLACKOUTS={{.Blackouts}}" "JWT_ALGORITHM={{.Algorithm}}"
 
 # Deploy the function
 # Note: This requires the Azure Functions Core Tools (func) to be installed.
@@ -142,29 +192,81 @@ echo "--- Deployment complete! ---"
 `
 )
 
+// the script template of each provider that can be deployed to the cloud.
+var scriptTemplates = map[string]string{
+	"AWS":   awsScriptTemplate,
+	"GCP":   gcpScriptTemplate,
+	"Azure": azureScriptTemplate,
+}
+
+// CanDeploy reports whether GenerateScript supports the provider. Local
+// providers such as the file and in-memory storage only run in-process.
+func CanDeploy(provider string) bool {
+	_, ok := scriptTemplates[provider]
+	return ok
+}
+
 // GenerateScript generates a deployment script for the given provider.
 func GenerateScript(data ScriptData) (string, error) {
-	var tpl string
-	switch data.Provider {
-	case "AWS":
-		tpl = awsScriptTemplate
-	case "GCP":
-		tpl = gcpScriptTemplate
-	case "Azure":
-		tpl = azureScriptTemplate
-	default:
-		return "", fmt.Errorf("unknown provider: %s", data.Provider)
+	tpl, ok := scriptTemplates[data.Provider]
+	if !ok {
+		return "", fmt.Errorf("no deployment script for provider %s, only AWS, GCP and Azure can be deployed", data.Provider)
 	}
 
-	tmpl, err := template.New("script").Parse(tpl)
+	vars, err := scheduleVars(data)
+	if err != nil {
+		return "", err
+	}
+
+	tmpl, err := template.New("script").Funcs(template.FuncMap{"json": jsonString}).Parse(tpl)
 	if err != nil {
 		return "", fmt.Errorf("failed to parse script template: %w", err)
 	}
 
 	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data); err != nil {
+	if err := tmpl.Execute(&buf, vars); err != nil {
 		return "", fmt.Errorf("failed to execute script template: %w", err)
 	}
 
 	return buf.String(), nil
 }
+
+// renders the rotation schedule for the cloud schedulers and checks the blackout windows.
+func scheduleVars(data ScriptData) (scriptVars, error) {
+	if data.Schedule == "" {
+		data.Schedule = "@daily"
+	}
+	schedule, err := secrets.ParseCron(data.Schedule)
+	if err != nil {
+		return scriptVars{}, err
+	}
+	if _, err := secrets.ParseBlackoutWindows(data.Blackouts); err != nil {
+		return scriptVars{}, err
+	}
+	if _, err := secrets.NewKeyGenerator(data.Algorithm); err != nil {
+		return scriptVars{}, err
+	}
+
+	vars := scriptVars{
+		ScriptData:             data,
+		CloudSchedulerSchedule: schedule.CloudSchedulerExpression(),
+		AzureTimerSchedule:     schedule.AzureTimerExpression(),
+	}
+	if data.Provider == "AWS" {
+		if vars.AWSSchedule, err = schedule.AWSExpression(); err != nil {
+			return scriptVars{}, err
+		}
+		if data.Jitter > 0 {
+			// Secrets Manager takes the window in whole hours, from 1h to 24h.
+			hours := min(max(int((data.Jitter+time.Hour-1)/time.Hour), 1), 24)
+			vars.AWSRotationWindow = fmt.Sprintf("%dh", hours)
+		}
+	}
+	return vars, nil
+}
+
+// quotes a string for the JSON and YAML files the scripts write.
+func jsonString(s string) (string, error) {
+	b, err := json.Marshal(s)
+	return string(b), err
+}
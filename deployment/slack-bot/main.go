@@ -3,16 +3,24 @@ package main
 import (
 	"context"
 	"fmt"
+	"log"
+	"net/http"
 	"net/url"
 	"os"
+	"strings"
 	"time"
 
+	secrets "token-toolkit/jwt-rotation"
+	"token-toolkit/jwt-rotation/notifiers"
 	"token-toolkit/jwt-rotation/storage"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/slack-go/slack"
 )
 
+const usage = "Unsupported command. Please use `/locksmith status` or `/locksmith revoke <kid> [reason]`"
+
 // AWS Lambda handler for the Slack slash command.
 func HandleSlackCommand(ctx context.Context, req events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	// Slack sends the command as a form-urlencoded payload. We need to parse it.
@@ -22,56 +30,64 @@ func HandleSlackCommand(ctx context.Context, req events.APIGatewayProxyRequest)
 	}
 
 	command := params.Get("command")
-	text := params.Get("text")
+	args := strings.Fields(params.Get("text"))
 
 	// Ensure the command is what we expect.
-	if command != "/locksmith" || text != "status" {
+	if command != "/locksmith" || len(args) == 0 || (args[0] != "status" && args[0] != "revoke") {
 		return events.APIGatewayProxyResponse{
-			Body:       "Unsupported command. Please use `/locksmith status`",
+			Body:       usage,
 			StatusCode: 200,
 		}, nil
 	}
 
+	if args[0] == "revoke" {
+		// Revoking changes the keyring, so only requests signed by Slack are accepted.
+		if err := verifySlackRequest(req); err != nil {
+			log.Printf("Rejected revoke request: %v", err)
+			return events.APIGatewayProxyResponse{Body: "Error: request could not be verified.", StatusCode: 401}, nil
+		}
+		if os.Getenv("SLACK_REVOKE_USERS") == "" {
+			return events.APIGatewayProxyResponse{Body: "Revoking from Slack is disabled, set SLACK_REVOKE_USERS to the user IDs allowed to revoke.", StatusCode: 200}, nil
+		}
+		if !revokeAllowed(params.Get("user_id")) {
+			return events.APIGatewayProxyResponse{Body: "You are not allowed to revoke secrets.", StatusCode: 200}, nil
+		}
+		if len(args) < 2 {
+			return events.APIGatewayProxyResponse{Body: usage, StatusCode: 200}, nil
+		}
+	}
+
 	// Configure the cloud provider and credentials via environment variables.
+	// Each provider reads its settings with its own prefix, e.g. AWS_SECRET_ID or GCP_PROJECT_ID.
 	provider := os.Getenv("CLOUD_PROVIDER") // "gcp", "aws", or "azure"
-	config := map[string]string{
-		// GCP
-		"projectID": os.Getenv("GCP_PROJECT_ID"),
-		"secretID":  os.Getenv("GCP_SECRET_ID"),
-		// AWS
-		"region": os.Getenv("AWS_REGION"),
-		// Azure
-		"vaultURI":   os.Getenv("AZURE_VAULT_URI"),
-		"secretName": os.Getenv("AZURE_SECRET_NAME"),
-	}
-
-	if provider == "aws" {
-		config["secretID"] = os.Getenv("AWS_SECRET_ID")
-	}
-
-	var storageProvider storage.SecretStorage
-	switch provider {
-	case "gcp":
-		storageProvider = storage.NewGCPSecretManager()
-	case "aws":
-		storageProvider = storage.NewAWSSecretsManager()
-	case "azure":
-		storageProvider = storage.NewAzureKeyVault()
-	default:
+
+	if _, ok := storage.Lookup(provider); !ok {
 		return events.APIGatewayProxyResponse{Body: "Error: CLOUD_PROVIDER environment variable is not configured correctly.", StatusCode: 500}, nil
 	}
 
-	if err := storageProvider.Setup(ctx, config); err != nil {
+	storageProvider, err := storage.Open(ctx, provider, storage.EnvSource(strings.ToUpper(provider)+"_"))
+	if err != nil {
 		return events.APIGatewayProxyResponse{Body: fmt.Sprintf("Error setting up storage provider: %v", err), StatusCode: 500}, nil
 	}
 
-	latestSecret, err := storageProvider.GetLatest(ctx)
-	if err != nil {
-		return events.APIGatewayProxyResponse{Body: fmt.Sprintf("Error getting latest secret: %v", err), StatusCode: 500}, nil
+	var responseText string
+	if args[0] == "revoke" {
+		reason := strings.Join(args[2:], " ")
+		if reason == "" {
+			reason = "revoked from Slack by " + params.Get("user_name")
+		}
+		responseText, err = revoke(ctx, storageProvider, args[1], reason)
+		if err != nil {
+			return events.APIGatewayProxyResponse{Body: fmt.Sprintf("Error revoking secret: %v", err), StatusCode: 500}, nil
+		}
+	} else {
+		latestSecret, err := storageProvider.GetLatest(ctx)
+		if err != nil {
+			return events.APIGatewayProxyResponse{Body: fmt.Sprintf("Error getting latest secret: %v", err), StatusCode: 500}, nil
+		}
+		responseText = fmt.Sprintf("✅ The last secret rotation was at: *%s*", latestSecret.CreatedAt.Format(time.RFC1123))
 	}
 
-	responseText := fmt.Sprintf("✅ The last secret rotation was at: *%s*", latestSecret.CreatedAt.Format(time.RFC1123))
-
 	return events.APIGatewayProxyResponse{
 		StatusCode: 200,
 		Headers:    map[string]string{"Content-Type": "application/json"},
@@ -79,6 +95,88 @@ func HandleSlackCommand(ctx context.Context, req events.APIGatewayProxyRequest)
 	}, nil
 }
 
+// revokes a secret, the notifiers configured for the bot announce it.
+func revoke(ctx context.Context, storageProvider storage.SecretStorage, kid, reason string) (string, error) {
+	policy := secrets.RotationPolicy{
+		GracePeriod:    48 * time.Hour,
+		StorageTimeout: 30 * time.Second,
+	}
+	generator, err := secrets.KeyGeneratorFromEnv()
+	if err != nil {
+		return "", err
+	}
+	secretManager, err := secrets.NewJWTManagerWithGenerator(ctx, policy, generator, storageProvider, newNotifier())
+	if err != nil {
+		return "", err
+	}
+
+	revocation, err := secretManager.Revoke(ctx, kid, reason)
+	if err != nil {
+		return "", err
+	}
+	if revocation.Replacement == nil {
+		return fmt.Sprintf("🚨 Secret `%s` was revoked.", revocation.ID), nil
+	}
+	return fmt.Sprintf("🚨 Secret `%s` was revoked, `%s` now signs tokens.", revocation.ID, revocation.Replacement.ID), nil
+}
+
+// checks the Slack request signature with SLACK_SIGNING_SECRET.
+func verifySlackRequest(req events.APIGatewayProxyRequest) error {
+	signingSecret := os.Getenv("SLACK_SIGNING_SECRET")
+	if signingSecret == "" {
+		return fmt.Errorf("SLACK_SIGNING_SECRET is not configured")
+	}
+
+	header := make(http.Header)
+	for key, value := range req.Headers {
+		header.Set(key, value)
+	}
+	verifier, err := slack.NewSecretsVerifier(header, signingSecret)
+	if err != nil {
+		return err
+	}
+	if _, err := verifier.Write([]byte(req.Body)); err != nil {
+		return err
+	}
+	return verifier.Ensure()
+}
+
+// reports whether a Slack user may revoke secrets. SLACK_REVOKE_USERS holds
+// a comma separated list of user IDs, when it is empty nobody can.
+func revokeAllowed(userID string) bool {
+	if userID == "" {
+		return false
+	}
+	for _, id := range strings.Split(os.Getenv("SLACK_REVOKE_USERS"), ",") {
+		if strings.TrimSpace(id) == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// initializes the notifiers configured through environment variables.
+func newNotifier() secrets.Notifier {
+	var notifiersList []secrets.Notifier
+	sentryNotifier, err := notifiers.NewSentryNotifier()
+	if err != nil {
+		log.Printf("Could not create sentry notifier: %v", err)
+	}
+	if sentryNotifier != nil {
+		notifiersList = append(notifiersList, sentryNotifier)
+	}
+
+	slackNotifier, err := notifiers.NewSlackNotifier()
+	if err != nil {
+		log.Printf("Could not create slack notifier: %v", err)
+	}
+	if slackNotifier != nil {
+		notifiersList = append(notifiersList, slackNotifier)
+	}
+
+	return notifiers.NewMultiNotifier(notifiersList...)
+}
+
 func main() {
 	lambda.Start(HandleSlackCommand)
 }
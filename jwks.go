@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"token-toolkit/internal/fileutil"
+	secrets "token-toolkit/jwt-rotation"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	gcs "google.golang.org/api/storage/v1"
+)
+
+var errUnsupportedDestination = errors.New("unsupported destination, use a file path, s3://, gs:// or an Azure blob URL")
+
+// loads the keyring without changing it and writes its JWKS to out, or to
+// stdout when out is empty.
+func exportJWKS(ctx context.Context, provider string, cfg any, policy secrets.RotationPolicy, out string) error {
+	storageProvider, err := openStorage(ctx, provider, cfg)
+	if err != nil {
+		return err
+	}
+	verifier, err := secrets.NewJWTVerifier(ctx, policy, storageProvider, buildNotifier(nil))
+	if err != nil {
+		return err
+	}
+
+	jwks, err := verifier.JWKS()
+	if err != nil {
+		return err
+	}
+	if len(jwks.Keys) == 0 {
+		return fmt.Errorf("the keyring has no public keys, set JWT_ALGORITHM to an asymmetric algorithm and rotate")
+	}
+	body, err := json.MarshalIndent(jwks, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode JWKS: %w", err)
+	}
+
+	if out == "" {
+		fmt.Println(string(body))
+		return nil
+	}
+	if err := writeJWKS(ctx, out, body, verifier.JWKSCacheControl()); err != nil {
+		return fmt.Errorf("failed to write JWKS to %s: %w", out, err)
+	}
+	fmt.Printf("Wrote %d keys to %s\n", len(jwks.Keys), out)
+	return nil
+}
+
+// writes a JWKS to s3://bucket/key, gs://bucket/object, an Azure blob URL
+// or a local file. Objects are stored with the given Cache-Control, so a
+// static host or CDN serving them follows the rotation schedule.
+func writeJWKS(ctx context.Context, dest string, body []byte, cacheControl string) error {
+	switch {
+	case strings.HasPrefix(dest, "s3://"):
+		bucket, key, err := splitObjectPath(strings.TrimPrefix(dest, "s3://"))
+		if err != nil {
+			return err
+		}
+		return putS3Object(ctx, bucket, key, body, cacheControl)
+	case strings.HasPrefix(dest, "gs://"):
+		bucket, object, err := splitObjectPath(strings.TrimPrefix(dest, "gs://"))
+		if err != nil {
+			return err
+		}
+		return putGCSObject(ctx, bucket, object, body, cacheControl)
+	case strings.HasPrefix(dest, "https://"):
+		return putAzureBlob(ctx, dest, body, cacheControl)
+	case strings.Contains(dest, "://"):
+		return errUnsupportedDestination
+	default:
+		return fileutil.WriteFileAtomic(dest, body, 0644)
+	}
+}
+
+// splits "bucket/path/to/object".
+func splitObjectPath(path string) (bucket, object string, err error) {
+	bucket, object, _ = strings.Cut(path, "/")
+	if bucket == "" || object == "" {
+		return "", "", fmt.Errorf("object path must look like bucket/path/to/jwks.json")
+	}
+	return bucket, object, nil
+}
+
+// uploads an object with the S3 client, using the default AWS credentials and
+// the region in REGION or the AWS configuration. The client picks the
+// addressing style for the bucket name and honours the shared endpoint
+// settings, e.g. AWS_ENDPOINT_URL_S3 and AWS_USE_FIPS_ENDPOINT.
+func putS3Object(ctx context.Context, bucket, key string, body []byte, cacheControl string) error {
+	awsCfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(os.Getenv("REGION")))
+	if err != nil {
+		return fmt.Errorf("failed to load aws config: %w", err)
+	}
+	if awsCfg.Region == "" {
+		return fmt.Errorf("no AWS region configured, set REGION or AWS_REGION")
+	}
+
+	_, err = s3.NewFromConfig(awsCfg).PutObject(ctx, &s3.PutObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		Body:         bytes.NewReader(body),
+		ContentType:  aws.String(secrets.JWKSContentType),
+		CacheControl: aws.String(cacheControl),
+	})
+	return err
+}
+
+// uploads an object with the default Google credentials.
+func putGCSObject(ctx context.Context, bucket, object string, body []byte, cacheControl string) error {
+	service, err := gcs.NewService(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create cloud storage client: %w", err)
+	}
+	_, err = service.Objects.Insert(bucket, &gcs.Object{
+		Name:         object,
+		ContentType:  secrets.JWKSContentType,
+		CacheControl: cacheControl,
+	}).Media(bytes.NewReader(body)).Context(ctx).Do()
+	return err
+}
+
+// uploads a block blob to a URL like
+// https://<account>.blob.core.windows.net/<container>/jwks.json, using the
+// default Azure credential.
+func putAzureBlob(ctx context.Context, blobURL string, body []byte, cacheControl string) error {
+	parsed, err := url.Parse(blobURL)
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(parsed.Hostname(), ".blob.core.windows.net") {
+		return errUnsupportedDestination
+	}
+
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return fmt.Errorf("failed to obtain a credential: %w", err)
+	}
+	client, err := blockblob.NewClient(blobURL, cred, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create blob client: %w", err)
+	}
+	_, err = client.UploadBuffer(ctx, body, &blockblob.UploadBufferOptions{
+		HTTPHeaders: &blob.HTTPHeaders{
+			BlobContentType:  to.Ptr(secrets.JWKSContentType),
+			BlobCacheControl: to.Ptr(cacheControl),
+		},
+	})
+	return err
+}
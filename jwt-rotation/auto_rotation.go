@@ -0,0 +1,230 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// how long the auto-rotation loop waits before retrying a failed rotation that is still due.
+const autoRotationRetryInterval = time.Minute
+
+// a running auto-rotation loop.
+type autoRotation struct {
+	stop chan struct{}
+	done chan struct{}
+	// when the loop will rotate next, zero while a rotation runs.
+	next time.Time
+}
+
+// describes the rotation schedule of a manager, for status pages and health checks.
+type RotationStatus struct {
+	// reports whether the auto-rotation loop is running.
+	AutoRotating bool   `json:"autoRotating"`
+	ActiveID     string `json:"activeId,omitempty"`
+	// when the active secret was created.
+	LastRotation time.Time `json:"lastRotation"`
+	// zero when no rotation is scheduled.
+	NextRotation time.Time `json:"nextRotation"`
+	// the error of the last automatic rotation, empty once one succeeds.
+	LastError string `json:"lastError,omitempty"`
+	// reports whether the keyring sync loop is running.
+	KeyringSyncing bool `json:"keyringSyncing"`
+	// when the keyring was last synced from storage, zero if never.
+	LastSync time.Time `json:"lastSync"`
+	// the error of the last sync, empty once one succeeds.
+	SyncError string `json:"syncError,omitempty"`
+}
+
+// StartAutoRotation starts a background goroutine to rotate secrets on the
+// policy's schedule, or when the active secret reaches the rotation interval
+// without one, with the policy's jitter and blackout windows applied.
+// Starting a loop that is already running does nothing. The loop ends when
+// the context is cancelled or StopAutoRotation is called, and each rotation
+// runs under the same context.
+func (rm *RotationManager) StartAutoRotation(ctx context.Context) error {
+	if rm.verifyOnly {
+		return ErrVerifyOnly
+	}
+	// A loop that StopAutoRotation is stopping may still be rotating.
+	rm.mutex.RLock()
+	var stopping chan struct{}
+	if rm.auto == nil {
+		stopping = rm.lastDone
+	}
+	rm.mutex.RUnlock()
+	if stopping != nil {
+		<-stopping
+	}
+
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	if rm.auto != nil {
+		return nil
+	}
+	var last time.Time
+	if rm.activeSecret != nil {
+		last = rm.activeSecret.CreatedAt
+	}
+	next, err := rm.policy.nextRotation(last, time.Now(), rm.policy.jitter)
+	if err != nil {
+		return fmt.Errorf("invalid rotation schedule: %w", err)
+	}
+
+	auto := &autoRotation{stop: make(chan struct{}), done: make(chan struct{}), next: next}
+	rm.auto = auto
+	rm.lastDone = auto.done
+	go rm.runAutoRotation(ctx, auto)
+	return nil
+}
+
+func (rm *RotationManager) runAutoRotation(ctx context.Context, auto *autoRotation) {
+	defer func() {
+		rm.mutex.Lock()
+		if rm.auto == auto {
+			rm.auto = nil
+		}
+		rm.mutex.Unlock()
+		close(auto.done)
+	}()
+
+	for {
+		rm.mutex.RLock()
+		next := auto.next
+		rm.mutex.RUnlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-auto.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		rm.mutex.Lock()
+		auto.next = time.Time{}
+		rotate := rm.autoRotate
+		rm.mutex.Unlock()
+		if rotate == nil {
+			rotate = rm.RotateSecret
+		}
+
+		_, err := rotate(ctx)
+		rm.mutex.Lock()
+		rm.lastError = err
+		rm.mutex.Unlock()
+		if err != nil {
+			// RotateSecret already notified, it's better to log this than to panic
+			fmt.Printf("Error during automatic rotation: %v\n", err)
+		}
+
+		now := time.Now()
+		next, scheduleErr := rm.policy.nextRotation(rm.LastRotation(), now, rm.policy.jitter)
+		if scheduleErr != nil {
+			fmt.Printf("Error scheduling automatic rotation: %v\n", scheduleErr)
+			return
+		}
+		if retryAt := now.Add(autoRotationRetryInterval); err != nil && next.Before(retryAt) {
+			next = retryAt
+		}
+		rm.mutex.Lock()
+		auto.next = next
+		rm.mutex.Unlock()
+	}
+}
+
+// StopAutoRotation stops the auto-rotation loop and waits until a rotation in
+// flight has finished, so a loop started afterwards never runs alongside it.
+// The loop can be started again afterwards.
+func (rm *RotationManager) StopAutoRotation() {
+	rm.mutex.Lock()
+	auto := rm.auto
+	rm.auto = nil
+	rm.mutex.Unlock()
+
+	if auto == nil {
+		return
+	}
+	close(auto.stop)
+	<-auto.done
+}
+
+// Wait blocks until the auto-rotation loop that was last started has exited,
+// e.g. once its context is done. It returns immediately if no loop was
+// started.
+func (rm *RotationManager) Wait() {
+	rm.mutex.RLock()
+	done := rm.lastDone
+	rm.mutex.RUnlock()
+
+	if done != nil {
+		<-done
+	}
+}
+
+// returns when the active secret was created, or the zero time without one.
+func (rm *RotationManager) LastRotation() time.Time {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	if rm.activeSecret == nil {
+		return time.Time{}
+	}
+	return rm.activeSecret.CreatedAt
+}
+
+// NextRotation returns when the next rotation is due: the time the
+// auto-rotation loop is waiting for, including jitter, or, when the loop is
+// not running, when the policy's schedule next comes due. It returns the zero
+// time if nothing is scheduled or a rotation is running.
+func (rm *RotationManager) NextRotation() time.Time {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	return rm.nextRotation()
+}
+
+// the caller must hold the lock.
+func (rm *RotationManager) nextRotation() time.Time {
+	if rm.auto != nil {
+		return rm.auto.next
+	}
+
+	var last time.Time
+	if rm.activeSecret != nil {
+		last = rm.activeSecret.CreatedAt
+	}
+	next, err := rm.policy.NextRotation(last, time.Now())
+	if err != nil {
+		return time.Time{}
+	}
+	return next
+}
+
+// returns the rotation status of the manager.
+func (rm *RotationManager) Status() RotationStatus {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	status := RotationStatus{
+		AutoRotating:   rm.auto != nil,
+		NextRotation:   rm.nextRotation(),
+		KeyringSyncing: rm.sync != nil,
+		LastSync:       rm.lastSync,
+	}
+	if rm.activeSecret != nil {
+		status.ActiveID = rm.activeSecret.ID
+		status.LastRotation = rm.activeSecret.CreatedAt
+	}
+	if rm.lastError != nil {
+		status.LastError = rm.lastError.Error()
+	}
+	if rm.syncError != nil {
+		status.SyncError = rm.syncError.Error()
+	}
+	return status
+}
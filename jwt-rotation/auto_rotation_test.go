@@ -0,0 +1,168 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"token-toolkit/jwt-rotation/storage"
+)
+
+func newAutoRotationManager(t *testing.T, policy RotationPolicy) *RotationManager {
+	t.Helper()
+	generator, err := NewRandomSecretGenerator(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rm, err := NewRotationManager(context.Background(), policy, storage.NewMemoryStorage(), generator, nil)
+	if err != nil {
+		t.Fatalf("NewRotationManager failed: %v", err)
+	}
+	t.Cleanup(rm.StopAutoRotation)
+	return rm
+}
+
+// waits for condition to hold, polling the manager's status.
+func waitForStatus(t *testing.T, rm *RotationManager, condition func(RotationStatus) bool) RotationStatus {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := rm.Status()
+		if condition(status) {
+			return status
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("status never reached the expected state, last %+v", status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAutoRotationStatus(t *testing.T) {
+	rm := newAutoRotationManager(t, RotationPolicy{RotationInterval: 24 * time.Hour, GracePeriod: time.Hour})
+	created := rm.LastRotation()
+	if created.IsZero() {
+		t.Fatal("LastRotation is zero with an active secret")
+	}
+
+	status := rm.Status()
+	if status.AutoRotating || !status.NextRotation.Equal(created.Add(24*time.Hour)) {
+		t.Errorf("status before starting = %+v, want not rotating and next at %s", status, created.Add(24*time.Hour))
+	}
+
+	ctx := context.Background()
+	if err := rm.StartAutoRotation(ctx); err != nil {
+		t.Fatalf("StartAutoRotation failed: %v", err)
+	}
+	loop := rm.auto
+	if err := rm.StartAutoRotation(ctx); err != nil {
+		t.Fatalf("second StartAutoRotation failed: %v", err)
+	}
+	if rm.auto != loop {
+		t.Error("second StartAutoRotation started another loop")
+	}
+	if status := rm.Status(); !status.AutoRotating || !status.NextRotation.Equal(created.Add(24*time.Hour)) || status.ActiveID == "" {
+		t.Errorf("status while running = %+v", status)
+	}
+
+	rm.StopAutoRotation()
+	if status := rm.Status(); status.AutoRotating {
+		t.Errorf("status after stopping = %+v, want not rotating", status)
+	}
+	rm.StopAutoRotation()
+}
+
+func TestAutoRotationRotatesWhenDue(t *testing.T) {
+	rm := newAutoRotationManager(t, RotationPolicy{RotationInterval: 50 * time.Millisecond, GracePeriod: time.Hour})
+	first := rm.Status().ActiveID
+
+	if err := rm.StartAutoRotation(context.Background()); err != nil {
+		t.Fatalf("StartAutoRotation failed: %v", err)
+	}
+	status := waitForStatus(t, rm, func(s RotationStatus) bool { return s.ActiveID != first })
+	if status.LastError != "" || !status.LastRotation.Equal(rm.LastRotation()) {
+		t.Errorf("status after an automatic rotation = %+v", status)
+	}
+}
+
+func TestAutoRotationReportsErrors(t *testing.T) {
+	rm := newAutoRotationManager(t, RotationPolicy{RotationInterval: time.Millisecond, GracePeriod: time.Hour})
+	rm.autoRotate = func(ctx context.Context) (*Secret, error) {
+		return nil, errors.New("storage is down")
+	}
+
+	start := time.Now()
+	if err := rm.StartAutoRotation(context.Background()); err != nil {
+		t.Fatalf("StartAutoRotation failed: %v", err)
+	}
+	status := waitForStatus(t, rm, func(s RotationStatus) bool { return s.LastError != "" && !s.NextRotation.IsZero() })
+	if status.LastError != "storage is down" {
+		t.Errorf("LastError = %q, want the rotation error", status.LastError)
+	}
+	// A failed rotation that is still due is retried after a pause, not right away.
+	if status.NextRotation.Before(start.Add(autoRotationRetryInterval)) {
+		t.Errorf("next rotation after a failure at %s, want a retry after %s", status.NextRotation, autoRotationRetryInterval)
+	}
+}
+
+func TestStopAutoRotationWaitsForRotation(t *testing.T) {
+	rm := newAutoRotationManager(t, RotationPolicy{RotationInterval: time.Millisecond, GracePeriod: time.Hour})
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	rm.autoRotate = func(ctx context.Context) (*Secret, error) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+		return rm.RotateSecret(ctx)
+	}
+
+	if err := rm.StartAutoRotation(context.Background()); err != nil {
+		t.Fatalf("StartAutoRotation failed: %v", err)
+	}
+	<-started
+
+	stopped := make(chan struct{})
+	go func() {
+		rm.StopAutoRotation()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		t.Fatal("StopAutoRotation returned while a rotation was running")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// A loop started now must not run alongside the stopping one.
+	restarted := make(chan error)
+	go func() { restarted <- rm.StartAutoRotation(context.Background()) }()
+	select {
+	case <-restarted:
+		t.Fatal("StartAutoRotation returned while the stopped loop was rotating")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-stopped
+	if err := <-restarted; err != nil {
+		t.Fatalf("StartAutoRotation after stopping failed: %v", err)
+	}
+	if !rm.Status().AutoRotating {
+		t.Error("the restarted loop is not running")
+	}
+}
+
+func TestAutoRotationEndsWithItsContext(t *testing.T) {
+	rm := newAutoRotationManager(t, RotationPolicy{RotationInterval: time.Hour, GracePeriod: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := rm.StartAutoRotation(ctx); err != nil {
+		t.Fatalf("StartAutoRotation failed: %v", err)
+	}
+
+	cancel()
+	rm.Wait()
+	if rm.Status().AutoRotating {
+		t.Error("the loop still runs after its context was cancelled")
+	}
+}
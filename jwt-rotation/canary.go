@@ -0,0 +1,180 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrCanaryFailed is returned when a canary did not accept the new secret in time.
+var ErrCanaryFailed = errors.New("canary check failed")
+
+// DefaultCanaryTimeout is used when a policy does not set CanaryTimeout.
+const DefaultCanaryTimeout = time.Minute
+
+// how long to wait before retrying canaries that failed.
+const canaryRetryInterval = 2 * time.Second
+
+// checks that a consumer accepts tokens signed with the active secret.
+type Canary interface {
+	// describes the canary in notifications and errors.
+	Name() string
+	// returns nil if the consumer accepted the probe token.
+	Check(ctx context.Context, token string) error
+}
+
+// calls an HTTP endpoint with the probe token as a bearer token and expects a 2xx response.
+type HTTPCanary struct {
+	url    string
+	client *http.Client
+}
+
+// creates a new HTTPCanary.
+func NewHTTPCanary(url string) *HTTPCanary {
+	return &HTTPCanary{url: url, client: http.DefaultClient}
+}
+
+func (c *HTTPCanary) Name() string {
+	return c.url
+}
+
+// Check sends a GET request to the endpoint.
+func (c *HTTPCanary) Check(ctx context.Context, token string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// runs a local command with the probe token in the LOCKSMITH_CANARY_TOKEN
+// environment variable and expects it to exit successfully.
+type CommandCanary struct {
+	name string
+	args []string
+}
+
+// creates a new CommandCanary.
+func NewCommandCanary(name string, args ...string) *CommandCanary {
+	return &CommandCanary{name: name, args: args}
+}
+
+func (c *CommandCanary) Name() string {
+	return strings.Join(append([]string{c.name}, c.args...), " ")
+}
+
+// Check runs the command, which is killed when the context is done.
+func (c *CommandCanary) Check(ctx context.Context, token string) error {
+	// The token goes through the environment so it does not show up in process listings.
+	cmd := exec.CommandContext(ctx, c.name, c.args...)
+	cmd.Env = append(os.Environ(), "LOCKSMITH_CANARY_TOKEN="+token)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if out := strings.TrimSpace(string(output)); out != "" {
+			return fmt.Errorf("%w: %s", err, out)
+		}
+		return err
+	}
+	return nil
+}
+
+// registers canaries that run after every RotateSecret.
+func (jm *JWTManager) AddCanary(canaries ...Canary) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	jm.canaries = append(jm.canaries, canaries...)
+}
+
+// RotateSecret rotates the secret and then runs the canaries with a probe token
+// signed by the new secret. Canaries that fail are retried until the policy's
+// canary timeout, after which the rotation is rolled back, an error notification
+// is sent and an error wrapping ErrCanaryFailed is returned.
+func (jm *JWTManager) RotateSecret(ctx context.Context) (*Secret, error) {
+	secret, err := jm.RotationManager.RotateSecret(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	jm.mutex.RLock()
+	canaries := jm.canaries
+	jm.mutex.RUnlock()
+	if len(canaries) == 0 {
+		return secret, nil
+	}
+
+	canaryErr := jm.runCanaries(ctx, canaries)
+	if canaryErr == nil {
+		return secret, nil
+	}
+
+	err = fmt.Errorf("secret %s: %w", secret.ID, canaryErr)
+	if _, rollbackErr := jm.Rollback(context.WithoutCancel(ctx), err.Error(), false); rollbackErr != nil {
+		err = errors.Join(err, fmt.Errorf("rollback failed: %w", rollbackErr))
+	}
+	jm.notifyError(ctx, err)
+	return nil, err
+}
+
+// runs the canaries until all of them passed or the canary timeout expired.
+func (jm *JWTManager) runCanaries(ctx context.Context, canaries []Canary) error {
+	timeout := jm.policy.CanaryTimeout
+	if timeout <= 0 {
+		timeout = DefaultCanaryTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	token, err := jm.SignToken(jwt.RegisteredClaims{
+		Subject:   "locksmith-canary",
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(timeout + time.Minute)),
+	})
+	if err != nil {
+		return fmt.Errorf("%w: failed to sign probe token: %v", ErrCanaryFailed, err)
+	}
+
+	pending := canaries
+	for {
+		failed := make([]Canary, 0, len(pending))
+		var errs []error
+		for _, canary := range pending {
+			if err := canary.Check(ctx, token); err != nil {
+				failed = append(failed, canary)
+				errs = append(errs, fmt.Errorf("%s: %w", canary.Name(), err))
+			}
+		}
+		if len(failed) == 0 {
+			return nil
+		}
+		pending = failed
+
+		// Consumers may need a moment to pick up the new secret.
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w within %s: %w", ErrCanaryFailed, timeout, errors.Join(errs...))
+		case <-time.After(canaryRetryInterval):
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"token-toolkit/jwt-rotation/storage"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// a consumer that records the kids of the probe tokens and answers with status.
+type canaryServer struct {
+	mutex sync.Mutex
+	kids  []string
+}
+
+func (s *canaryServer) start(t *testing.T, accept func(token string) bool) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{}); err == nil {
+			kid, _ := parsed.Header["kid"].(string)
+			s.mutex.Lock()
+			s.kids = append(s.kids, kid)
+			s.mutex.Unlock()
+		}
+		if !accept(token) {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestCanaryFailureRollsBack(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	notifier := &recordingNotifier{}
+	jm, err := NewJWTManager(ctx, RotationPolicy{GracePeriod: time.Hour, CanaryTimeout: 100 * time.Millisecond}, 32, store, notifier)
+	if err != nil {
+		t.Fatalf("NewJWTManager failed: %v", err)
+	}
+	original := jm.keyring().active.ID
+
+	// A consumer that still only knows the original secret.
+	consumer := &canaryServer{}
+	jm.AddCanary(NewHTTPCanary(consumer.start(t, func(string) bool { return false })))
+
+	if _, err := jm.RotateSecret(ctx); !errors.Is(err, ErrCanaryFailed) {
+		t.Fatalf("RotateSecret error = %v, want ErrCanaryFailed", err)
+	}
+	if len(consumer.kids) == 0 || consumer.kids[0] == original {
+		t.Fatalf("probe tokens were signed by %v, want the rotated secret", consumer.kids)
+	}
+	faulty := consumer.kids[0]
+
+	if active := jm.keyring().active.ID; active != original {
+		t.Errorf("active secret after the failed canary = %s, want %s", active, original)
+	}
+	assertStoredStates(t, store, map[string]storage.SecretState{
+		original: storage.StateActive,
+		faulty:   storage.StatePrevious,
+	})
+	if len(notifier.rollbacks) != 1 || notifier.rollbacks[0].Faulty.ID != faulty || notifier.rollbacks[0].Retired {
+		t.Errorf("rollback notifications = %+v, want one keeping %s", notifier.rollbacks, faulty)
+	}
+	if len(notifier.errors) != 1 || !errors.Is(notifier.errors[0], ErrCanaryFailed) {
+		t.Errorf("error notifications = %v, want one wrapping ErrCanaryFailed", notifier.errors)
+	}
+}
+
+func TestCanarySuccessKeepsRotation(t *testing.T) {
+	ctx := context.Background()
+	notifier := &recordingNotifier{}
+	jm, err := NewJWTManager(ctx, RotationPolicy{GracePeriod: time.Hour, CanaryTimeout: time.Second}, 32, storage.NewMemoryStorage(), notifier)
+	if err != nil {
+		t.Fatalf("NewJWTManager failed: %v", err)
+	}
+
+	consumer := &canaryServer{}
+	jm.AddCanary(NewHTTPCanary(consumer.start(t, func(token string) bool {
+		_, err := jm.ValidateToken(token)
+		return err == nil
+	})))
+
+	rotated, err := jm.RotateSecret(ctx)
+	if err != nil {
+		t.Fatalf("RotateSecret failed: %v", err)
+	}
+	if active := jm.keyring().active.ID; active != rotated.ID {
+		t.Errorf("active secret = %s, want %s", active, rotated.ID)
+	}
+	if len(consumer.kids) != 1 || consumer.kids[0] != rotated.ID {
+		t.Errorf("probe tokens were signed by %v, want %s once", consumer.kids, rotated.ID)
+	}
+	if len(notifier.rollbacks) != 0 || len(notifier.errors) != 0 {
+		t.Errorf("notified rollbacks %v and errors %v, want none", notifier.rollbacks, notifier.errors)
+	}
+}
+
+func TestCommandCanary(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh to run the command canary with")
+	}
+	ctx := context.Background()
+
+	passing := NewCommandCanary("sh", "-c", `test "$LOCKSMITH_CANARY_TOKEN" = probe`)
+	if err := passing.Check(ctx, "probe"); err != nil {
+		t.Errorf("Check with the expected token failed: %v", err)
+	}
+	if err := passing.Check(ctx, "other"); err == nil {
+		t.Error("Check with another token succeeded")
+	}
+
+	failing := NewCommandCanary("sh", "-c", "echo rejected; exit 1")
+	if err := failing.Check(ctx, "probe"); err == nil || !strings.Contains(err.Error(), "rejected") {
+		t.Errorf("Check error = %v, want the command output in it", err)
+	}
+}
@@ -0,0 +1,287 @@
+package secrets
+
+import (
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is a parsed standard five field cron expression
+// (minute, hour, day of month, month, day of week). Schedules are evaluated
+// in UTC, like the cloud schedulers they are translated for.
+type CronSchedule struct {
+	expr                          string
+	fields                        [5]string
+	minute, hour, dom, month, dow uint64
+	domRestricted, dowRestricted  bool
+}
+
+type cronField struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var cronFields = [5]cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}},
+	// 7 is accepted as Sunday and folded onto 0.
+	{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}},
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+const (
+	allDaysOfMonth uint64 = 1<<32 - 2
+	allDaysOfWeek  uint64 = 1<<7 - 1
+)
+
+var weekdayNames = [7]string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+
+// ParseCron parses a five field cron expression such as "30 2 * * MON-FRI".
+// Fields accept *, numbers, names (JAN-DEC, SUN-SAT), ranges, lists and
+// steps, and the @yearly, @monthly, @weekly, @daily and @hourly macros are
+// supported. When both the day of month and the day of week are restricted,
+// a day matching either one matches, as in cron.
+func ParseCron(expr string) (*CronSchedule, error) {
+	normalized := strings.TrimSpace(expr)
+	if macro, ok := cronMacros[strings.ToLower(normalized)]; ok {
+		normalized = macro
+	}
+
+	fields := strings.Fields(normalized)
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields, got %d", expr, len(fields))
+	}
+
+	s := &CronSchedule{expr: expr}
+	copy(s.fields[:], fields)
+	sets := [5]*uint64{&s.minute, &s.hour, &s.dom, &s.month, &s.dow}
+	for i, field := range fields {
+		set, err := parseCronField(field, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %w", expr, err)
+		}
+		*sets[i] = set
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow = s.dow&^(1<<7) | 1
+	}
+	s.domRestricted = !strings.HasPrefix(fields[2], "*")
+	s.dowRestricted = !strings.HasPrefix(fields[4], "*")
+	return s, nil
+}
+
+// parses one field into a bit set of the values it matches.
+func parseCronField(field string, spec cronField) (uint64, error) {
+	var set uint64
+	for _, item := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q in %s field", stepPart, spec.name)
+			}
+			step = n
+		}
+
+		var low, high int
+		switch {
+		case rangePart == "*":
+			low, high = spec.min, spec.max
+		default:
+			lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if low, err = cronValue(lowPart, spec); err != nil {
+				return 0, err
+			}
+			high = low
+			if isRange {
+				if high, err = cronValue(highPart, spec); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// "5/15" means every 15 starting at 5.
+				high = spec.max
+			}
+		}
+		if low > high {
+			return 0, fmt.Errorf("invalid range %q in %s field", rangePart, spec.name)
+		}
+
+		for v := low; v <= high; v += step {
+			set |= 1 << v
+		}
+	}
+	return set, nil
+}
+
+func cronValue(value string, spec cronField) (int, error) {
+	if n, ok := spec.names[strings.ToUpper(value)]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < spec.min || n > spec.max {
+		return 0, fmt.Errorf("invalid value %q in %s field, expected %d-%d", value, spec.name, spec.min, spec.max)
+	}
+	return n, nil
+}
+
+// returns the expression the schedule was parsed from.
+func (s *CronSchedule) String() string {
+	return s.expr
+}
+
+// Next returns the first time after t that matches the schedule, in UTC.
+// It returns the zero time if nothing matches within five years, e.g. for "0 0 30 2 *".
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !s.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// reports whether both day fields are restricted but one of them covers
+// every day, e.g. "1-31" or "0-6": since a day matching either one matches,
+// every day does.
+func (s *CronSchedule) everyDay() bool {
+	return s.domRestricted && s.dowRestricted && (s.dom == allDaysOfMonth || s.dow == allDaysOfWeek)
+}
+
+func (s *CronSchedule) matchesDay(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domRestricted && s.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// AWSExpression renders the schedule for EventBridge and Secrets Manager
+// rotation rules, e.g. "cron(30 2 ? * MON,TUE *)". Those expressions cannot
+// restrict both the day of month and the day of week.
+func (s *CronSchedule) AWSExpression() (string, error) {
+	// AWS writes "every n starting at the minimum" as "0/n" rather than "*/n".
+	var fields [4]string
+	for i, field := range s.fields[:4] {
+		fields[i] = strings.ReplaceAll(field, "*/", strconv.Itoa(cronFields[i].min)+"/")
+	}
+
+	allDays, allWeekdays := s.dom == allDaysOfMonth, s.dow == allDaysOfWeek
+	dom, dow := fields[2], "?"
+	switch {
+	case s.everyDay():
+		dom = "*"
+	case allWeekdays:
+	case allDays:
+		dom, dow = "?", s.weekdays(func(d int) string { return weekdayNames[d] })
+	default:
+		return "", fmt.Errorf("cron expression %q restricts both the day of month and the day of week, which AWS does not support", s.expr)
+	}
+	return fmt.Sprintf("cron(%s %s %s %s %s *)", fields[0], fields[1], dom, fields[3], dow), nil
+}
+
+// CloudSchedulerExpression renders the schedule for Cloud Scheduler, which
+// reads standard cron expressions; the job has to use the UTC time zone.
+func (s *CronSchedule) CloudSchedulerExpression() string {
+	return s.normalized(strconv.Itoa)
+}
+
+// AzureTimerExpression renders the schedule as an NCRONTAB expression for an
+// Azure Functions timer trigger, which has a leading seconds field.
+func (s *CronSchedule) AzureTimerExpression() string {
+	return "0 " + s.normalized(strconv.Itoa)
+}
+
+// returns the five fields with names replaced by numbers, "a/n" steps
+// spelled as "a-max/n" and the day of week spelled out by format.
+func (s *CronSchedule) normalized(format func(int) string) string {
+	var fields [5]string
+	for i, field := range s.fields[:4] {
+		items := strings.Split(field, ",")
+		for j, item := range items {
+			items[j] = numericItem(item, cronFields[i])
+		}
+		fields[i] = strings.Join(items, ",")
+	}
+	fields[4] = "*"
+	if s.dow != allDaysOfWeek {
+		fields[4] = s.weekdays(format)
+	}
+	if s.everyDay() {
+		// Spelling out the day that covers everything as "*" would make
+		// the schedulers match only the other one.
+		fields[2], fields[4] = "*", "*"
+	}
+	return strings.Join(fields[:], " ")
+}
+
+// rewrites one already validated list item of a field in its numeric form.
+func numericItem(item string, spec cronField) string {
+	rangePart, step, hasStep := strings.Cut(item, "/")
+	if rangePart == "*" {
+		return item
+	}
+	low, high, isRange := strings.Cut(rangePart, "-")
+	lowValue, _ := cronValue(low, spec)
+	rangePart = strconv.Itoa(lowValue)
+	switch {
+	case isRange:
+		highValue, _ := cronValue(high, spec)
+		rangePart += "-" + strconv.Itoa(highValue)
+	case hasStep:
+		rangePart += "-" + strconv.Itoa(spec.max)
+	}
+	if hasStep {
+		return rangePart + "/" + step
+	}
+	return rangePart
+}
+
+// lists the matched days of week, which avoids differences in how schedulers number them.
+func (s *CronSchedule) weekdays(format func(int) string) string {
+	days := make([]string, 0, bits.OnesCount64(s.dow))
+	for d := 0; d < 7; d++ {
+		if s.dow&(1<<d) != 0 {
+			days = append(days, format(d))
+		}
+	}
+	return strings.Join(days, ",")
+}
@@ -0,0 +1,118 @@
+package secrets
+
+import (
+	"testing"
+	"time"
+)
+
+// a Sunday.
+var cronFrom = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func TestParseCronRejectsInvalidExpressions(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"* * * FOO *",
+		"* * * * MON-",
+		"@reboot",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{expr: "*/15 * * * *", from: cronFrom, want: time.Date(2025, 6, 1, 12, 15, 0, 0, time.UTC)},
+		{expr: "5/20 * * * *", from: cronFrom, want: time.Date(2025, 6, 1, 12, 5, 0, 0, time.UTC)},
+		{expr: "5/20 * * * *", from: cronFrom.Add(46 * time.Minute), want: time.Date(2025, 6, 1, 13, 5, 0, 0, time.UTC)},
+		{expr: "30 2 * * *", from: cronFrom, want: time.Date(2025, 6, 2, 2, 30, 0, 0, time.UTC)},
+		{expr: "0 12 * * *", from: cronFrom, want: time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)},
+		{expr: "0 12 * * *", from: cronFrom.Add(-30 * time.Second), want: cronFrom},
+		{expr: "@hourly", from: cronFrom, want: time.Date(2025, 6, 1, 13, 0, 0, 0, time.UTC)},
+		{expr: "@yearly", from: cronFrom, want: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * * MON-FRI", from: cronFrom, want: time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * * 7", from: cronFrom, want: time.Date(2025, 6, 8, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * * sun", from: cronFrom, want: time.Date(2025, 6, 8, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 * JUN,DEC SAT", from: cronFrom, want: time.Date(2025, 6, 7, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 13 * *", from: cronFrom, want: time.Date(2025, 6, 13, 0, 0, 0, 0, time.UTC)},
+		// Both day fields restricted: the 13th or a Friday, whichever comes first.
+		{expr: "0 0 13 * FRI", from: cronFrom, want: time.Date(2025, 6, 6, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 13 * FRI", from: time.Date(2025, 6, 7, 0, 0, 0, 0, time.UTC), want: time.Date(2025, 6, 13, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 1-31 * MON", from: cronFrom, want: time.Date(2025, 6, 2, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 29 2 *", from: cronFrom, want: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{expr: "0 0 30 2 *", from: cronFrom, want: time.Time{}},
+		// Schedules are evaluated in UTC whatever the zone of from.
+		{expr: "0 13 * * *", from: cronFrom.In(time.FixedZone("UTC+2", 2*60*60)), want: time.Date(2025, 6, 1, 13, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		schedule, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) failed: %v", tt.expr, err)
+		}
+		if got := schedule.Next(tt.from); !got.Equal(tt.want) || got.Location() != time.UTC {
+			t.Errorf("ParseCron(%q).Next(%s) = %s, want %s", tt.expr, tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestCronExpressions(t *testing.T) {
+	tests := []struct {
+		expr           string
+		aws            string
+		cloudScheduler string
+		azure          string
+	}{
+		{expr: "30 2 * * MON-FRI", aws: "cron(30 2 ? * MON,TUE,WED,THU,FRI *)", cloudScheduler: "30 2 * * 1,2,3,4,5", azure: "0 30 2 * * 1,2,3,4,5"},
+		{expr: "*/15 * * * *", aws: "cron(0/15 * * * ? *)", cloudScheduler: "*/15 * * * *", azure: "0 */15 * * * *"},
+		{expr: "5/20 */6 * * *", aws: "cron(5/20 0/6 * * ? *)", cloudScheduler: "5-59/20 */6 * * *", azure: "0 5-59/20 */6 * * *"},
+		{expr: "0 0 1 JAN *", aws: "cron(0 0 1 JAN ? *)", cloudScheduler: "0 0 1 1 *", azure: "0 0 0 1 1 *"},
+		{expr: "0 0 * * 7", aws: "cron(0 0 ? * SUN *)", cloudScheduler: "0 0 * * 0", azure: "0 0 0 * * 0"},
+		{expr: "0 0 * * 0-7", aws: "cron(0 0 * * ? *)", cloudScheduler: "0 0 * * *", azure: "0 0 0 * * *"},
+		{expr: "@daily", aws: "cron(0 0 * * ? *)", cloudScheduler: "0 0 * * *", azure: "0 0 0 * * *"},
+		{expr: "0 0 1-31 * MON", aws: "cron(0 0 * * ? *)", cloudScheduler: "0 0 * * *", azure: "0 0 0 * * *"},
+		{expr: "0 0 13 * 0-6", aws: "cron(0 0 * * ? *)", cloudScheduler: "0 0 * * *", azure: "0 0 0 * * *"},
+		// AWS cannot express the day of month or day of week rule.
+		{expr: "0 0 13 * FRI", cloudScheduler: "0 0 13 * 5", azure: "0 0 0 13 * 5"},
+	}
+
+	for _, tt := range tests {
+		schedule, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) failed: %v", tt.expr, err)
+		}
+
+		aws, err := schedule.AWSExpression()
+		if tt.aws == "" {
+			if err == nil {
+				t.Errorf("AWSExpression of %q = %q, want an error", tt.expr, aws)
+			}
+		} else if err != nil {
+			t.Errorf("AWSExpression of %q failed: %v", tt.expr, err)
+		} else if aws != tt.aws {
+			t.Errorf("AWSExpression of %q = %q, want %q", tt.expr, aws, tt.aws)
+		}
+		if got := schedule.CloudSchedulerExpression(); got != tt.cloudScheduler {
+			t.Errorf("CloudSchedulerExpression of %q = %q, want %q", tt.expr, got, tt.cloudScheduler)
+		}
+		if got := schedule.AzureTimerExpression(); got != tt.azure {
+			t.Errorf("AzureTimerExpression of %q = %q, want %q", tt.expr, got, tt.azure)
+		}
+	}
+}
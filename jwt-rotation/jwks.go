@@ -0,0 +1,194 @@
+package secrets
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultJWKSMaxAge is the longest a JWKS may be cached.
+const DefaultJWKSMaxAge = time.Hour
+
+// JWKSContentType is the media type of a JSON Web Key Set.
+const JWKSContentType = "application/jwk-set+json"
+
+// a public key in the JSON Web Key format of RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// BuildJWKS returns the public keys of secrets, in the same order, for
+// consumers that validate tokens themselves. HMAC secrets have no public half
+// and are left out, and no private key material is ever included.
+func BuildJWKS(secrets []*Secret) (*JWKS, error) {
+	jwks := &JWKS{Keys: make([]JWK, 0, len(secrets))}
+	for _, secret := range secrets {
+		key, err := parseSigningKey(secret.Value)
+		if err != nil {
+			return nil, fmt.Errorf("secret %s: %w", secret.ID, err)
+		}
+		jwk, ok := publicJWK(secret.ID, key)
+		if ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	return jwks, nil
+}
+
+// returns the JWK of an asymmetric key, false for HMAC secrets.
+func publicJWK(kid string, key *signingKey) (JWK, bool) {
+	jwk := JWK{Use: "sig", Alg: key.method.Alg(), Kid: kid}
+	switch pub := key.verify.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encodeJWKField(pub.N.Bytes())
+		jwk.E = encodeJWKField(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = pub.Curve.Params().Name
+		jwk.X = encodeJWKField(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = encodeJWKField(pub.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = encodeJWKField(pub)
+	default:
+		return JWK{}, false
+	}
+	return jwk, true
+}
+
+func encodeJWKField(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// JWKS returns the public keys of the active, pending and grace-period secrets.
+func (rm *RotationManager) JWKS() (*JWKS, error) {
+	return BuildJWKS(rm.GetSecrets())
+}
+
+// JWKSMaxAge returns how long a JWKS fetched now may be cached: until the
+// next rotation is due, at most the policy's PropagationDelay so a pending key
+// is picked up before it is promoted, and at most DefaultJWKSMaxAge.
+func (rm *RotationManager) JWKSMaxAge() time.Duration {
+	maxAge := DefaultJWKSMaxAge
+	if delay := rm.policy.PropagationDelay; delay > 0 {
+		maxAge = min(maxAge, delay)
+	}
+	if next := rm.NextRotation(); !next.IsZero() {
+		maxAge = min(maxAge, time.Until(next))
+	}
+	return max(maxAge, 0)
+}
+
+// JWKSCacheControl returns the Cache-Control header value for a JWKS fetched now.
+func (rm *RotationManager) JWKSCacheControl() string {
+	seconds := int64(rm.JWKSMaxAge() / time.Second)
+	if seconds == 0 {
+		return "no-cache"
+	}
+	return "public, max-age=" + strconv.FormatInt(seconds, 10)
+}
+
+// a JWKS encoded for one keyring snapshot.
+type jwksResponse struct {
+	keyring *keyringSnapshot
+	body    []byte
+	etag    string
+	err     error
+}
+
+// serves the JWKS of a manager's keyring.
+type jwksHandler struct {
+	rm     *RotationManager
+	cached atomic.Pointer[jwksResponse]
+}
+
+// JWKSHandler returns an http.Handler serving the manager's JWKS. The body
+// is encoded once per keyring change, and Cache-Control follows
+// JWKSCacheControl, so consumers refetch around rotations. Requests with a
+// matching If-None-Match are answered with 304 Not Modified. A keyring whose
+// JWKS cannot be built is reported to the manager's notifier once, and
+// requests are answered with 500 until the keyring changes.
+func (rm *RotationManager) JWKSHandler() http.Handler {
+	return &jwksHandler{rm: rm}
+}
+
+func (h *jwksHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := h.response(r.Context())
+	if response.err != nil {
+		http.Error(w, "failed to build JWKS", http.StatusInternalServerError)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", JWKSContentType)
+	header.Set("Cache-Control", h.rm.JWKSCacheControl())
+	header.Set("ETag", response.etag)
+	if r.Header.Get("If-None-Match") == response.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	header.Set("Content-Length", strconv.Itoa(len(response.body)))
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(response.body)
+}
+
+// returns the encoded JWKS of the current keyring snapshot, reporting a
+// failure to encode it when it is first cached.
+func (h *jwksHandler) response(ctx context.Context) *jwksResponse {
+	keyring := h.rm.keyring()
+	cached := h.cached.Load()
+	if cached != nil && cached.keyring == keyring {
+		return cached
+	}
+
+	response := &jwksResponse{keyring: keyring}
+	jwks, err := BuildJWKS(keyring.secrets)
+	if err == nil {
+		response.body, err = json.Marshal(jwks)
+	}
+	if err != nil {
+		response.err = err
+	} else {
+		sum := sha256.Sum256(response.body)
+		response.etag = `"` + hex.EncodeToString(sum[:16]) + `"`
+	}
+	if h.cached.CompareAndSwap(cached, response) && response.err != nil {
+		h.rm.notifyError(ctx, fmt.Errorf("failed to build JWKS: %w", response.err))
+	}
+	return response
+}
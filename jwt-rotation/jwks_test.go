@@ -0,0 +1,64 @@
+package secrets
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// records the notifications a manager sends.
+type recordingNotifier struct {
+	mutex     sync.Mutex
+	errors    []error
+	rollbacks []*Rollback
+}
+
+func (n *recordingNotifier) NotifyRotation(ctx context.Context, secret *Secret) {}
+
+func (n *recordingNotifier) NotifyError(ctx context.Context, err error) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.errors = append(n.errors, err)
+}
+
+func (n *recordingNotifier) NotifyRevocation(ctx context.Context, revocation *Revocation) {}
+
+func (n *recordingNotifier) NotifyRollback(ctx context.Context, rollback *Rollback) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	n.rollbacks = append(n.rollbacks, rollback)
+}
+
+func TestJWKSHandlerReportsBuildErrorsOnce(t *testing.T) {
+	// A PKCS#8 key BuildJWKS cannot publish.
+	key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notifier := &recordingNotifier{}
+	rm := &RotationManager{notifier: notifier}
+	rm.snapshot.Store(&keyringSnapshot{secrets: []*Secret{{ID: "unusable", Value: value}}})
+	handler := rm.JWKSHandler()
+
+	for i := 0; i < 3; i++ {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+		if recorder.Code != http.StatusInternalServerError {
+			t.Fatalf("status = %d, want %d", recorder.Code, http.StatusInternalServerError)
+		}
+	}
+	if len(notifier.errors) != 1 {
+		t.Errorf("notified %d errors for one keyring, want 1: %v", len(notifier.errors), notifier.errors)
+	}
+}
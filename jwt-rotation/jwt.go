@@ -1,84 +1,135 @@
 package secrets
 
 import (
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"sync/atomic"
 
 	"token-toolkit/jwt-rotation/storage"
 
-	"github.com/golang-jwt/jwt"
+	"github.com/golang-jwt/jwt/v5"
 )
 
+// TokenValidator is implemented by JWTManager and by the remote JWKS verifier
+// in the verifier package, so services can switch between validating against
+// a local keyring and a published JWKS.
+type TokenValidator interface {
+	ValidateToken(tokenString string) (*jwt.Token, error)
+}
+
+var _ TokenValidator = (*JWTManager)(nil)
+
 // handles JWT-specific operations on top of a generic secret rotator.
 type JWTManager struct {
 	*RotationManager
+	// run after every rotation, guarded by the rotation manager's mutex.
+	canaries []Canary
+	// enforces the validation policy, nil until one is set.
+	parser atomic.Pointer[TokenParser]
 }
 
-// creates a new manager for JWT secrets.
-func NewJWTManager(policy RotationPolicy, secretSizeBytes int, store storage.SecretStorage, notifier Notifier) (*JWTManager, error) {
+// creates a new manager for JWT secrets signed with HS256.
+func NewJWTManager(ctx context.Context, policy RotationPolicy, secretSizeBytes int, store storage.SecretStorage, notifier Notifier) (*JWTManager, error) {
 	generator, err := NewRandomSecretGenerator(secretSizeBytes)
 	if err != nil {
 		return nil, fmt.Errorf("could not create secret generator: %w", err)
 	}
+	return NewJWTManagerWithGenerator(ctx, policy, generator, store, notifier)
+}
 
-	rotator, err := NewRotationManager(policy, store, generator, notifier)
+// creates a new manager for JWT secrets made by generator, e.g. an
+// RSAKeyGenerator for RS256. Tokens are signed with the algorithm of the
+// active secret's key, and each kid only validates tokens of its own algorithm.
+func NewJWTManagerWithGenerator(ctx context.Context, policy RotationPolicy, generator SecretGenerator, store storage.SecretStorage, notifier Notifier) (*JWTManager, error) {
+	rotator, err := NewRotationManager(ctx, policy, store, generator, notifier)
 	if err != nil {
 		return nil, fmt.Errorf("could not create rotation manager: %w", err)
 	}
 
-	return &JWTManager{RotationManager: rotator}, nil
+	jm := &JWTManager{RotationManager: rotator}
+	// Automatic rotations run the canaries too.
+	rotator.autoRotate = jm.RotateSecret
+	return jm, nil
 }
 
 // signs a set of claims with the active secret.
 func (jm *JWTManager) SignToken(claims jwt.Claims) (string, error) {
-	jm.mutex.RLock()
-	activeSecret := jm.activeSecret
-	jm.mutex.RUnlock()
+	if jm.verifyOnly {
+		return "", ErrVerifyOnly
+	}
 
-	if activeSecret == nil {
+	keyring := jm.keyring()
+	if keyring.active == nil {
 		return "", errors.New("no active secret available to sign token")
 	}
+	if keyring.signing == nil {
+		return "", fmt.Errorf("active secret %s has no usable signing key", keyring.active.ID)
+	}
+	return signToken(keyring.signing, keyring.active.ID, claims)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	token.Header["kid"] = activeSecret.ID
+// signs a set of claims with a given secret, e.g. to test a pending secret
+// before it becomes active.
+func SignTokenWithSecret(secret *Secret, claims jwt.Claims) (string, error) {
+	key, err := parseSigningKey(secret.Value)
+	if err != nil {
+		return "", fmt.Errorf("secret %s has no usable signing key: %w", secret.ID, err)
+	}
+	return signToken(key, secret.ID, claims)
+}
 
-	return token.SignedString(activeSecret.Value)
+func signToken(key *signingKey, kid string, claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = kid
+	return token.SignedString(key.sign)
+}
+
+// sets the claims ValidateToken requires from now on, e.g. the issuer and
+// audience, so every service using the manager enforces the same rules.
+func (jm *JWTManager) SetValidationPolicy(policy ValidationPolicy) error {
+	parser, err := NewTokenParser(policy)
+	if err != nil {
+		return fmt.Errorf("invalid validation policy: %w", err)
+	}
+	jm.parser.Store(parser)
+	return nil
 }
 
 // ValidateToken parses and validates a JWT token string.
-// It will try the active secret first, then any previous secrets within their grace period.
+// The key is looked up by the token's kid among the active, pending and
+// previous secrets, in the keyring snapshot current when the token is checked.
+// The claims are then checked against the validation policy.
 func (jm *JWTManager) ValidateToken(tokenString string) (*jwt.Token, error) {
-	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-
-		jm.mutex.RLock()
-		defer jm.mutex.RUnlock()
-
-		kid, ok := token.Header["kid"].(string)
-		if ok {
-			// Find the secret by key ID
-			for _, secret := range jm.GetSecrets() {
-				if secret.ID == kid {
-					return secret.Value, nil
-				}
-			}
-		}
+	parser := jm.parser.Load()
+	if parser == nil {
+		parser = defaultTokenParser
+	}
+	return parser.Parse(tokenString, jm.keyFunc)
+}
 
+// returns the key for a token's kid without taking the lock or allocating.
+// The token must use the algorithm of that key, so a public key can never be
+// used as an HMAC secret.
+func (jm *JWTManager) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := jm.keyring().key(kid)
+	if !ok {
 		return nil, fmt.Errorf("token validation failed: secret with kid '%s' not found", kid)
-	})
+	}
+	if token.Method != key.method {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.verify, nil
 }
 
 // returns the active secret value as a hex-encoded string.
 func (jm *JWTManager) ExportActiveSecretHex() string {
-	jm.mutex.RLock()
-	defer jm.mutex.RUnlock()
-
-	if jm.activeSecret == nil {
+	activeSecret := jm.keyring().active
+	if activeSecret == nil {
 		return ""
 	}
 
-	return hex.EncodeToString(jm.activeSecret.Value)
+	return hex.EncodeToString(activeSecret.Value)
 }
@@ -0,0 +1,70 @@
+package secrets
+
+// an immutable copy of the keyring, published after every change so that
+// token signing and validation never take the manager's lock.
+type keyringSnapshot struct {
+	// the active secret, a pending secret, then previous secrets, as GetSecrets returns them.
+	secrets []*Secret
+	active  *Secret
+	// the parsed key of the active secret, nil if it cannot sign.
+	signing *signingKey
+	// maps each kid to its parsed key. Keys are already converted to an
+	// interface, so handing them to the JWT library does not allocate.
+	keys map[string]*signingKey
+}
+
+// served until the first keyring is published.
+var emptyKeyring = &keyringSnapshot{}
+
+// returns the key for kid.
+func (k *keyringSnapshot) key(kid string) (*signingKey, bool) {
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+// returns the keyring published last.
+func (rm *RotationManager) keyring() *keyringSnapshot {
+	if snapshot := rm.snapshot.Load(); snapshot != nil {
+		return snapshot
+	}
+	return emptyKeyring
+}
+
+// publishes a copy of the active, pending and previous secrets for lock-free
+// readers. The copies keep readers safe from the flag updates writers make
+// in place. Keys are parsed once per kid and carried over from the previous
+// snapshot. buildKeyring rejects stored secrets whose key cannot be parsed
+// and generators only make parseable keys, so such a secret is only left out
+// of the keys as a safeguard. The caller must hold the write lock.
+func (rm *RotationManager) publishKeyring() {
+	previous := rm.keyring()
+	snapshot := &keyringSnapshot{
+		secrets: make([]*Secret, 0, len(rm.previousSecrets)+2),
+		keys:    make(map[string]*signingKey, len(rm.previousSecrets)+2),
+	}
+	add := func(secret *Secret) *Secret {
+		copied := *secret
+		snapshot.secrets = append(snapshot.secrets, &copied)
+		key, ok := previous.key(copied.ID)
+		if !ok {
+			var err error
+			if key, err = parseSigningKey(copied.Value); err != nil {
+				return &copied
+			}
+		}
+		snapshot.keys[copied.ID] = key
+		return &copied
+	}
+
+	if rm.activeSecret != nil {
+		snapshot.active = add(rm.activeSecret)
+		snapshot.signing = snapshot.keys[snapshot.active.ID]
+	}
+	if rm.pendingSecret != nil {
+		add(rm.pendingSecret)
+	}
+	for _, secret := range rm.previousSecrets {
+		add(secret)
+	}
+	rm.snapshot.Store(snapshot)
+}
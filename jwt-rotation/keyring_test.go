@@ -0,0 +1,88 @@
+package secrets
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"token-toolkit/jwt-rotation/storage"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// returns a manager for alg whose keyring holds an active and three previous
+// secrets, and a token signed by the oldest of them.
+func newBenchmarkManager(tb testing.TB, alg string) (*JWTManager, string) {
+	tb.Helper()
+	ctx := context.Background()
+	generator, err := NewKeyGenerator(alg)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	jm, err := NewJWTManagerWithGenerator(ctx, RotationPolicy{GracePeriod: time.Hour}, generator, storage.NewMemoryStorage(), nil)
+	if err != nil {
+		tb.Fatalf("NewJWTManagerWithGenerator failed: %v", err)
+	}
+
+	claims := jwt.RegisteredClaims{Subject: "benchmark", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+	token, err := jm.SignToken(claims)
+	if err != nil {
+		tb.Fatalf("SignToken failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := jm.RotateSecret(ctx); err != nil {
+			tb.Fatalf("RotateSecret failed: %v", err)
+		}
+	}
+	return jm, token
+}
+
+func BenchmarkValidateToken(b *testing.B) {
+	for _, alg := range []string{AlgHS256, AlgRS256, AlgES256, AlgEdDSA} {
+		b.Run(alg, func(b *testing.B) {
+			jm, token := newBenchmarkManager(b, alg)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := jm.ValidateToken(token); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkKeyFunc(b *testing.B) {
+	jm, signed := newBenchmarkManager(b, AlgHS256)
+	token, _, err := jwt.NewParser().ParseUnverified(signed, jwt.MapClaims{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := jm.keyFunc(token); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestKeyFuncDoesNotAllocate(t *testing.T) {
+	for _, alg := range []string{AlgHS256, AlgES256, AlgEdDSA} {
+		t.Run(alg, func(t *testing.T) {
+			jm, signed := newBenchmarkManager(t, alg)
+			token, _, err := jwt.NewParser().ParseUnverified(signed, jwt.MapClaims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			allocs := testing.AllocsPerRun(100, func() {
+				if _, err := jm.keyFunc(token); err != nil {
+					t.Fatal(err)
+				}
+			})
+			if allocs != 0 {
+				t.Errorf("keyFunc allocates %v times per lookup, want 0", allocs)
+			}
+		})
+	}
+}
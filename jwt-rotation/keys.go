@@ -0,0 +1,173 @@
+package secrets
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// the signing algorithms NewKeyGenerator accepts.
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+	AlgES384 = "ES384"
+	AlgEdDSA = "EdDSA"
+)
+
+// DefaultHMACSecretSize is the size of the HS256 secrets NewKeyGenerator creates.
+const DefaultHMACSecretSize = 64
+
+// NewKeyGenerator returns a generator for keys of the JWT signing algorithm
+// alg, one of HS256, RS256, ES256, ES384 and EdDSA. An empty alg means HS256.
+func NewKeyGenerator(alg string) (SecretGenerator, error) {
+	switch alg {
+	case "", AlgHS256:
+		return NewRandomSecretGenerator(DefaultHMACSecretSize)
+	case AlgRS256:
+		return NewRSAKeyGenerator(2048)
+	case AlgES256:
+		return NewECDSAKeyGenerator(elliptic.P256())
+	case AlgES384:
+		return NewECDSAKeyGenerator(elliptic.P384())
+	case AlgEdDSA:
+		return NewEd25519KeyGenerator(), nil
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q, use %s, %s, %s, %s or %s", alg, AlgHS256, AlgRS256, AlgES256, AlgES384, AlgEdDSA)
+	}
+}
+
+// KeyGeneratorFromEnv returns the generator for the signing algorithm in the
+// JWT_ALGORITHM environment variable, which the deploy scripts set on the
+// functions. HS256 is used when it is unset.
+func KeyGeneratorFromEnv() (SecretGenerator, error) {
+	generator, err := NewKeyGenerator(os.Getenv("JWT_ALGORITHM"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT_ALGORITHM: %w", err)
+	}
+	return generator, nil
+}
+
+// generates RSA private keys for RS256, encoded as PKCS#8.
+type RSAKeyGenerator struct {
+	bits int
+}
+
+// creates a new RSAKeyGenerator.
+func NewRSAKeyGenerator(bits int) (*RSAKeyGenerator, error) {
+	if bits < 2048 {
+		return nil, errors.New("RSA keys must have at least 2048 bits")
+	}
+	return &RSAKeyGenerator{bits: bits}, nil
+}
+
+// Generate creates a new RSA private key.
+func (g *RSAKeyGenerator) Generate() (SecretValue, error) {
+	key, err := rsa.GenerateKey(rand.Reader, g.bits)
+	if err != nil {
+		return nil, fmt.Errorf("error generating RSA key: %w", err)
+	}
+	return marshalPrivateKey(key)
+}
+
+// generates ECDSA private keys for ES256 or ES384, encoded as PKCS#8.
+type ECDSAKeyGenerator struct {
+	curve elliptic.Curve
+}
+
+// creates a new ECDSAKeyGenerator for the P-256 or P-384 curve.
+func NewECDSAKeyGenerator(curve elliptic.Curve) (*ECDSAKeyGenerator, error) {
+	if curve != elliptic.P256() && curve != elliptic.P384() {
+		return nil, errors.New("ECDSA keys must use the P-256 or P-384 curve")
+	}
+	return &ECDSAKeyGenerator{curve: curve}, nil
+}
+
+// Generate creates a new ECDSA private key.
+func (g *ECDSAKeyGenerator) Generate() (SecretValue, error) {
+	key, err := ecdsa.GenerateKey(g.curve, rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating ECDSA key: %w", err)
+	}
+	return marshalPrivateKey(key)
+}
+
+// generates Ed25519 private keys for EdDSA, encoded as PKCS#8.
+type Ed25519KeyGenerator struct{}
+
+// creates a new Ed25519KeyGenerator.
+func NewEd25519KeyGenerator() *Ed25519KeyGenerator {
+	return &Ed25519KeyGenerator{}
+}
+
+// Generate creates a new Ed25519 private key.
+func (g *Ed25519KeyGenerator) Generate() (SecretValue, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error generating Ed25519 key: %w", err)
+	}
+	return marshalPrivateKey(key)
+}
+
+func marshalPrivateKey(key any) (SecretValue, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding private key: %w", err)
+	}
+	return der, nil
+}
+
+// a secret parsed for signing and validating tokens.
+type signingKey struct {
+	method jwt.SigningMethod
+	// the private key, or the HMAC secret as a []byte.
+	sign any
+	// the public key, or the HMAC secret as a []byte.
+	verify any
+}
+
+// parses a secret value into its signing method and keys. Values holding a
+// PKCS#8 private key sign with the key's algorithm, any other value is an
+// HMAC secret for HS256.
+func parseSigningKey(value SecretValue) (*signingKey, error) {
+	key, err := x509.ParsePKCS8PrivateKey(value)
+	if err != nil {
+		// The HMAC signing method only accepts a plain []byte key.
+		hmacKey := []byte(value)
+		return &signingKey{method: jwt.SigningMethodHS256, sign: hmacKey, verify: hmacKey}, nil
+	}
+
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return &signingKey{method: jwt.SigningMethodRS256, sign: k, verify: &k.PublicKey}, nil
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return &signingKey{method: jwt.SigningMethodES256, sign: k, verify: &k.PublicKey}, nil
+		case elliptic.P384():
+			return &signingKey{method: jwt.SigningMethodES384, sign: k, verify: &k.PublicKey}, nil
+		}
+		return nil, fmt.Errorf("unsupported ECDSA curve %s", k.Curve.Params().Name)
+	case ed25519.PrivateKey:
+		return &signingKey{method: jwt.SigningMethodEdDSA, sign: k, verify: k.Public()}, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+}
+
+// returns the JWT signing algorithm of a secret, e.g. "RS256".
+func SigningAlgorithm(secret *Secret) (string, error) {
+	key, err := parseSigningKey(secret.Value)
+	if err != nil {
+		return "", err
+	}
+	return key.method.Alg(), nil
+}
@@ -0,0 +1,60 @@
+package secrets
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"token-toolkit/jwt-rotation/storage"
+)
+
+// DefaultLeaseTTL is used when a policy does not set LeaseTTL.
+const DefaultLeaseTTL = time.Minute
+
+// the lease taken around every change to the keyring in storage.
+const rotationLeaseName = "rotation"
+
+// identifies this process as a lease holder, e.g. "web-1:4242:9f86d081".
+func newLeaseHolder() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s:%d:%s", host, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// takes the rotation lease when the storage backend supports leases, so that
+// rotators in other processes wait their turn instead of racing this one. The
+// returned function gives the lease up again; a lease that could not be given
+// up expires after the policy's LeaseTTL. Backends without leases are not
+// locked and the returned function does nothing.
+func (rm *RotationManager) acquireLease(ctx context.Context) (func(), error) {
+	leaser, ok := rm.storage.(storage.Leaser)
+	if !ok {
+		return func() {}, nil
+	}
+
+	ttl := rm.policy.LeaseTTL
+	if ttl <= 0 {
+		ttl = DefaultLeaseTTL
+	}
+	storageCtx, cancel := rm.storageContext(ctx)
+	defer cancel()
+	if _, err := leaser.AcquireLease(storageCtx, rotationLeaseName, rm.leaseHolder, ttl); err != nil {
+		return nil, fmt.Errorf("failed to acquire rotation lease: %w", err)
+	}
+
+	return func() {
+		// Release even when the rotation was cancelled, so others need not wait for the lease to expire.
+		releaseCtx, cancel := rm.storageContext(context.WithoutCancel(ctx))
+		defer cancel()
+		if err := leaser.ReleaseLease(releaseCtx, rotationLeaseName, rm.leaseHolder); err != nil {
+			fmt.Printf("Error releasing rotation lease: %v\n", err)
+		}
+	}, nil
+}
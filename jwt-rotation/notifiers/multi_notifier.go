@@ -1,6 +1,10 @@
 package notifiers
 
-import secrets "token-toolkit/jwt-rotation"
+import (
+	"context"
+
+	secrets "token-toolkit/jwt-rotation"
+)
 
 // broadcasts notifications to multiple notifiers.
 type MultiNotifier struct {
@@ -13,19 +17,37 @@ func NewMultiNotifier(notifiers ...secrets.Notifier) *MultiNotifier {
 }
 
 // sends a rotation notification to all configured notifiers.
-func (m *MultiNotifier) NotifyRotation(secret *secrets.Secret) {
+func (m *MultiNotifier) NotifyRotation(ctx context.Context, secret *secrets.Secret) {
 	for _, n := range m.notifiers {
 		if n != nil {
-			n.NotifyRotation(secret)
+			n.NotifyRotation(ctx, secret)
 		}
 	}
 }
 
 // sends an error notification to all configured notifiers.
-func (m *MultiNotifier) NotifyError(err error) {
+func (m *MultiNotifier) NotifyError(ctx context.Context, err error) {
+	for _, n := range m.notifiers {
+		if n != nil {
+			n.NotifyError(ctx, err)
+		}
+	}
+}
+
+// sends a revocation notification to all configured notifiers.
+func (m *MultiNotifier) NotifyRevocation(ctx context.Context, revocation *secrets.Revocation) {
+	for _, n := range m.notifiers {
+		if n != nil {
+			n.NotifyRevocation(ctx, revocation)
+		}
+	}
+}
+
+// sends a rollback notification to all configured notifiers.
+func (m *MultiNotifier) NotifyRollback(ctx context.Context, rollback *secrets.Rollback) {
 	for _, n := range m.notifiers {
 		if n != nil {
-			n.NotifyError(err)
+			n.NotifyRollback(ctx, rollback)
 		}
 	}
 }
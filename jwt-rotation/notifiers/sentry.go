@@ -1,6 +1,7 @@
 package notifiers
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
@@ -36,21 +37,60 @@ func NewSentryNotifier() (*SentryNotifier, error) {
 }
 
 // sends a notification about a successful secret rotation.
-func (s *SentryNotifier) NotifyRotation(secret *secrets.Secret) {
+func (s *SentryNotifier) NotifyRotation(ctx context.Context, secret *secrets.Secret) {
 	if s.client == nil {
 		return
 	}
 	sentry.CaptureMessage(fmt.Sprintf("JWT Secret rotated successfully: %s", secret.ID))
 	log.Println("Notification sent to Sentry for successful rotation.")
-	sentry.Flush(2 * time.Second)
+	flush(ctx)
 }
 
 // sends a notification about an error during secret rotation.
-func (s *SentryNotifier) NotifyError(err error) {
+func (s *SentryNotifier) NotifyError(ctx context.Context, err error) {
 	if s.client == nil {
 		return
 	}
 	sentry.CaptureException(err)
 	log.Printf("Error notification sent to Sentry: %v\n", err)
-	sentry.Flush(2 * time.Second)
+	flush(ctx)
+}
+
+// reports a revocation as a fatal event, so it pages whoever is on call.
+func (s *SentryNotifier) NotifyRevocation(ctx context.Context, revocation *secrets.Revocation) {
+	if s.client == nil {
+		return
+	}
+	sentry.WithScope(func(scope *sentry.Scope) {
+		scope.SetLevel(sentry.LevelFatal)
+		scope.SetTag("kid", revocation.ID)
+		if revocation.Replacement != nil {
+			scope.SetTag("replacement_kid", revocation.Replacement.ID)
+		}
+		sentry.CaptureMessage(fmt.Sprintf("JWT Secret revoked: %s (%s)", revocation.ID, revocation.Reason))
+	})
+	log.Printf("Revocation of %s sent to Sentry.\n", revocation.ID)
+	flush(ctx)
+}
+
+// reports a rollback as a warning with both kids as tags.
+func (s *SentryNotifier) NotifyRollback(ctx context.Context, rollback *secrets.Rollback) {
+	if s.client == nil {
+		return
+	}
+	sentry.WithScope(func(scope *sentry.Scope) {
+		scope.SetLevel(sentry.LevelWarning)
+		scope.SetTag("kid", rollback.Restored.ID)
+		scope.SetTag("faulty_kid", rollback.Faulty.ID)
+		sentry.CaptureMessage(fmt.Sprintf("JWT Secret rolled back from %s to %s: %s", rollback.Faulty.ID, rollback.Restored.ID, rollback.Reason))
+	})
+	log.Printf("Rollback to %s sent to Sentry.\n", rollback.Restored.ID)
+	flush(ctx)
+}
+
+// waits for queued events to be sent, at most two seconds or until the context is done.
+func flush(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+	sentry.FlushWithContext(ctx)
 }
@@ -1,6 +1,7 @@
 package notifiers
 
 import (
+	"context"
 	"fmt"
 	"os"
 
@@ -30,7 +31,7 @@ func NewSlackNotifier() (*SlackNotifier, error) {
 }
 
 // sends a notification about a successful secret rotation.
-func (s *SlackNotifier) NotifyRotation(secret *secrets.Secret) {
+func (s *SlackNotifier) NotifyRotation(ctx context.Context, secret *secrets.Secret) {
 	if s.client == nil {
 		return
 	}
@@ -48,7 +49,8 @@ func (s *SlackNotifier) NotifyRotation(secret *secrets.Secret) {
 		},
 	}
 
-	_, _, err := s.client.PostMessage(
+	_, _, err := s.client.PostMessageContext(
+		ctx,
 		s.channelID,
 		slack.MsgOptionAttachments(attachment),
 		slack.MsgOptionAsUser(true), // Or false depending on how you want the message to appear
@@ -60,7 +62,7 @@ func (s *SlackNotifier) NotifyRotation(secret *secrets.Secret) {
 }
 
 // sends a notification about an error during secret rotation.
-func (s *SlackNotifier) NotifyError(err error) {
+func (s *SlackNotifier) NotifyError(ctx context.Context, err error) {
 	if s.client == nil {
 		return
 	}
@@ -72,7 +74,8 @@ func (s *SlackNotifier) NotifyError(err error) {
 		Text:    fmt.Sprintf("```%v```", err),
 	}
 
-	_, _, postErr := s.client.PostMessage(
+	_, _, postErr := s.client.PostMessageContext(
+		ctx,
 		s.channelID,
 		slack.MsgOptionAttachments(attachment),
 		slack.MsgOptionAsUser(true),
@@ -82,3 +85,104 @@ func (s *SlackNotifier) NotifyError(err error) {
 		fmt.Printf("Error sending Slack error notification: %v\n", postErr)
 	}
 }
+
+// sends an alert about an emergency revocation, mentioning the whole channel.
+func (s *SlackNotifier) NotifyRevocation(ctx context.Context, revocation *secrets.Revocation) {
+	if s.client == nil {
+		return
+	}
+
+	reason := revocation.Reason
+	if reason == "" {
+		reason = "not given"
+	}
+	replacement := "none, the revoked secret was not signing"
+	if revocation.Replacement != nil {
+		replacement = fmt.Sprintf("`%s`", revocation.Replacement.ID)
+	}
+
+	attachment := slack.Attachment{
+		Pretext: "<!channel> Secret Revoked",
+		Color:   "#d9534f", // red
+		Title:   "JWT Secret Revoked",
+		Text:    "Tokens signed with this secret are no longer accepted.",
+		Fields: []slack.AttachmentField{
+			{
+				Title: "Revoked Secret ID",
+				Value: fmt.Sprintf("`%s`", revocation.ID),
+				Short: true,
+			},
+			{
+				Title: "New Secret ID",
+				Value: replacement,
+				Short: true,
+			},
+			{
+				Title: "Reason",
+				Value: reason,
+				Short: false,
+			},
+		},
+	}
+
+	_, _, err := s.client.PostMessageContext(
+		ctx,
+		s.channelID,
+		slack.MsgOptionAttachments(attachment),
+		slack.MsgOptionAsUser(true),
+	)
+
+	if err != nil {
+		fmt.Printf("Error sending Slack revocation notification: %v\n", err)
+	}
+}
+
+// sends a notification about a rollback to the previous secret.
+func (s *SlackNotifier) NotifyRollback(ctx context.Context, rollback *secrets.Rollback) {
+	if s.client == nil {
+		return
+	}
+
+	reason := rollback.Reason
+	if reason == "" {
+		reason = "not given"
+	}
+	faulty := fmt.Sprintf("`%s`, still accepted for verification", rollback.Faulty.ID)
+	if rollback.Retired {
+		faulty = fmt.Sprintf("`%s`, retired", rollback.Faulty.ID)
+	}
+
+	attachment := slack.Attachment{
+		Pretext: "Secret Rollback",
+		Color:   "#f0ad4e", // orange
+		Title:   "JWT Secret Rolled Back",
+		Fields: []slack.AttachmentField{
+			{
+				Title: "Restored Secret ID",
+				Value: fmt.Sprintf("`%s`", rollback.Restored.ID),
+				Short: true,
+			},
+			{
+				Title: "Faulty Secret ID",
+				Value: faulty,
+				Short: true,
+			},
+			{
+				Title: "Reason",
+				Value: reason,
+				Short: false,
+			},
+		},
+	}
+
+	_, _, err := s.client.PostMessageContext(
+		ctx,
+		s.channelID,
+		slack.MsgOptionAttachments(attachment),
+		slack.MsgOptionAsUser(true),
+	)
+
+	if err != nil {
+		fmt.Printf("Error sending Slack rollback notification: %v\n", err)
+	}
+}
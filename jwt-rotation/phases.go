@@ -0,0 +1,221 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"token-toolkit/jwt-rotation/storage"
+)
+
+// describes how far a staged rotation has progressed.
+type RotationPhase string
+
+const (
+	// no pending secret is published.
+	PhaseIdle RotationPhase = "idle"
+	// a pending secret is published and verifiers are picking it up.
+	PhasePropagating RotationPhase = "propagating"
+	// the propagation delay has passed and the pending secret can be promoted.
+	PhaseReady RotationPhase = "ready"
+)
+
+var (
+	// ErrNoPendingSecret is returned when promoting without a published pending secret.
+	ErrNoPendingSecret = errors.New("no pending secret to promote")
+	// ErrPropagationPending is returned when promoting before the propagation delay has passed.
+	ErrPropagationPending = errors.New("pending secret is still propagating")
+)
+
+// Phase reports the stage of the current staged rotation.
+func (rm *RotationManager) Phase() RotationPhase {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	return rm.phase(time.Now())
+}
+
+// returns a copy of the published pending secret, or nil.
+func (rm *RotationManager) PendingSecret() *Secret {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	return rm.pendingSecret.clone()
+}
+
+// PublishPending generates a new secret and stores it as pending, so verifiers
+// accept it before anything is signed with it. If a pending secret is already
+// published, that secret is returned instead.
+func (rm *RotationManager) PublishPending(ctx context.Context) (*Secret, error) {
+	secret, err := rm.publishPending(ctx)
+	if err != nil {
+		rm.notifyError(ctx, err)
+		return nil, err
+	}
+	return secret, nil
+}
+
+// PromotePending makes the pending secret the signing secret once the
+// propagation delay has passed. The previously active secret becomes previous
+// and stays valid for the grace period.
+func (rm *RotationManager) PromotePending(ctx context.Context) (*Secret, error) {
+	secret, err := rm.promotePending(ctx)
+	if err != nil {
+		// Promoting too early is expected when steps run on a schedule.
+		if !errors.Is(err, ErrPropagationPending) && !errors.Is(err, ErrNoPendingSecret) {
+			rm.notifyError(ctx, err)
+		}
+		return nil, err
+	}
+
+	rm.notifyRotation(ctx, secret)
+	return secret, nil
+}
+
+// AdvanceRotation runs whichever step of a staged rotation is due: it publishes
+// a pending secret when the active one is due for rotation, and promotes the
+// pending secret once the propagation delay has passed. Every step is persisted
+// in storage, so it can be called repeatedly from a schedule or a fresh process.
+// It returns the phase reached.
+func (rm *RotationManager) AdvanceRotation(ctx context.Context) (RotationPhase, error) {
+	rm.mutex.Lock()
+	err := rm.reload(ctx)
+	phase := rm.phase(time.Now())
+	due := rm.rotationDue(time.Now())
+	rm.mutex.Unlock()
+	if err != nil {
+		rm.notifyError(ctx, err)
+		return "", err
+	}
+
+	if phase == PhaseIdle && due {
+		if _, err := rm.PublishPending(ctx); err != nil {
+			return phase, err
+		}
+		phase = rm.Phase()
+	}
+	if phase == PhaseReady {
+		if _, err := rm.PromotePending(ctx); err != nil {
+			return phase, err
+		}
+		phase = PhaseIdle
+	}
+	return phase, nil
+}
+
+func (rm *RotationManager) publishPending(ctx context.Context) (*Secret, error) {
+	if rm.verifyOnly {
+		return nil, ErrVerifyOnly
+	}
+	release, err := rm.acquireLease(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	if err := rm.reload(ctx); err != nil {
+		return nil, err
+	}
+	if rm.pendingSecret != nil {
+		return rm.pendingSecret.clone(), nil
+	}
+
+	secret, err := rm.generateAndStoreSecret(ctx, storage.StatePending)
+	if err != nil {
+		return nil, err
+	}
+	rm.pendingSecret = secret
+	rm.publishKeyring()
+	return secret.clone(), nil
+}
+
+func (rm *RotationManager) promotePending(ctx context.Context) (*Secret, error) {
+	if rm.verifyOnly {
+		return nil, ErrVerifyOnly
+	}
+	release, err := rm.acquireLease(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	if err := rm.reload(ctx); err != nil {
+		return nil, err
+	}
+	pending := rm.pendingSecret
+	if pending == nil {
+		return nil, ErrNoPendingSecret
+	}
+	if remaining := time.Until(rm.promotableAt()); remaining > 0 {
+		return nil, fmt.Errorf("%w, %s remaining", ErrPropagationPending, remaining.Round(time.Second))
+	}
+
+	storageCtx, cancel := rm.storageContext(ctx)
+	defer cancel()
+	if err := rm.storage.SetState(storageCtx, pending.ID, storage.StateActive); err != nil {
+		return nil, fmt.Errorf("failed to promote secret %s: %w", pending.ID, err)
+	}
+
+	rm.activate(pending)
+	return pending.clone(), nil
+}
+
+// rebuilds the keyring from storage, so each step resumes from whatever a
+// previous run persisted, and prunes the secrets it dropped for being past
+// their grace period. The caller must hold the write lock.
+func (rm *RotationManager) reload(ctx context.Context) error {
+	storageCtx, cancel := rm.storageContext(ctx)
+	defer cancel()
+
+	stored, err := rm.storage.GetAll(storageCtx)
+	if err != nil {
+		return fmt.Errorf("failed to load secrets: %w", err)
+	}
+	active, pending, previous, err := buildKeyring(stored, rm.policy.GracePeriod, time.Now())
+	if err != nil {
+		return err
+	}
+	if active == nil {
+		return errors.New("no active secret found in storage")
+	}
+
+	rm.activeSecret, rm.pendingSecret, rm.previousSecrets = active, pending, previous
+	rm.publishKeyring()
+	rm.pruneExpired(ctx, stored)
+	return nil
+}
+
+// the caller must hold the lock.
+func (rm *RotationManager) phase(now time.Time) RotationPhase {
+	switch {
+	case rm.pendingSecret == nil:
+		return PhaseIdle
+	case now.Before(rm.promotableAt()):
+		return PhasePropagating
+	default:
+		return PhaseReady
+	}
+}
+
+// returns when the pending secret may be promoted. The caller must hold the lock.
+func (rm *RotationManager) promotableAt() time.Time {
+	return rm.pendingSecret.CreatedAt.Add(rm.policy.PropagationDelay)
+}
+
+// reports whether a pending secret should be published now, so that it can be
+// promoted when the active secret reaches the rotation interval.
+// Without an interval every call is due. The caller must hold the lock.
+func (rm *RotationManager) rotationDue(now time.Time) bool {
+	if rm.policy.RotationInterval <= 0 || rm.activeSecret == nil {
+		return true
+	}
+	publishAt := rm.activeSecret.CreatedAt.Add(rm.policy.RotationInterval - rm.policy.PropagationDelay)
+	return !now.Before(publishAt)
+}
@@ -0,0 +1,151 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"token-toolkit/jwt-rotation/storage"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestStagedRotationHonoursPropagationDelay(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	policy := RotationPolicy{GracePeriod: time.Hour, PropagationDelay: 100 * time.Millisecond}
+	jm, err := NewJWTManager(ctx, policy, 32, store, nil)
+	if err != nil {
+		t.Fatalf("NewJWTManager failed: %v", err)
+	}
+	active := jm.keyring().active.ID
+
+	pending, err := jm.PublishPending(ctx)
+	if err != nil {
+		t.Fatalf("PublishPending failed: %v", err)
+	}
+	if phase := jm.Phase(); phase != PhasePropagating {
+		t.Errorf("phase after publishing = %s, want %s", phase, PhasePropagating)
+	}
+	if stored, err := store.Get(ctx, pending.ID); err != nil || stored.State != storage.StatePending {
+		t.Errorf("stored pending secret = %+v, %v; want state %s", stored, err, storage.StatePending)
+	}
+	if signing := jm.keyring().active.ID; signing != active {
+		t.Errorf("signing with %s after publishing, want %s until the promotion", signing, active)
+	}
+	// Verifiers accept the pending secret before it signs anything.
+	token, err := SignTokenWithSecret(pending, jwt.RegisteredClaims{Subject: "user"})
+	if err != nil {
+		t.Fatalf("SignTokenWithSecret failed: %v", err)
+	}
+	if _, err := jm.ValidateToken(token); err != nil {
+		t.Errorf("token signed with the pending secret does not validate: %v", err)
+	}
+
+	if _, err := jm.PromotePending(ctx); !errors.Is(err, ErrPropagationPending) {
+		t.Fatalf("PromotePending during the propagation delay: got %v, want ErrPropagationPending", err)
+	}
+	if phase, err := jm.AdvanceRotation(ctx); err != nil || phase != PhasePropagating {
+		t.Errorf("AdvanceRotation during the propagation delay = %s, %v; want %s", phase, err, PhasePropagating)
+	}
+	if again, err := jm.PublishPending(ctx); err != nil || again.ID != pending.ID {
+		t.Errorf("PublishPending with a published secret = %v, %v; want %s", again, err, pending.ID)
+	}
+
+	// Each step is persisted, so another process resumes the rotation.
+	resumed, err := NewJWTManager(ctx, policy, 32, store, nil)
+	if err != nil {
+		t.Fatalf("NewJWTManager failed: %v", err)
+	}
+	if got := resumed.PendingSecret(); got == nil || got.ID != pending.ID {
+		t.Fatalf("pending secret of a new manager = %v, want %s", got, pending.ID)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for resumed.Phase() != PhaseReady {
+		if time.Now().After(deadline) {
+			t.Fatal("pending secret never became ready to promote")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	promoted, err := resumed.PromotePending(ctx)
+	if err != nil {
+		t.Fatalf("PromotePending failed: %v", err)
+	}
+	if promoted.ID != pending.ID || resumed.keyring().active.ID != pending.ID || resumed.Phase() != PhaseIdle {
+		t.Errorf("after promoting, active = %s and phase %s, want %s and %s", resumed.keyring().active.ID, resumed.Phase(), pending.ID, PhaseIdle)
+	}
+	assertStoredStates(t, store, map[string]storage.SecretState{
+		pending.ID: storage.StateActive,
+		active:     storage.StatePrevious,
+	})
+	if _, err := resumed.PromotePending(ctx); !errors.Is(err, ErrNoPendingSecret) {
+		t.Errorf("PromotePending without a pending secret: got %v, want ErrNoPendingSecret", err)
+	}
+}
+
+func TestAdvanceRotationRunsDueSteps(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	jm, err := NewJWTManager(ctx, RotationPolicy{GracePeriod: time.Hour, RotationInterval: time.Hour}, 32, store, nil)
+	if err != nil {
+		t.Fatalf("NewJWTManager failed: %v", err)
+	}
+	active := jm.keyring().active.ID
+
+	// The active secret is not due for rotation yet.
+	if phase, err := jm.AdvanceRotation(ctx); err != nil || phase != PhaseIdle || jm.PendingSecret() != nil {
+		t.Fatalf("AdvanceRotation = %s, %v; want %s without publishing", phase, err, PhaseIdle)
+	}
+
+	// Without a propagation delay, publishing and promoting are due at once.
+	jm.policy.RotationInterval = 0
+	if phase, err := jm.AdvanceRotation(ctx); err != nil || phase != PhaseIdle {
+		t.Fatalf("AdvanceRotation = %s, %v; want %s", phase, err, PhaseIdle)
+	}
+	if jm.keyring().active.ID == active {
+		t.Fatal("AdvanceRotation did not rotate")
+	}
+	assertStoredStates(t, store, map[string]storage.SecretState{
+		jm.keyring().active.ID: storage.StateActive,
+		active:                 storage.StatePrevious,
+	})
+}
+
+func TestPendingSecretIsACopy(t *testing.T) {
+	ctx := context.Background()
+	jm, err := NewJWTManager(ctx, RotationPolicy{}, 32, storage.NewMemoryStorage(), nil)
+	if err != nil {
+		t.Fatalf("NewJWTManager failed: %v", err)
+	}
+	published, err := jm.PublishPending(ctx)
+	if err != nil {
+		t.Fatalf("PublishPending failed: %v", err)
+	}
+
+	// The manager changes its own secrets under the lock, callers must not share them.
+	published.Pending = false
+	pending := jm.PendingSecret()
+	if pending == nil || !pending.Pending {
+		t.Fatal("PublishPending returned the manager's own pending secret")
+	}
+	pending.Pending = false
+	if !jm.PendingSecret().Pending {
+		t.Error("PendingSecret returned the manager's own pending secret")
+	}
+}
+
+func assertStoredStates(t *testing.T, store storage.SecretStorage, want map[string]storage.SecretState) {
+	t.Helper()
+	for id, state := range want {
+		stored, err := store.Get(context.Background(), id)
+		if err != nil {
+			t.Errorf("Get(%s) failed: %v", id, err)
+			continue
+		}
+		if stored.State != state {
+			t.Errorf("stored state of %s = %q, want %q", id, stored.State, state)
+		}
+	}
+}
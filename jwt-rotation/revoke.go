@@ -0,0 +1,108 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"token-toolkit/jwt-rotation/storage"
+)
+
+// describes a secret that was revoked before its grace period ended.
+type Revocation struct {
+	ID        string    `json:"id"`
+	Reason    string    `json:"reason"`
+	RevokedAt time.Time `json:"revokedAt"`
+	// the secret that took over signing, nil if the revoked secret was not active.
+	Replacement *Secret `json:"replacement,omitempty"`
+}
+
+// Revoke immediately stops accepting tokens signed with the secret id, e.g.
+// because it leaked. An active secret is replaced by a freshly generated one
+// first, so signing never stops. The secret is then dropped from validation
+// and disabled or destroyed in storage, and a revocation notification is sent.
+// Other processes stop accepting the secret once they reload the keyring.
+// Like RotateSecret, it holds the rotation lease and starts from the keyring
+// in storage, so it never replaces a secret another process already rotated.
+func (rm *RotationManager) Revoke(ctx context.Context, id, reason string) (*Revocation, error) {
+	revocation, err := rm.revoke(ctx, id, reason)
+	if revocation != nil && revocation.Replacement != nil {
+		rm.notifyRotation(ctx, revocation.Replacement)
+	}
+	if err != nil {
+		rm.notifyError(ctx, err)
+		return nil, err
+	}
+
+	rm.notifyRevocation(ctx, revocation)
+	return revocation, nil
+}
+
+func (rm *RotationManager) revoke(ctx context.Context, id, reason string) (*Revocation, error) {
+	if rm.verifyOnly {
+		return nil, ErrVerifyOnly
+	}
+	if id == "" {
+		return nil, errors.New("no secret id to revoke")
+	}
+
+	release, err := rm.acquireLease(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	if err := rm.reload(ctx); err != nil {
+		return nil, err
+	}
+	revocation := &Revocation{ID: id, Reason: reason}
+	if rm.activeSecret != nil && rm.activeSecret.ID == id {
+		replacement, err := rm.generateAndStoreSecret(ctx, storage.StateActive)
+		if err != nil {
+			return nil, fmt.Errorf("failed to replace secret %s before revoking it: %w", id, err)
+		}
+		rm.activate(replacement)
+		revocation.Replacement = replacement
+	}
+
+	// Stop accepting the secret here even if storage fails below.
+	rm.dropSecret(id)
+
+	storageCtx, cancel := rm.storageContext(ctx)
+	defer cancel()
+	if err := rm.storage.Revoke(storageCtx, id); err != nil {
+		return revocation, fmt.Errorf("failed to revoke secret %s: %w", id, err)
+	}
+
+	revocation.RevokedAt = time.Now()
+	return revocation, nil
+}
+
+// removes a pending or previous secret from the keyring. The caller must hold the write lock.
+func (rm *RotationManager) dropSecret(id string) {
+	if rm.pendingSecret != nil && rm.pendingSecret.ID == id {
+		rm.pendingSecret = nil
+	}
+
+	kept := make([]*Secret, 0, len(rm.previousSecrets))
+	for _, secret := range rm.previousSecrets {
+		if secret.ID != id {
+			kept = append(kept, secret)
+		}
+	}
+	rm.previousSecrets = kept
+	rm.publishKeyring()
+}
+
+func (rm *RotationManager) notifyRevocation(ctx context.Context, revocation *Revocation) {
+	if rm.notifier == nil {
+		return
+	}
+	ctx, cancel := rm.notifyContext(ctx)
+	defer cancel()
+	rm.notifier.NotifyRevocation(ctx, revocation)
+}
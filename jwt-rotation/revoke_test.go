@@ -0,0 +1,82 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"token-toolkit/jwt-rotation/storage"
+	"token-toolkit/jwt-rotation/storage/storagetest"
+)
+
+func TestRevokeReloadsBeforeReplacing(t *testing.T) {
+	ctx := context.Background()
+	store := storagetest.NewFakeAWS(t)
+	generator, err := NewRandomSecretGenerator(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := RotationPolicy{GracePeriod: time.Hour}
+
+	stale, err := NewRotationManager(ctx, policy, store, generator, nil)
+	if err != nil {
+		t.Fatalf("NewRotationManager failed: %v", err)
+	}
+	other, err := NewRotationManager(ctx, policy, store, generator, nil)
+	if err != nil {
+		t.Fatalf("NewRotationManager failed: %v", err)
+	}
+	leaked := stale.activeSecret.ID
+	rotated, err := other.RotateSecret(ctx)
+	if err != nil {
+		t.Fatalf("RotateSecret failed: %v", err)
+	}
+
+	// The stale manager still signs with the leaked secret, which storage
+	// has already demoted, so it must be revoked without a replacement.
+	revocation, err := stale.Revoke(ctx, leaked, "leaked")
+	if err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if revocation.Replacement != nil {
+		t.Errorf("Revoke replaced the secret with %s, want the active %s kept", revocation.Replacement.ID, rotated.ID)
+	}
+	if got := stale.activeSecret.ID; got != rotated.ID {
+		t.Errorf("active secret after revoking = %s, want %s", got, rotated.ID)
+	}
+	latest, err := store.GetLatest(ctx)
+	if err != nil {
+		t.Fatalf("GetLatest failed: %v", err)
+	}
+	if latest.ID != rotated.ID {
+		t.Errorf("active secret in storage = %s, want %s", latest.ID, rotated.ID)
+	}
+	if _, err := store.Get(ctx, leaked); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Get of the revoked secret: got %v, want storage.ErrNotFound", err)
+	}
+}
+
+func TestRevokeWaitsForTheLease(t *testing.T) {
+	ctx := context.Background()
+	store := storagetest.NewFakeAWS(t)
+	generator, err := NewRandomSecretGenerator(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rm, err := NewRotationManager(ctx, RotationPolicy{}, store, generator, nil)
+	if err != nil {
+		t.Fatalf("NewRotationManager failed: %v", err)
+	}
+	active := rm.activeSecret.ID
+
+	if _, err := store.(storage.Leaser).AcquireLease(ctx, rotationLeaseName, "other", time.Minute); err != nil {
+		t.Fatalf("AcquireLease failed: %v", err)
+	}
+	if _, err := rm.Revoke(ctx, active, "leaked"); !errors.Is(err, storage.ErrLeaseHeld) {
+		t.Fatalf("Revoke while another process holds the lease: got %v, want storage.ErrLeaseHeld", err)
+	}
+	if rm.activeSecret.ID != active {
+		t.Errorf("Revoke replaced the active secret without the lease")
+	}
+}
@@ -0,0 +1,134 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"token-toolkit/jwt-rotation/storage"
+)
+
+// ErrNoPreviousSecret is returned when rolling back without a previous secret to restore.
+var ErrNoPreviousSecret = errors.New("no previous secret to roll back to")
+
+// describes a rollback to the previous signing secret.
+type Rollback struct {
+	Reason       string    `json:"reason"`
+	RolledBackAt time.Time `json:"rolledBackAt"`
+	// the previous secret that signs tokens again.
+	Restored *Secret `json:"restored"`
+	// the secret that was active before the rollback.
+	Faulty *Secret `json:"faulty"`
+	// reports whether the faulty secret was retired, i.e. revoked in storage
+	// instead of being kept to verify tokens it already signed. There is no
+	// separate retired state, this rollback is the record of why it went.
+	Retired bool `json:"retired"`
+}
+
+// returns a copy of the most recent previous secret, the one Rollback
+// restores, or nil.
+func (rm *RotationManager) PreviousSecret() *Secret {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+
+	if len(rm.previousSecrets) == 0 {
+		return nil
+	}
+	return rm.previousSecrets[0].clone()
+}
+
+// Rollback makes the most recent previous secret active again, e.g. when a
+// rotation broke a consumer that cached the old key. The faulty secret becomes
+// previous and keeps verifying the tokens it signed until its grace period
+// ends, or is retired when retire is set. Retiring means revoking: the faulty
+// secret is disabled or destroyed in storage as Revoke does, and tokens it
+// signed stop validating at once. The change is persisted and the reason is
+// passed on to the notifier, whose rollback notification is the audit trail
+// of a retired secret. Storage keeps no reason, so without a notifier the
+// rollback is logged instead.
+func (rm *RotationManager) Rollback(ctx context.Context, reason string, retire bool) (*Rollback, error) {
+	rollback, err := rm.rollback(ctx, reason, retire)
+	if err != nil {
+		rm.notifyError(ctx, err)
+		return nil, err
+	}
+
+	if rm.notifier == nil {
+		fmt.Printf("Warning: no notifier records this rollback: %s\n", rollback)
+	}
+	rm.notifyRollback(ctx, rollback)
+	return rollback, nil
+}
+
+// String describes the rollback with its reason, e.g. for logs.
+func (r *Rollback) String() string {
+	retired := "kept to verify tokens"
+	if r.Retired {
+		retired = "retired"
+	}
+	reason := r.Reason
+	if reason == "" {
+		reason = "none given"
+	}
+	return fmt.Sprintf("rolled back from secret %s to %s at %s, %s was %s, reason: %s",
+		r.Faulty.ID, r.Restored.ID, r.RolledBackAt.UTC().Format(time.RFC3339), r.Faulty.ID, retired, reason)
+}
+
+func (rm *RotationManager) rollback(ctx context.Context, reason string, retire bool) (*Rollback, error) {
+	if rm.verifyOnly {
+		return nil, ErrVerifyOnly
+	}
+	release, err := rm.acquireLease(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	if err := rm.reload(ctx); err != nil {
+		return nil, err
+	}
+	if len(rm.previousSecrets) == 0 {
+		return nil, ErrNoPreviousSecret
+	}
+	restored, faulty := rm.previousSecrets[0], rm.activeSecret
+
+	storageCtx, cancel := rm.storageContext(ctx)
+	defer cancel()
+	if err := rm.storage.SetState(storageCtx, restored.ID, storage.StateActive); err != nil {
+		return nil, fmt.Errorf("failed to restore secret %s: %w", restored.ID, err)
+	}
+
+	restored.Active = true
+	faulty.Active = false
+	rm.activeSecret = restored
+	rm.previousSecrets = append([]*Secret{faulty}, rm.previousSecrets[1:]...)
+	rm.publishKeyring()
+
+	if retire {
+		rm.dropSecret(faulty.ID)
+		if err := rm.storage.Revoke(storageCtx, faulty.ID); err != nil {
+			return nil, fmt.Errorf("rolled back to secret %s but failed to retire secret %s: %w", restored.ID, faulty.ID, err)
+		}
+	}
+
+	return &Rollback{
+		Reason:       reason,
+		RolledBackAt: time.Now(),
+		Restored:     restored.clone(),
+		Faulty:       faulty.clone(),
+		Retired:      retire,
+	}, nil
+}
+
+func (rm *RotationManager) notifyRollback(ctx context.Context, rollback *Rollback) {
+	if rm.notifier == nil {
+		return
+	}
+	ctx, cancel := rm.notifyContext(ctx)
+	defer cancel()
+	rm.notifier.NotifyRollback(ctx, rollback)
+}
@@ -0,0 +1,127 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"token-toolkit/jwt-rotation/storage"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRollback(t *testing.T) {
+	for _, retire := range []bool{false, true} {
+		name := "keep"
+		if retire {
+			name = "retire"
+		}
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := storage.NewMemoryStorage()
+			notifier := &recordingNotifier{}
+			jm, err := NewJWTManager(ctx, RotationPolicy{GracePeriod: time.Hour}, 32, store, notifier)
+			if err != nil {
+				t.Fatalf("NewJWTManager failed: %v", err)
+			}
+			sign := func() string {
+				t.Helper()
+				token, err := jm.SignToken(jwt.RegisteredClaims{Subject: "user"})
+				if err != nil {
+					t.Fatalf("SignToken failed: %v", err)
+				}
+				return token
+			}
+
+			restoredID := jm.GetSecrets()[0].ID
+			faulty, err := jm.RotateSecret(ctx)
+			if err != nil {
+				t.Fatalf("RotateSecret failed: %v", err)
+			}
+			faultyToken := sign()
+
+			rollback, err := jm.Rollback(ctx, "broke a consumer", retire)
+			if err != nil {
+				t.Fatalf("Rollback failed: %v", err)
+			}
+			if rollback.Restored.ID != restoredID || rollback.Faulty.ID != faulty.ID || rollback.Retired != retire {
+				t.Errorf("rollback = restored %s, faulty %s, retired %t; want %s, %s, %t",
+					rollback.Restored.ID, rollback.Faulty.ID, rollback.Retired, restoredID, faulty.ID, retire)
+			}
+			if active := jm.GetSecrets()[0]; active.ID != restoredID || !active.Active {
+				t.Errorf("active secret = %s, want %s", active.ID, restoredID)
+			}
+			if len(notifier.rollbacks) != 1 || notifier.rollbacks[0].Retired != retire || notifier.rollbacks[0].Reason != "broke a consumer" {
+				t.Errorf("rollback notifications = %+v, want one with retired %t and the reason", notifier.rollbacks, retire)
+			}
+
+			stored, err := store.Get(ctx, faulty.ID)
+			_, validateErr := jm.ValidateToken(faultyToken)
+			if retire {
+				// Retiring revokes: the secret is gone from storage and its tokens are rejected.
+				if !errors.Is(err, storage.ErrNotFound) {
+					t.Errorf("Get of the retired secret: got %v, want storage.ErrNotFound", err)
+				}
+				if validateErr == nil {
+					t.Error("token signed by the retired secret still validates")
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Get of the faulty secret failed: %v", err)
+				}
+				if stored.State != storage.StatePrevious {
+					t.Errorf("faulty secret state = %q, want %q", stored.State, storage.StatePrevious)
+				}
+				if validateErr != nil {
+					t.Errorf("token signed by the faulty secret no longer validates: %v", validateErr)
+				}
+			}
+
+			if _, err := jm.ValidateToken(sign()); err != nil {
+				t.Errorf("token signed after the rollback does not validate: %v", err)
+			}
+		})
+	}
+}
+
+func TestRollbackWithoutPreviousSecret(t *testing.T) {
+	ctx := context.Background()
+	jm, err := NewJWTManager(ctx, RotationPolicy{}, 32, storage.NewMemoryStorage(), nil)
+	if err != nil {
+		t.Fatalf("NewJWTManager failed: %v", err)
+	}
+	if _, err := jm.Rollback(ctx, "", false); !errors.Is(err, ErrNoPreviousSecret) {
+		t.Errorf("error = %v, want ErrNoPreviousSecret", err)
+	}
+}
+
+func TestPreviousSecretIsACopy(t *testing.T) {
+	ctx := context.Background()
+	jm, err := NewJWTManager(ctx, RotationPolicy{GracePeriod: time.Hour}, 32, storage.NewMemoryStorage(), nil)
+	if err != nil {
+		t.Fatalf("NewJWTManager failed: %v", err)
+	}
+	if _, err := jm.RotateSecret(ctx); err != nil {
+		t.Fatalf("RotateSecret failed: %v", err)
+	}
+
+	// The manager changes its own secrets under the lock, callers must not share them.
+	previous := jm.PreviousSecret()
+	previous.Active = true
+	if jm.PreviousSecret().Active {
+		t.Error("PreviousSecret returned the manager's own previous secret")
+	}
+
+	rollback, err := jm.Rollback(ctx, "broke a consumer", false)
+	if err != nil {
+		t.Fatalf("Rollback failed: %v", err)
+	}
+	if rollback.Restored.ID != previous.ID {
+		t.Errorf("restored = %s, want %s", rollback.Restored.ID, previous.ID)
+	}
+	if got := rollback.String(); !strings.Contains(got, "broke a consumer") {
+		t.Errorf("String() = %q, want the reason in it", got)
+	}
+}
@@ -2,8 +2,12 @@ package secrets
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"token-toolkit/jwt-rotation/storage"
@@ -12,62 +16,187 @@ import (
 // RotationManager provides a generic mechanism for rotating secrets.
 type RotationManager struct {
 	activeSecret    *Secret
+	pendingSecret   *Secret
 	previousSecrets []*Secret
-	policy          RotationPolicy
-	mutex           sync.RWMutex
-	autoRotate      bool
-	notifier        Notifier
-	storage         storage.SecretStorage
-	generator       SecretGenerator
+	// a copy of the three above for readers, replaced after every change.
+	snapshot atomic.Pointer[keyringSnapshot]
+	policy   RotationPolicy
+	// guards the fields above the snapshot and serializes writers.
+	mutex sync.RWMutex
+	// the running auto-rotation loop, nil when stopped.
+	auto *autoRotation
+	// closed when the last started loop has exited.
+	lastDone chan struct{}
+	// rotates on the loop's behalf, RotateSecret when nil.
+	autoRotate func(context.Context) (*Secret, error)
+	// the error of the last automatic rotation.
+	lastError error
+	notifier  Notifier
+	storage   storage.SecretStorage
+	generator SecretGenerator
+	// names this process when it takes the rotation lease.
+	leaseHolder string
+	// set by NewJWTVerifier, the keyring is only loaded from storage.
+	verifyOnly bool
+	// the running keyring sync loop, nil when stopped.
+	sync *keyringSync
+	// the storage etag the keyring was last loaded at.
+	keyringETag  string
+	keyringHooks []func([]*Secret)
+	lastSync     time.Time
+	syncError    error
 }
 
+// ErrMultipleActive is returned when storage holds more than one secret marked active.
+var ErrMultipleActive = errors.New("more than one secret is marked active")
+
+// ErrUnusableSecret is returned when storage holds a secret whose key cannot
+// sign or validate tokens, e.g. an ECDSA key on an unsupported curve.
+var ErrUnusableSecret = errors.New("secret cannot be used for tokens")
+
 // NewRotationManager creates a new RotationManager.
-func NewRotationManager(policy RotationPolicy, store storage.SecretStorage, gen SecretGenerator, notifier Notifier) (*RotationManager, error) {
+// The context bounds loading the keyring and storing the initial secret.
+func NewRotationManager(ctx context.Context, policy RotationPolicy, store storage.SecretStorage, gen SecretGenerator, notifier Notifier) (*RotationManager, error) {
 	rm := &RotationManager{
 		policy:          policy,
 		previousSecrets: make([]*Secret, 0),
 		storage:         store,
 		generator:       gen,
 		notifier:        notifier,
+		leaseHolder:     newLeaseHolder(),
 	}
 
-	// Try to load secrets from storage
-	allStoredSecrets, err := store.GetAll(context.Background())
-	if err == nil && len(allStoredSecrets) > 0 {
-		// Found secrets in storage, reconstruct state
-		for _, s := range allStoredSecrets {
-			secret := &Secret{
-				ID:        s.ID,
-				Value:     s.Value,
-				CreatedAt: s.CreatedAt,
-				Active:    false, // Mark all as inactive initially
-			}
-			// This logic assumes the latest secret is the first one.
-			// A more robust implementation might sort by CreatedAt.
-			if rm.activeSecret == nil {
-				secret.Active = true
-				rm.activeSecret = secret
-			} else {
-				rm.previousSecrets = append(rm.previousSecrets, secret)
+	storageCtx, cancel := rm.storageContext(ctx)
+	allStoredSecrets, err := store.GetAll(storageCtx)
+	cancel()
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("failed to load secrets: %w", err)
+	}
+
+	// Found secrets in storage, reconstruct state
+	rm.activeSecret, rm.pendingSecret, rm.previousSecrets, err = buildKeyring(allStoredSecrets, policy.GracePeriod, time.Now())
+	if err != nil {
+		rm.notifyError(ctx, err)
+		return nil, err
+	}
+
+	if rm.activeSecret == nil {
+		// If no secret in storage can sign, start with a fresh one
+		secret, err := rm.generateAndStoreSecret(ctx, storage.StateActive)
+		switch {
+		case errors.Is(err, storage.ErrConflict) && rm.activeSecret != nil:
+			// Another process stored the initial secret first, the keyring was reloaded with it.
+		case err != nil:
+			rm.notifyError(ctx, err)
+			return nil, fmt.Errorf("failed to generate initial secret: %w", err)
+		default:
+			rm.activeSecret = secret
+		}
+	}
+
+	rm.publishKeyring()
+	return rm, nil
+}
+
+// buildKeyring reconstructs the active, pending and previous secrets from stored records.
+// Records are ordered by creation time, newest first, so the result does not depend
+// on the order a backend returns them in. The record marked active signs; if none is
+// marked, the newest record without a state (written before states were persisted)
+// is used, otherwise no active secret is returned. The newest pending record is
+// published for validation, and previous secrets whose grace period has expired
+// are skipped. A kept secret whose key cannot be parsed is reported as an error
+// wrapping ErrUnusableSecret instead of silently validating no tokens.
+func buildKeyring(stored []*storage.StoredSecret, gracePeriod time.Duration, now time.Time) (*Secret, *Secret, []*Secret, error) {
+	type entry struct {
+		secret *Secret
+		state  storage.SecretState
+	}
+
+	entries := make([]entry, 0, len(stored))
+	seen := make(map[string]bool, len(stored))
+	for _, s := range stored {
+		id := s.ID
+		if id == "" {
+			// Records written before the kid was persisted still carry the
+			// value the kid was derived from.
+			id = generateSecretId(s.Value)
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		entries = append(entries, entry{
+			secret: &Secret{ID: id, Value: s.Value, CreatedAt: s.CreatedAt},
+			state:  s.State,
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].secret.CreatedAt.Equal(entries[j].secret.CreatedAt) {
+			return entries[i].secret.CreatedAt.After(entries[j].secret.CreatedAt)
+		}
+		return entries[i].secret.ID < entries[j].secret.ID
+	})
+
+	active := -1
+	for i, e := range entries {
+		if e.state != storage.StateActive {
+			continue
+		}
+		if active >= 0 {
+			return nil, nil, nil, fmt.Errorf("secrets %s and %s: %w", entries[active].secret.ID, e.secret.ID, ErrMultipleActive)
+		}
+		active = i
+	}
+	if active < 0 {
+		for i, e := range entries {
+			if e.state == "" {
+				active = i
+				break
 			}
 		}
-	} else {
-		// If no secrets in storage
-		secret, err := rm.generateAndStoreSecret()
-		if err != nil {
-			if rm.notifier != nil {
-				rm.notifier.NotifyError(err)
+	}
+
+	var activeSecret, pendingSecret *Secret
+	previous := make([]*Secret, 0, len(entries))
+	for i, e := range entries {
+		switch {
+		case i == active:
+			e.secret.Active = true
+			activeSecret = e.secret
+		case e.state == storage.StatePending:
+			// Older pending records were superseded before being promoted,
+			// nothing was ever signed with them.
+			if pendingSecret == nil {
+				e.secret.Pending = true
+				pendingSecret = e.secret
 			}
-			return nil, fmt.Errorf("failed to generate initial secret: %w", err)
+		case !gracePeriodExpired(e.secret, gracePeriod, now):
+			previous = append(previous, e.secret)
 		}
-		rm.activeSecret = secret
 	}
 
-	return rm, nil
+	for _, secret := range append([]*Secret{activeSecret, pendingSecret}, previous...) {
+		if secret == nil {
+			continue
+		}
+		if _, err := parseSigningKey(secret.Value); err != nil {
+			return nil, nil, nil, fmt.Errorf("secret %s: %w: %v", secret.ID, ErrUnusableSecret, err)
+		}
+	}
+	return activeSecret, pendingSecret, previous, nil
 }
 
-// generateAndStoreSecret creates a new secret using the generator and stores it.
-func (rm *RotationManager) generateAndStoreSecret() (*Secret, error) {
+// reports whether a previous secret is too old to still validate tokens.
+func gracePeriodExpired(secret *Secret, gracePeriod time.Duration, now time.Time) bool {
+	return gracePeriod > 0 && !secret.CreatedAt.After(now.Add(-gracePeriod))
+}
+
+// generateAndStoreSecret creates a new secret using the generator and stores it in the given state.
+// Backends with conditional writes store it only if the active secret in storage is still the one
+// the manager knows; otherwise the keyring is reloaded and an error wrapping a *storage.ConflictError
+// is returned, so the caller can retry from the newer keyring. The caller must hold the write lock.
+func (rm *RotationManager) generateAndStoreSecret(ctx context.Context, state storage.SecretState) (*Secret, error) {
 	value, err := rm.generator.Generate()
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate secret value: %w", err)
@@ -77,114 +206,202 @@ func (rm *RotationManager) generateAndStoreSecret() (*Secret, error) {
 		ID:        generateSecretId(value),
 		Value:     value,
 		CreatedAt: time.Now(),
-		Active:    true,
+		Active:    state == storage.StateActive,
+		Pending:   state == storage.StatePending,
+	}
+
+	stored := &storage.StoredSecret{
+		ID:        secret.ID,
+		Value:     secret.Value,
+		CreatedAt: secret.CreatedAt,
+		State:     state,
+	}
+	storageCtx, cancel := rm.storageContext(ctx)
+	defer cancel()
+
+	cs, ok := rm.storage.(storage.ConditionalStorer)
+	if !ok {
+		if err := rm.storage.Store(storageCtx, stored); err != nil {
+			return nil, fmt.Errorf("failed to store new secret: %w", err)
+		}
+		return secret, nil
 	}
 
-	if err := rm.storage.Store(context.Background(), secret.ID, secret.Value, secret.CreatedAt); err != nil {
+	var expectedID string
+	if rm.activeSecret != nil {
+		expectedID = rm.activeSecret.ID
+	}
+	err = cs.StoreIf(storageCtx, stored, expectedID)
+	if errors.Is(err, storage.ErrConflict) {
+		if reloadErr := rm.reload(ctx); reloadErr != nil {
+			return nil, fmt.Errorf("failed to store new secret: %w, and failed to reload the keyring: %v", err, reloadErr)
+		}
+		return nil, fmt.Errorf("keyring in storage changed, reloaded it without storing the new secret: %w", err)
+	}
+	if err != nil {
 		return nil, fmt.Errorf("failed to store new secret: %w", err)
 	}
 	return secret, nil
 }
 
 // RotateSecret performs a manual secret rotation.
-func (rm *RotationManager) RotateSecret() (*Secret, error) {
+// Cancelling the context aborts the storage call, in which case the keyring is left unchanged.
+// With a backend that supports leases the rotation holds the rotation lease
+// and starts from the keyring in storage, so it builds on rotations made by
+// other processes; while another process holds the lease it fails with an
+// error wrapping storage.ErrLeaseHeld. If the keyring still changes before the
+// new secret is stored, it fails with an error wrapping a *storage.ConflictError
+// and the manager holds the newer keyring, so the rotation can be retried.
+func (rm *RotationManager) RotateSecret(ctx context.Context) (*Secret, error) {
+	newSecret, err := rm.rotate(ctx)
+	if err != nil {
+		rm.notifyError(ctx, err)
+		return nil, err
+	}
+
+	rm.notifyRotation(ctx, newSecret)
+	return newSecret, nil
+}
+
+// stores a new secret and makes it active, demoting the current one.
+func (rm *RotationManager) rotate(ctx context.Context) (*Secret, error) {
+	if rm.verifyOnly {
+		return nil, ErrVerifyOnly
+	}
+	release, err := rm.acquireLease(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
 	rm.mutex.Lock()
 	defer rm.mutex.Unlock()
 
-	newSecret, err := rm.generateAndStoreSecret()
+	if err := rm.reload(ctx); err != nil {
+		return nil, err
+	}
+	newSecret, err := rm.generateAndStoreSecret(ctx, storage.StateActive)
 	if err != nil {
-		if rm.notifier != nil {
-			rm.notifier.NotifyError(err)
-		}
 		return nil, err
 	}
 
+	rm.activate(newSecret)
+	return newSecret, nil
+}
+
+// makes secret the signing secret and keeps the current one for validation.
+// The caller must hold the write lock.
+func (rm *RotationManager) activate(secret *Secret) {
 	if rm.activeSecret != nil {
 		rm.activeSecret.Active = false // current secret goes inactive
 		rm.previousSecrets = append([]*Secret{rm.activeSecret}, rm.previousSecrets...)
 		rm.cleanupOldSecrets()
 	}
 
-	rm.activeSecret = newSecret
-
-	if rm.notifier != nil {
-		go rm.notifier.NotifyRotation(newSecret)
+	secret.Active = true
+	secret.Pending = false
+	if rm.pendingSecret != nil && rm.pendingSecret.ID == secret.ID {
+		rm.pendingSecret = nil
 	}
-
-	return newSecret, nil
+	rm.activeSecret = secret
+	rm.publishKeyring()
 }
 
 // cleanupOldSecrets removes secrets that are past their grace period.
+// The caller must hold the write lock.
 func (rm *RotationManager) cleanupOldSecrets() {
 	if rm.policy.GracePeriod <= 0 {
 		return
 	}
 
-	cutOffTime := time.Now().Add(-rm.policy.GracePeriod)
+	now := time.Now()
 	validSecrets := make([]*Secret, 0, len(rm.previousSecrets))
 
 	for _, secret := range rm.previousSecrets {
-		if secret.CreatedAt.After(cutOffTime) {
+		if !gracePeriodExpired(secret, rm.policy.GracePeriod, now) {
 			validSecrets = append(validSecrets, secret)
 		}
 	}
 
 	rm.previousSecrets = validSecrets
+	rm.publishKeyring()
 }
 
-// StartAutoRotation starts a background goroutine to rotate secrets periodically.
-func (rm *RotationManager) StartAutoRotation() error {
-	rm.mutex.Lock()
-	defer rm.mutex.Unlock()
-
-	if rm.policy.RotationInterval <= 0 {
-		return fmt.Errorf("rotation interval must be greater than zero")
+// retires the stored secrets that are past their grace period and no longer
+// in the keyring, on backends that would otherwise keep reading them. Failing
+// to prune is reported but does not fail the caller, the next reload retries.
+// The caller must hold the write lock.
+func (rm *RotationManager) pruneExpired(ctx context.Context, stored []*storage.StoredSecret) {
+	pruner, ok := rm.storage.(storage.Pruner)
+	if !ok || rm.policy.GracePeriod <= 0 {
+		return
 	}
 
-	rm.autoRotate = true
-
-	go func() {
-		ticker := time.NewTicker(rm.policy.RotationInterval)
-		defer ticker.Stop()
-
-		for range ticker.C {
-			rm.mutex.RLock()
-			shouldRotate := rm.autoRotate
-			rm.mutex.RUnlock()
-
-			if !shouldRotate {
-				return
-			}
-
-			if _, err := rm.RotateSecret(); err != nil {
-				if rm.notifier != nil {
-					rm.notifier.NotifyError(err)
-				}
-				// It's better to log this than to panic
-				fmt.Printf("Error during automatic rotation: %v\n", err)
-			}
+	kept := make(map[string]bool, len(rm.previousSecrets)+2)
+	for _, secret := range rm.keyring().secrets {
+		kept[secret.ID] = true
+	}
+	now := time.Now()
+	var expired []string
+	for _, s := range stored {
+		if s.ID == "" || kept[s.ID] || s.State == storage.StateActive {
+			continue
+		}
+		if gracePeriodExpired(&Secret{CreatedAt: s.CreatedAt}, rm.policy.GracePeriod, now) {
+			expired = append(expired, s.ID)
 		}
-	}()
+	}
+	if len(expired) == 0 {
+		return
+	}
 
-	return nil
+	storageCtx, cancel := rm.storageContext(ctx)
+	defer cancel()
+	if err := pruner.Prune(storageCtx, expired); err != nil {
+		rm.notifyError(ctx, fmt.Errorf("failed to prune secrets past their grace period: %w", err))
+	}
 }
 
-func (rm *RotationManager) StopAutoRotation() {
-	rm.mutex.Lock()
-	defer rm.mutex.Unlock()
-	rm.autoRotate = false
+// returns all the secrets currently managed by the rotator: the active secret,
+// a pending secret if one is published, then previous secrets. It does not
+// take the lock; the secrets are a snapshot and must not be modified.
+func (rm *RotationManager) GetSecrets() []*Secret {
+	return slices.Clone(rm.keyring().secrets)
 }
 
-// returns all the secrets currently managed by the rotator.
-func (rm *RotationManager) GetSecrets() []*Secret {
-	rm.mutex.RLock()
-	defer rm.mutex.RUnlock()
+// returns a context bounded by the policy's storage timeout.
+func (rm *RotationManager) storageContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if rm.policy.StorageTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, rm.policy.StorageTimeout)
+}
 
-	secrets := make([]*Secret, 0, len(rm.previousSecrets)+1)
-	if rm.activeSecret != nil {
-		secrets = append(secrets, rm.activeSecret)
+// returns a context bounded by the policy's notify timeout.
+func (rm *RotationManager) notifyContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := rm.policy.NotifyTimeout
+	if timeout <= 0 {
+		timeout = DefaultNotifyTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func (rm *RotationManager) notifyRotation(ctx context.Context, secret *Secret) {
+	if rm.notifier == nil {
+		return
 	}
-	secrets = append(secrets, rm.previousSecrets...)
+	ctx, cancel := rm.notifyContext(ctx)
+	defer cancel()
+	rm.notifier.NotifyRotation(ctx, secret)
+}
 
-	return secrets
+// reports an error even when it was caused by the context ending,
+// the notification is still bounded by the notify timeout.
+func (rm *RotationManager) notifyError(ctx context.Context, err error) {
+	if rm.notifier == nil {
+		return
+	}
+	ctx, cancel := rm.notifyContext(context.WithoutCancel(ctx))
+	defer cancel()
+	rm.notifier.NotifyError(ctx, err)
 }
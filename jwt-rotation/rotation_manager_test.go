@@ -0,0 +1,285 @@
+package secrets
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	mathrand "math/rand/v2"
+	"slices"
+	"testing"
+	"time"
+
+	"token-toolkit/jwt-rotation/storage"
+	"token-toolkit/jwt-rotation/storage/storagetest"
+)
+
+var keyringNow = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// a stored record with the kid id, created age before keyringNow.
+func record(id string, age time.Duration, state storage.SecretState) *storage.StoredSecret {
+	return &storage.StoredSecret{
+		ID:        id,
+		Value:     []byte("value-" + id),
+		CreatedAt: keyringNow.Add(-age),
+		State:     state,
+	}
+}
+
+func TestBuildKeyring(t *testing.T) {
+	tests := []struct {
+		name         string
+		records      []*storage.StoredSecret
+		gracePeriod  time.Duration
+		wantActive   string
+		wantPending  string
+		wantPrevious []string
+		wantErr      error
+	}{
+		{
+			name: "active pending and previous",
+			records: []*storage.StoredSecret{
+				record("prev-2", 3*time.Hour, storage.StatePrevious),
+				record("active", time.Hour, storage.StateActive),
+				record("pending", time.Minute, storage.StatePending),
+				record("prev-1", 2*time.Hour, storage.StatePrevious),
+			},
+			gracePeriod:  48 * time.Hour,
+			wantActive:   "active",
+			wantPending:  "pending",
+			wantPrevious: []string{"prev-1", "prev-2"},
+		},
+		{
+			name: "previous with equal creation times are ordered by kid",
+			records: []*storage.StoredSecret{
+				record("b", 2*time.Hour, storage.StatePrevious),
+				record("active", time.Hour, storage.StateActive),
+				record("a", 2*time.Hour, storage.StatePrevious),
+				record("c", 2*time.Hour, storage.StatePrevious),
+			},
+			gracePeriod:  48 * time.Hour,
+			wantActive:   "active",
+			wantPrevious: []string{"a", "b", "c"},
+		},
+		{
+			name: "two active records",
+			records: []*storage.StoredSecret{
+				record("one", 2*time.Hour, storage.StateActive),
+				record("two", time.Hour, storage.StateActive),
+			},
+			gracePeriod: 48 * time.Hour,
+			wantErr:     ErrMultipleActive,
+		},
+		{
+			name: "legacy records without state",
+			records: []*storage.StoredSecret{
+				record("old", 3*time.Hour, ""),
+				record("newest", time.Hour, ""),
+				record("middle", 2*time.Hour, ""),
+			},
+			gracePeriod:  48 * time.Hour,
+			wantActive:   "newest",
+			wantPrevious: []string{"middle", "old"},
+		},
+		{
+			name: "active record wins over a newer legacy record",
+			records: []*storage.StoredSecret{
+				record("legacy", time.Hour, ""),
+				record("active", 2*time.Hour, storage.StateActive),
+			},
+			gracePeriod:  48 * time.Hour,
+			wantActive:   "active",
+			wantPrevious: []string{"legacy"},
+		},
+		{
+			name: "several pending records",
+			records: []*storage.StoredSecret{
+				record("pending-old", 30*time.Minute, storage.StatePending),
+				record("active", time.Hour, storage.StateActive),
+				record("pending-new", 10*time.Minute, storage.StatePending),
+				record("pending-mid", 20*time.Minute, storage.StatePending),
+			},
+			gracePeriod: 48 * time.Hour,
+			wantActive:  "active",
+			wantPending: "pending-new",
+		},
+		{
+			name: "grace-expired previous secrets",
+			records: []*storage.StoredSecret{
+				record("active", time.Hour, storage.StateActive),
+				record("in-grace", 47*time.Hour, storage.StatePrevious),
+				record("at-limit", 48*time.Hour, storage.StatePrevious),
+				record("expired", 72*time.Hour, storage.StatePrevious),
+			},
+			gracePeriod:  48 * time.Hour,
+			wantActive:   "active",
+			wantPrevious: []string{"in-grace"},
+		},
+		{
+			name: "no grace period keeps every previous secret",
+			records: []*storage.StoredSecret{
+				record("active", time.Hour, storage.StateActive),
+				record("expired", 720*time.Hour, storage.StatePrevious),
+			},
+			wantActive:   "active",
+			wantPrevious: []string{"expired"},
+		},
+		{
+			name: "only previous records",
+			records: []*storage.StoredSecret{
+				record("prev", time.Hour, storage.StatePrevious),
+			},
+			gracePeriod:  48 * time.Hour,
+			wantPrevious: []string{"prev"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Backends return records in any order, the keyring must not depend on it.
+			rng := mathrand.New(mathrand.NewPCG(1, 2))
+			for i := 0; i < 10; i++ {
+				records := slices.Clone(tt.records)
+				rng.Shuffle(len(records), func(i, j int) { records[i], records[j] = records[j], records[i] })
+
+				active, pending, previous, err := buildKeyring(records, tt.gracePeriod, keyringNow)
+				if tt.wantErr != nil {
+					if !errors.Is(err, tt.wantErr) {
+						t.Fatalf("error = %v, want %v", err, tt.wantErr)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+
+				if got := secretID(active); got != tt.wantActive {
+					t.Errorf("active = %q, want %q", got, tt.wantActive)
+				}
+				if active != nil && !active.Active {
+					t.Errorf("active secret %s is not flagged active", active.ID)
+				}
+				if got := secretID(pending); got != tt.wantPending {
+					t.Errorf("pending = %q, want %q", got, tt.wantPending)
+				}
+				if pending != nil && !pending.Pending {
+					t.Errorf("pending secret %s is not flagged pending", pending.ID)
+				}
+				var gotPrevious []string
+				for _, secret := range previous {
+					gotPrevious = append(gotPrevious, secret.ID)
+				}
+				if !slices.Equal(gotPrevious, tt.wantPrevious) {
+					t.Errorf("previous = %v, want %v", gotPrevious, tt.wantPrevious)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildKeyringDerivesLegacyKids(t *testing.T) {
+	legacy := &storage.StoredSecret{Value: []byte("legacy value"), CreatedAt: keyringNow.Add(-time.Hour)}
+	duplicate := &storage.StoredSecret{ID: generateSecretId(legacy.Value), Value: legacy.Value, CreatedAt: legacy.CreatedAt, State: storage.StateActive}
+
+	active, _, previous, err := buildKeyring([]*storage.StoredSecret{legacy, duplicate}, time.Hour, keyringNow)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if active == nil || active.ID != generateSecretId(legacy.Value) {
+		t.Fatalf("active = %v, want the kid derived from the value", active)
+	}
+	if len(previous) != 0 {
+		t.Fatalf("previous = %d secrets, want the duplicate record dropped", len(previous))
+	}
+}
+
+func TestBuildKeyringRejectsUnusableKeys(t *testing.T) {
+	// A PKCS#8 key no signing algorithm supports.
+	key, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unusable, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, state := range []storage.SecretState{storage.StateActive, storage.StatePending, storage.StatePrevious} {
+		t.Run(string(state), func(t *testing.T) {
+			records := []*storage.StoredSecret{record("usable", 2*time.Hour, storage.StateActive)}
+			bad := record("unusable", time.Hour, state)
+			bad.Value = unusable
+			if state == storage.StateActive {
+				records[0].State = storage.StatePrevious
+			}
+
+			_, _, _, err := buildKeyring(append(records, bad), 48*time.Hour, keyringNow)
+			if !errors.Is(err, ErrUnusableSecret) {
+				t.Fatalf("error = %v, want ErrUnusableSecret", err)
+			}
+		})
+	}
+
+	t.Run("grace-expired", func(t *testing.T) {
+		bad := record("unusable", 72*time.Hour, storage.StatePrevious)
+		bad.Value = unusable
+		records := []*storage.StoredSecret{record("usable", time.Hour, storage.StateActive), bad}
+
+		if _, _, _, err := buildKeyring(records, 48*time.Hour, keyringNow); err != nil {
+			t.Fatalf("unexpected error for a dropped secret: %v", err)
+		}
+	})
+}
+
+func TestRotatePrunesExpiredSecrets(t *testing.T) {
+	ctx := context.Background()
+	store := storagetest.NewFakeAWS(t)
+	now := time.Now()
+	// Each stored secret takes AWSCURRENT, demoting the one before it.
+	for _, s := range []*storage.StoredSecret{
+		{ID: "expired", Value: []byte("expired value"), CreatedAt: now.Add(-72 * time.Hour), State: storage.StateActive},
+		{ID: "in-grace", Value: []byte("in-grace value"), CreatedAt: now.Add(-2 * time.Hour), State: storage.StateActive},
+		{ID: "active", Value: []byte("active value"), CreatedAt: now.Add(-time.Hour), State: storage.StateActive},
+	} {
+		if err := store.Store(ctx, s); err != nil {
+			t.Fatalf("Store(%s) failed: %v", s.ID, err)
+		}
+	}
+
+	generator, err := NewRandomSecretGenerator(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rm, err := NewRotationManager(ctx, RotationPolicy{GracePeriod: 48 * time.Hour}, store, generator, nil)
+	if err != nil {
+		t.Fatalf("NewRotationManager failed: %v", err)
+	}
+	rotated, err := rm.RotateSecret(ctx)
+	if err != nil {
+		t.Fatalf("RotateSecret failed: %v", err)
+	}
+
+	all, err := store.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("GetAll failed: %v", err)
+	}
+	var got []string
+	for _, s := range all {
+		got = append(got, s.ID)
+	}
+	slices.Sort(got)
+	want := []string{"active", "in-grace", rotated.ID}
+	slices.Sort(want)
+	if !slices.Equal(got, want) {
+		t.Errorf("stored kids after rotating = %v, want %v", got, want)
+	}
+}
+
+func secretID(secret *Secret) string {
+	if secret == nil {
+		return ""
+	}
+	return secret.ID
+}
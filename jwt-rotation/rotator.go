@@ -1,6 +1,7 @@
 package secrets
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
@@ -14,8 +15,38 @@ import (
 type RotationPolicy struct {
 	RotationInterval time.Duration `json:"rotationInterval"`
 	GracePeriod      time.Duration `json:"gracePeriod"`
+	// how long a pending secret is published before it may be promoted,
+	// giving verifiers time to pick it up.
+	PropagationDelay time.Duration `json:"propagationDelay"`
+	// bounds each storage call, zero leaves only the caller's deadline.
+	StorageTimeout time.Duration `json:"storageTimeout"`
+	// bounds each notification, zero means DefaultNotifyTimeout.
+	NotifyTimeout time.Duration `json:"notifyTimeout"`
+	// how long canaries may keep failing after a rotation before it is
+	// rolled back, zero means DefaultCanaryTimeout.
+	CanaryTimeout time.Duration `json:"canaryTimeout"`
+	// a cron expression in UTC for scheduled rotations, e.g. "0 3 * * MON-THU".
+	// It takes precedence over RotationInterval in StartAutoRotation and is
+	// translated for the cloud schedulers in the deploy scripts.
+	Schedule string `json:"schedule,omitempty"`
+	// the most a scheduled rotation is randomly delayed, so that many
+	// deployments sharing a schedule do not all rotate at once.
+	Jitter time.Duration `json:"jitter,omitempty"`
+	// periods in which scheduled rotations are held back until the window closes.
+	Blackouts []BlackoutWindow `json:"blackouts,omitempty"`
+	// how long the rotation lease is held before other processes may take it
+	// over, zero means DefaultLeaseTTL. It must exceed the time a rotation takes.
+	LeaseTTL time.Duration `json:"leaseTTL,omitempty"`
+	// how often StartKeyringSync reloads the keyring from storage, zero
+	// means DefaultSyncInterval.
+	SyncInterval time.Duration `json:"syncInterval,omitempty"`
+	// the most each sync is randomly delayed beyond SyncInterval.
+	SyncJitter time.Duration `json:"syncJitter,omitempty"`
 }
 
+// DefaultNotifyTimeout is used when a policy does not set NotifyTimeout.
+const DefaultNotifyTimeout = 10 * time.Second
+
 // represents the raw value of a secret.
 type SecretValue []byte
 
@@ -25,6 +56,18 @@ type Secret struct {
 	Value     SecretValue `json:"value"`
 	CreatedAt time.Time   `json:"createdAt"`
 	Active    bool        `json:"active"`
+	// published for validation but not yet used for signing.
+	Pending bool `json:"pending"`
+}
+
+// returns a copy for callers outside the lock, since the manager flips the
+// flags of its own secrets when they change roles. nil stays nil.
+func (s *Secret) clone() *Secret {
+	if s == nil {
+		return nil
+	}
+	copied := *s
+	return &copied
 }
 
 // defines the interface for generating new secret values.
@@ -63,7 +106,12 @@ func generateSecretId(secret []byte) string {
 }
 
 // Notifier defines the interface for sending notifications about secret rotation events.
+// Implementations should give up once the context is done.
 type Notifier interface {
-	NotifyRotation(secret *Secret)
-	NotifyError(err error)
+	NotifyRotation(ctx context.Context, secret *Secret)
+	NotifyError(ctx context.Context, err error)
+	// reports an emergency revocation, which should reach people urgently.
+	NotifyRevocation(ctx context.Context, revocation *Revocation)
+	// reports a rollback to the previous signing secret and why it happened.
+	NotifyRollback(ctx context.Context, rollback *Rollback)
 }
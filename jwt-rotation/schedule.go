@@ -0,0 +1,244 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrBlackout is returned when a rotation is refused because it falls in a blackout window.
+var ErrBlackout = errors.New("rotation is in a blackout window")
+
+// how many windows a rotation may be pushed past before the schedule is considered blocked.
+const maxBlackoutSkips = 1000
+
+// a period in which scheduled rotations do not run, such as Friday evenings
+// or a release freeze. A recurring window opens every time Cron matches and
+// stays open for Duration; a one-off window runs from Start to End.
+type BlackoutWindow struct {
+	Cron     string        `json:"cron,omitempty"`
+	Duration time.Duration `json:"duration,omitempty"`
+	Start    time.Time     `json:"start,omitempty"`
+	End      time.Time     `json:"end,omitempty"`
+}
+
+// ParseBlackoutWindows parses a semicolon separated list of windows, each
+// either "<cron> for <duration>", e.g. "0 17 * * FRI for 63h", or
+// "<start> to <end>" with RFC 3339 times, e.g.
+// "2025-12-19T00:00:00Z to 2026-01-05T00:00:00Z".
+func ParseBlackoutWindows(spec string) ([]BlackoutWindow, error) {
+	var windows []BlackoutWindow
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		window, err := parseBlackoutWindow(part)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+func parseBlackoutWindow(spec string) (BlackoutWindow, error) {
+	if cron, duration, ok := strings.Cut(spec, " for "); ok {
+		d, err := time.ParseDuration(strings.TrimSpace(duration))
+		if err != nil {
+			return BlackoutWindow{}, fmt.Errorf("invalid blackout window %q: %w", spec, err)
+		}
+		window := BlackoutWindow{Cron: strings.TrimSpace(cron), Duration: d}
+		return window, window.validate()
+	}
+	if start, end, ok := strings.Cut(spec, " to "); ok {
+		var window BlackoutWindow
+		var err error
+		if window.Start, err = time.Parse(time.RFC3339, strings.TrimSpace(start)); err != nil {
+			return BlackoutWindow{}, fmt.Errorf("invalid blackout window %q: %w", spec, err)
+		}
+		if window.End, err = time.Parse(time.RFC3339, strings.TrimSpace(end)); err != nil {
+			return BlackoutWindow{}, fmt.Errorf("invalid blackout window %q: %w", spec, err)
+		}
+		return window, window.validate()
+	}
+	return BlackoutWindow{}, fmt.Errorf("invalid blackout window %q: expected \"<cron> for <duration>\" or \"<start> to <end>\"", spec)
+}
+
+func (w BlackoutWindow) validate() error {
+	if w.Cron == "" {
+		if !w.End.After(w.Start) {
+			return fmt.Errorf("blackout window %s must end after it starts", w)
+		}
+		return nil
+	}
+	if w.Duration <= 0 {
+		return fmt.Errorf("blackout window %s must have a positive duration", w)
+	}
+	_, err := ParseCron(w.Cron)
+	return err
+}
+
+// formats the window the way ParseBlackoutWindows reads it.
+func (w BlackoutWindow) String() string {
+	if w.Cron != "" {
+		return fmt.Sprintf("%s for %s", w.Cron, w.Duration)
+	}
+	return fmt.Sprintf("%s to %s", w.Start.UTC().Format(time.RFC3339), w.End.UTC().Format(time.RFC3339))
+}
+
+// returns when the window containing t closes, and false if t is outside the window.
+func (w BlackoutWindow) closesAt(t time.Time) (time.Time, bool, error) {
+	if w.Cron == "" {
+		if !t.Before(w.Start) && t.Before(w.End) {
+			return w.End, true, nil
+		}
+		return time.Time{}, false, nil
+	}
+
+	schedule, err := ParseCron(w.Cron)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	// The only opening that can cover t is the first one after t-Duration.
+	opened := schedule.Next(t.Add(-w.Duration))
+	if opened.IsZero() || opened.After(t) {
+		return time.Time{}, false, nil
+	}
+	return opened.Add(w.Duration), true, nil
+}
+
+// CheckBlackout returns an error wrapping ErrBlackout if t is inside one of
+// the policy's blackout windows.
+func (p RotationPolicy) CheckBlackout(t time.Time) error {
+	for _, window := range p.Blackouts {
+		end, inside, err := window.closesAt(t)
+		if err != nil {
+			return err
+		}
+		if inside {
+			return fmt.Errorf("%w %s until %s", ErrBlackout, window, end.UTC().Format(time.RFC3339))
+		}
+	}
+	return nil
+}
+
+// NextScheduledRotation returns when the next scheduled rotation after t
+// should run: the next match of the policy's Schedule, or t plus the
+// RotationInterval without one, delayed by a random jitter and moved past any
+// blackout windows.
+func (p RotationPolicy) NextScheduledRotation(t time.Time) (time.Time, error) {
+	return p.nextRotation(t, t, p.jitter)
+}
+
+// NextRotation returns when a keyring last rotated at last is next due for
+// rotation, without jitter: the first match of the Schedule after now, or
+// last plus the RotationInterval without one (now if that has passed), moved
+// past any blackout windows. It returns the zero time if the policy has neither.
+func (p RotationPolicy) NextRotation(last, now time.Time) (time.Time, error) {
+	if p.Schedule == "" && p.RotationInterval <= 0 {
+		return time.Time{}, nil
+	}
+	return p.nextRotation(last, now, func() time.Duration { return 0 })
+}
+
+func (p RotationPolicy) nextRotation(last, now time.Time, jitter func() time.Duration) (time.Time, error) {
+	var next time.Time
+	switch {
+	case p.Schedule != "":
+		schedule, err := ParseCron(p.Schedule)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if next = schedule.Next(now); next.IsZero() {
+			return time.Time{}, fmt.Errorf("cron expression %q never matches", p.Schedule)
+		}
+	case p.RotationInterval > 0:
+		if last.IsZero() {
+			last = now
+		}
+		if next = last.Add(p.RotationInterval); next.Before(now) {
+			next = now
+		}
+	default:
+		return time.Time{}, errors.New("rotation policy needs a schedule or a rotation interval")
+	}
+	next = next.Add(jitter())
+
+	for i := 0; i < maxBlackoutSkips; i++ {
+		moved := false
+		for _, window := range p.Blackouts {
+			end, inside, err := window.closesAt(next)
+			if err != nil {
+				return time.Time{}, err
+			}
+			if inside {
+				// Jitter again so rotations held back by a window do not all run the moment it closes.
+				next = end.Add(jitter())
+				moved = true
+			}
+		}
+		if !moved {
+			return next, nil
+		}
+	}
+	return time.Time{}, errors.New("blackout windows leave no time for a scheduled rotation")
+}
+
+// returns a random delay up to the policy's Jitter.
+func (p RotationPolicy) jitter() time.Duration {
+	if p.Jitter <= 0 {
+		return 0
+	}
+	return rand.N(p.Jitter)
+}
+
+// WaitJitter sleeps for a random delay up to the policy's Jitter, for
+// functions started by a cloud scheduler that fires at the exact time.
+func (p RotationPolicy) WaitJitter(ctx context.Context) error {
+	delay := p.jitter()
+	if delay == 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// LoadScheduleEnv sets the policy's Schedule, Jitter and Blackouts from the
+// ROTATION_SCHEDULE, ROTATION_JITTER and ROTATION_BLACKOUTS environment
+// variables, which the deploy scripts set on the functions. Unset variables
+// leave the policy unchanged.
+func (p *RotationPolicy) LoadScheduleEnv() error {
+	if schedule := os.Getenv("ROTATION_SCHEDULE"); schedule != "" {
+		if _, err := ParseCron(schedule); err != nil {
+			return err
+		}
+		p.Schedule = schedule
+	}
+	if jitter := os.Getenv("ROTATION_JITTER"); jitter != "" {
+		d, err := time.ParseDuration(jitter)
+		if err != nil {
+			return fmt.Errorf("invalid ROTATION_JITTER: %w", err)
+		}
+		p.Jitter = d
+	}
+	if blackouts := os.Getenv("ROTATION_BLACKOUTS"); blackouts != "" {
+		windows, err := ParseBlackoutWindows(blackouts)
+		if err != nil {
+			return err
+		}
+		p.Blackouts = windows
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package secrets
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseBlackoutWindows(t *testing.T) {
+	windows, err := ParseBlackoutWindows(" 0 17 * * FRI for 63h ; 2025-12-19T00:00:00Z to 2026-01-05T00:00:00Z ;")
+	if err != nil {
+		t.Fatalf("ParseBlackoutWindows failed: %v", err)
+	}
+	want := []BlackoutWindow{
+		{Cron: "0 17 * * FRI", Duration: 63 * time.Hour},
+		{Start: time.Date(2025, 12, 19, 0, 0, 0, 0, time.UTC), End: time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)},
+	}
+	if len(windows) != len(want) {
+		t.Fatalf("windows = %v, want %v", windows, want)
+	}
+	for i := range want {
+		if windows[i].String() != want[i].String() {
+			t.Errorf("window %d = %s, want %s", i, windows[i], want[i])
+		}
+		// String must round-trip through the parser.
+		if again, err := ParseBlackoutWindows(windows[i].String()); err != nil || len(again) != 1 || again[0].String() != want[i].String() {
+			t.Errorf("parsing %q again = %v, %v", windows[i], again, err)
+		}
+	}
+
+	for _, spec := range []string{
+		"0 17 * * FRI",
+		"0 17 * * FRI for soon",
+		"0 17 * * FRI for 0s",
+		"0 17 * * FUN for 1h",
+		"2026-01-05T00:00:00Z to 2025-12-19T00:00:00Z",
+		"2025-12-19 to 2026-01-05",
+	} {
+		if _, err := ParseBlackoutWindows(spec); err == nil {
+			t.Errorf("ParseBlackoutWindows(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestBlackoutWindowClosesAt(t *testing.T) {
+	weekend := BlackoutWindow{Cron: "0 17 * * FRI", Duration: 63 * time.Hour}
+	freeze := BlackoutWindow{Start: time.Date(2025, 12, 19, 0, 0, 0, 0, time.UTC), End: time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)}
+	// Friday 6 June 2025 17:00 to Monday 9 June 08:00.
+	weekendEnd := time.Date(2025, 6, 9, 8, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		window BlackoutWindow
+		at     time.Time
+		want   time.Time
+	}{
+		{name: "before a recurring window", window: weekend, at: time.Date(2025, 6, 6, 16, 59, 0, 0, time.UTC)},
+		{name: "as a recurring window opens", window: weekend, at: time.Date(2025, 6, 6, 17, 0, 0, 0, time.UTC), want: weekendEnd},
+		{name: "inside a recurring window", window: weekend, at: time.Date(2025, 6, 8, 12, 0, 0, 0, time.UTC), want: weekendEnd},
+		{name: "as a recurring window closes", window: weekend, at: weekendEnd},
+		{name: "before a one-off window", window: freeze, at: freeze.Start.Add(-time.Second)},
+		{name: "as a one-off window opens", window: freeze, at: freeze.Start, want: freeze.End},
+		{name: "as a one-off window closes", window: freeze, at: freeze.End},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			end, inside, err := tt.window.closesAt(tt.at)
+			if err != nil {
+				t.Fatalf("closesAt failed: %v", err)
+			}
+			if inside != !tt.want.IsZero() || !end.Equal(tt.want) {
+				t.Errorf("closesAt(%s) = %s, %t; want %s", tt.at, end, inside, tt.want)
+			}
+
+			err = RotationPolicy{Blackouts: []BlackoutWindow{tt.window}}.CheckBlackout(tt.at)
+			if inside := errors.Is(err, ErrBlackout); inside != !tt.want.IsZero() {
+				t.Errorf("CheckBlackout(%s) = %v", tt.at, err)
+			}
+		})
+	}
+}
+
+func TestNextRotation(t *testing.T) {
+	// a Sunday.
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	weekend := BlackoutWindow{Cron: "0 17 * * FRI", Duration: 63 * time.Hour}
+
+	tests := []struct {
+		name    string
+		policy  RotationPolicy
+		last    time.Time
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "neither schedule nor interval"},
+		{
+			name:   "schedule",
+			policy: RotationPolicy{Schedule: "0 3 * * *", RotationInterval: time.Hour},
+			last:   now.Add(-time.Minute),
+			want:   time.Date(2025, 6, 2, 3, 0, 0, 0, time.UTC),
+		},
+		{
+			name:   "interval",
+			policy: RotationPolicy{RotationInterval: 24 * time.Hour},
+			last:   now.Add(-12 * time.Hour),
+			want:   now.Add(12 * time.Hour),
+		},
+		{
+			name:   "overdue interval",
+			policy: RotationPolicy{RotationInterval: 24 * time.Hour},
+			last:   now.Add(-48 * time.Hour),
+			want:   now,
+		},
+		{
+			name:   "interval without a last rotation",
+			policy: RotationPolicy{RotationInterval: 24 * time.Hour},
+			want:   now.Add(24 * time.Hour),
+		},
+		{
+			name:   "moved past a blackout window",
+			policy: RotationPolicy{Schedule: "0 18 * * FRI", Blackouts: []BlackoutWindow{weekend}},
+			want:   time.Date(2025, 6, 9, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "moved past overlapping windows",
+			policy: RotationPolicy{Schedule: "0 18 * * FRI", Blackouts: []BlackoutWindow{
+				weekend,
+				{Start: time.Date(2025, 6, 9, 0, 0, 0, 0, time.UTC), End: time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC)},
+			}},
+			want: time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "schedule that never matches",
+			policy:  RotationPolicy{Schedule: "0 0 30 2 *"},
+			wantErr: true,
+		},
+		{
+			name:    "blackouts that never close",
+			policy:  RotationPolicy{RotationInterval: time.Hour, Blackouts: []BlackoutWindow{{Cron: "* * * * *", Duration: 2 * time.Minute}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.policy.NextRotation(tt.last, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("NextRotation = %s, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NextRotation failed: %v", err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("NextRotation = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextScheduledRotationJitter(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	policy := RotationPolicy{Schedule: "0 3 * * *", Jitter: 10 * time.Minute}
+	scheduled := time.Date(2025, 6, 2, 3, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 100; i++ {
+		got, err := policy.NextScheduledRotation(now)
+		if err != nil {
+			t.Fatalf("NextScheduledRotation failed: %v", err)
+		}
+		if got.Before(scheduled) || !got.Before(scheduled.Add(policy.Jitter)) {
+			t.Fatalf("NextScheduledRotation = %s, want within %s of %s", got, policy.Jitter, scheduled)
+		}
+	}
+}
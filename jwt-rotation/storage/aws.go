@@ -2,19 +2,34 @@ package storage
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
 )
 
 // implements the SecretStorage interface for AWS Secrets Manager.
 type AWSSecretsManager struct {
 	client   *secretsmanager.Client
 	secretID string
+	// version id used for pending secrets, set by ForVersion.
+	pendingVersionID string
+}
+
+func init() {
+	Register(NewBackend("aws", "AWS", func(ctx context.Context, cfg *AWSConfig) (SecretStorage, error) {
+		a := NewAWSSecretsManager()
+		if err := a.Setup(ctx, *cfg); err != nil {
+			return nil, err
+		}
+		return a, nil
+	}))
 }
 
 // creates a new AWSSecretsManager.
@@ -22,52 +37,170 @@ func NewAWSSecretsManager() *AWSSecretsManager {
 	return &AWSSecretsManager{}
 }
 
-// Setup initializes the AWS Secrets Manager client.
-func (a *AWSSecretsManager) Setup(ctx context.Context, configMap map[string]string) error {
-	secretID, ok := configMap["secretID"]
-	if !ok || secretID == "" {
-		return fmt.Errorf("secretID is required for AWS Secrets Manager")
-	}
-	a.secretID = secretID
+// creates an AWSSecretsManager around an existing client, e.g. one pointed at a custom endpoint.
+func NewAWSSecretsManagerFromClient(client *secretsmanager.Client, secretID string) *AWSSecretsManager {
+	return &AWSSecretsManager{client: client, secretID: secretID}
+}
+
+// holds the settings for AWSSecretsManager.
+type AWSConfig struct {
+	SecretID string `config:"secretID,required" env:"SECRET_ID" label:"Secret ID"`
+	Region   string `config:"region,required" env:"REGION" label:"Region"`
+}
 
-	region, ok := configMap["region"]
-	if !ok || region == "" {
-		return fmt.Errorf("region is required for AWS Secrets Manager")
+// Setup initializes the AWS Secrets Manager client.
+func (a *AWSSecretsManager) Setup(ctx context.Context, cfg AWSConfig) error {
+	if err := ValidateConfig("AWS Secrets Manager", &cfg); err != nil {
+		return err
 	}
+	a.secretID = cfg.SecretID
 
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	awsCfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(cfg.Region))
 	if err != nil {
 		return fmt.Errorf("failed to load aws config: %w", err)
 	}
 
-	a.client = secretsmanager.NewFromConfig(cfg)
+	a.client = secretsmanager.NewFromConfig(awsCfg)
 	return nil
 }
 
 // Store creates a new version of a secret in AWS Secrets Manager.
-func (a *AWSSecretsManager) Store(ctx context.Context, id string, value []byte, createdAt time.Time) error {
-	secretData, err := json.Marshal(StoredSecret{
-		ID:        id,
-		Value:     value,
-		CreatedAt: createdAt,
-	})
+// Every version is tagged with a staging label derived from its kid so that
+// older grace-period versions are never deprecated and can be fetched directly.
+func (a *AWSSecretsManager) Store(ctx context.Context, secret *StoredSecret) error {
+	secretData, err := EncodeRecord(secret)
 	if err != nil {
-		return fmt.Errorf("failed to marshal secret data: %w", err)
+		return err
 	}
 
-	_, err = a.client.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
-		SecretId:     aws.String(a.secretID),
-		SecretString: aws.String(string(secretData)),
-	})
+	stages := []string{kidStage(secret.ID)}
+	switch secret.State {
+	case "", StateActive:
+		// Moving AWSCURRENT also moves AWSPREVIOUS to the version it came from.
+		stages = append(stages, stageCurrent)
+	case StatePending:
+		stages = append(stages, stagePending)
+	}
+
+	input := &secretsmanager.PutSecretValueInput{
+		SecretId:      aws.String(a.secretID),
+		SecretString:  aws.String(string(secretData)),
+		VersionStages: stages,
+	}
+	if secret.State == StatePending && a.pendingVersionID != "" {
+		input.ClientRequestToken = aws.String(a.pendingVersionID)
+	}
+	_, err = a.client.PutSecretValue(ctx, input)
 	return err
 }
 
-// Get retrieves a specific version of a secret. (Not directly supported in the same way)
+// StoreIf writes a version labelled only with its kid, then moves AWSCURRENT
+// (or AWSPENDING for a pending secret) to it from the version that had the
+// label when the expected kid was checked. Secrets Manager refuses the move if
+// another writer moved the label in between, and the new version loses its
+// kid label again so it is never read back.
+func (a *AWSSecretsManager) StoreIf(ctx context.Context, secret *StoredSecret, expectedID string) error {
+	data, err := EncodeRecord(secret)
+	if err != nil {
+		return err
+	}
+
+	output, err := a.client.DescribeSecret(ctx, &secretsmanager.DescribeSecretInput{SecretId: aws.String(a.secretID)})
+	if err != nil {
+		return fmt.Errorf("failed to describe secret: %w", err)
+	}
+	staged := make(map[string]string)
+	for versionID, stages := range output.VersionIdsToStages {
+		for _, stage := range stages {
+			staged[stage] = versionID
+		}
+	}
+	actual, err := a.currentKid(ctx, output.VersionIdsToStages[staged[stageCurrent]])
+	if err != nil {
+		return err
+	}
+	if actual != expectedID {
+		return &ConflictError{Expected: expectedID, Actual: actual}
+	}
+
+	input := &secretsmanager.PutSecretValueInput{
+		SecretId:      aws.String(a.secretID),
+		SecretString:  aws.String(string(data)),
+		VersionStages: []string{kidStage(secret.ID)},
+	}
+	var stage string
+	switch secret.State {
+	case "", StateActive:
+		stage = stageCurrent
+	case StatePending:
+		stage = stagePending
+		if a.pendingVersionID != "" {
+			input.ClientRequestToken = aws.String(a.pendingVersionID)
+		}
+	}
+	put, err := a.client.PutSecretValue(ctx, input)
+	if err != nil {
+		return err
+	}
+	versionID := aws.ToString(put.VersionId)
+	if stage == "" || staged[stage] == versionID {
+		return nil
+	}
+
+	err = a.moveStage(ctx, stage, versionID, staged[stage])
+	var invalid *types.InvalidParameterException
+	if !errors.As(err, &invalid) {
+		return err
+	}
+	conflict := &ConflictError{Expected: expectedID}
+	if latest, err := a.GetLatest(ctx); err == nil {
+		conflict.Actual = latest.ID
+	}
+	if err := a.moveStage(ctx, kidStage(secret.ID), "", versionID); err != nil {
+		return fmt.Errorf("%w, and failed to unlabel version %s: %v", conflict, versionID, err)
+	}
+	return conflict
+}
+
+// returns the kid of the AWSCURRENT version from its staging labels, reading
+// versions written before kid labels, or "" if there is no current version.
+func (a *AWSSecretsManager) currentKid(ctx context.Context, stages []string) (string, error) {
+	if len(stages) == 0 {
+		return "", nil
+	}
+	for _, stage := range stages {
+		if id, ok := strings.CutPrefix(stage, kidStagePrefix); ok {
+			return id, nil
+		}
+	}
+	latest, err := a.GetLatest(ctx)
+	if err != nil {
+		return "", err
+	}
+	return latest.ID, nil
+}
+
+// Get retrieves the version labelled with the given kid.
 func (a *AWSSecretsManager) Get(ctx context.Context, id string) (*StoredSecret, error) {
-	// AWS Secrets Manager primarily gets by version stage or version ID, not a custom stored ID.
-	// We will retrieve the current version and check if the ID matches.
-	// This is a simplification. For a real-world scenario, you might need a different approach.
-	return a.GetLatest(ctx)
+	output, err := a.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId:     aws.String(a.secretID),
+		VersionStage: aws.String(kidStage(id)),
+	})
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		// Versions written before kid labels existed can only be found by reading them.
+		return a.findUnlabelled(ctx, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret version for kid %s: %w", id, err)
+	}
+
+	storedSecret, err := decodeSecretValue(output)
+	if err != nil {
+		return nil, err
+	}
+	storedSecret.State = stateFromStages(output.VersionStages)
+	return storedSecret, nil
 }
 
 // retrieves the current version of a secret.
@@ -75,23 +208,451 @@ func (a *AWSSecretsManager) GetLatest(ctx context.Context) (*StoredSecret, error
 	output, err := a.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
 		SecretId: aws.String(a.secretID),
 	})
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return nil, fmt.Errorf("no current version of %s: %w", a.secretID, ErrNotFound)
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	var storedSecret StoredSecret
-	if err := json.Unmarshal([]byte(*output.SecretString), &storedSecret); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal secret string: %w", err)
+	storedSecret, err := decodeSecretValue(output)
+	if err != nil {
+		return nil, err
 	}
-	return &storedSecret, nil
+	storedSecret.State = StateActive
+	return storedSecret, nil
 }
 
-// is not efficiently implemented for AWS Secrets Manager as it doesn't have a direct equivalent.
-// This is a placeholder and would need a more sophisticated implementation for production use.
+// GetAll retrieves every version that is still labelled, newest first.
+// AWSCURRENT is reported as active, AWSPENDING as pending and every other
+// labelled version as previous.
 func (a *AWSSecretsManager) GetAll(ctx context.Context) ([]*StoredSecret, error) {
-	latest, err := a.GetLatest(ctx)
+	versions, err := a.listVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	secrets := make([]*StoredSecret, 0, len(versions))
+	for _, version := range versions {
+		output, err := a.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+			SecretId:  aws.String(a.secretID),
+			VersionId: version.VersionId,
+		})
+		var notFound *types.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			// RotateSecret labels the new version AWSPENDING before the
+			// rotation function has written its value.
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get secret version %s: %w", aws.ToString(version.VersionId), err)
+		}
+
+		storedSecret, err := decodeSecretValue(output)
+		if err != nil {
+			return nil, err
+		}
+		storedSecret.State = stateFromStages(version.VersionStages)
+		secrets = append(secrets, storedSecret)
+	}
+
+	sort.SliceStable(secrets, func(i, j int) bool {
+		return secrets[i].CreatedAt.After(secrets[j].CreatedAt)
+	})
+	return secrets, nil
+}
+
+// SetState moves the AWS staging labels that encode a state: AWSCURRENT for
+// active and AWSPENDING for pending. AWSCURRENT can only be moved, so the active
+// version is demoted by promoting another one.
+func (a *AWSSecretsManager) SetState(ctx context.Context, id string, state SecretState) error {
+	versions, err := a.listVersions(ctx)
+	if err != nil {
+		return err
+	}
+
+	var target, current, pending string
+	for _, version := range versions {
+		versionID := aws.ToString(version.VersionId)
+		for _, stage := range version.VersionStages {
+			switch stage {
+			case kidStage(id):
+				target = versionID
+			case stageCurrent:
+				current = versionID
+			case stagePending:
+				pending = versionID
+			}
+		}
+	}
+	if target == "" {
+		return fmt.Errorf("secret with id %s: %w", id, ErrNotFound)
+	}
+
+	switch state {
+	case StateActive:
+		if current != target {
+			if err := a.moveStage(ctx, stageCurrent, target, current); err != nil {
+				return err
+			}
+		}
+		if pending == target {
+			return a.moveStage(ctx, stagePending, "", target)
+		}
+	case StatePending:
+		if current == target {
+			return fmt.Errorf("secret %s is active and cannot be made pending", id)
+		}
+		if pending != target {
+			return a.moveStage(ctx, stagePending, target, pending)
+		}
+	case StatePrevious:
+		if current == target {
+			return fmt.Errorf("secret %s is active, promote another secret to demote it", id)
+		}
+		if pending == target {
+			return a.moveStage(ctx, stagePending, "", target)
+		}
+	default:
+		return fmt.Errorf("unsupported secret state %q", state)
+	}
+	return nil
+}
+
+// ForVersion returns a copy of the backend that stores pending secrets under
+// the given version id, as the rotation function protocol requires for the
+// ClientRequestToken that RotateSecret hands to each step.
+func (a *AWSSecretsManager) ForVersion(versionID string) *AWSSecretsManager {
+	return &AWSSecretsManager{client: a.client, secretID: a.secretID, pendingVersionID: versionID}
+}
+
+// GetVersion retrieves a version by its id. It returns ErrNotFound for a
+// version that RotateSecret has created but no value was written to yet.
+func (a *AWSSecretsManager) GetVersion(ctx context.Context, versionID string) (*StoredSecret, error) {
+	output, err := a.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId:  aws.String(a.secretID),
+		VersionId: aws.String(versionID),
+	})
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return nil, fmt.Errorf("secret version %s: %w", versionID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret version %s: %w", versionID, err)
+	}
+
+	storedSecret, err := decodeSecretValue(output)
+	if err != nil {
+		return nil, err
+	}
+	storedSecret.State = stateFromStages(output.VersionStages)
+	return storedSecret, nil
+}
+
+// RotationState checks that rotation is enabled on the secret and reports the
+// state of the version being rotated to: active once it holds AWSCURRENT,
+// pending while it holds AWSPENDING. Any other version is an error.
+func (a *AWSSecretsManager) RotationState(ctx context.Context, versionID string) (SecretState, error) {
+	output, err := a.client.DescribeSecret(ctx, &secretsmanager.DescribeSecretInput{
+		SecretId: aws.String(a.secretID),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe secret: %w", err)
+	}
+	if !aws.ToBool(output.RotationEnabled) {
+		return "", fmt.Errorf("rotation is not enabled on secret %s", a.secretID)
+	}
+
+	stages, ok := output.VersionIdsToStages[versionID]
+	if !ok {
+		return "", fmt.Errorf("secret version %s has no stage for rotation of secret %s", versionID, a.secretID)
+	}
+	switch state := stateFromStages(stages); state {
+	case StateActive, StatePending:
+		return state, nil
+	default:
+		return "", fmt.Errorf("secret version %s is not set as AWSPENDING for rotation of secret %s", versionID, a.secretID)
+	}
+}
+
+// Revoke removes every staging label from the version holding a kid. Secrets
+// Manager cannot disable a single version, unlabelled versions are deprecated
+// and eventually deleted, and are never read back by GetAll.
+func (a *AWSSecretsManager) Revoke(ctx context.Context, id string) error {
+	versions, err := a.listVersions(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, version := range versions {
+		if !hasStage(version.VersionStages, kidStage(id)) {
+			continue
+		}
+		if hasStage(version.VersionStages, stageCurrent) {
+			return fmt.Errorf("secret %s: %w", id, ErrRevokeActive)
+		}
+		return a.unlabel(ctx, version)
+	}
+	return fmt.Errorf("secret with id %s: %w", id, ErrNotFound)
+}
+
+// Prune removes every staging label from the versions holding the given kids,
+// as Revoke does, listing the versions once. Without their kid labels the
+// versions no longer count towards the staging label quota and are no longer
+// read by GetAll. Versions holding AWSCURRENT or AWSPENDING are kept.
+func (a *AWSSecretsManager) Prune(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	versions, err := a.listVersions(ctx)
+	if err != nil {
+		return err
+	}
+
+	prune := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		prune[kidStage(id)] = true
+	}
+	for _, version := range versions {
+		if hasStage(version.VersionStages, stageCurrent) || hasStage(version.VersionStages, stagePending) {
+			continue
+		}
+		for _, stage := range version.VersionStages {
+			if prune[stage] {
+				if err := a.unlabel(ctx, version); err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// removes every staging label from a version, leaving it to be deprecated.
+func (a *AWSSecretsManager) unlabel(ctx context.Context, version types.SecretVersionsListEntry) error {
+	for _, stage := range version.VersionStages {
+		if err := a.moveStage(ctx, stage, "", aws.ToString(version.VersionId)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attaches a staging label to one version and removes it from another, either may be empty.
+func (a *AWSSecretsManager) moveStage(ctx context.Context, stage, to, from string) error {
+	input := &secretsmanager.UpdateSecretVersionStageInput{
+		SecretId:     aws.String(a.secretID),
+		VersionStage: aws.String(stage),
+	}
+	if to != "" {
+		input.MoveToVersionId = aws.String(to)
+	}
+	if from != "" {
+		input.RemoveFromVersionId = aws.String(from)
+	}
+	if _, err := a.client.UpdateSecretVersionStage(ctx, input); err != nil {
+		return fmt.Errorf("failed to move staging label %s: %w", stage, err)
+	}
+	return nil
+}
+
+// lists the versions that carry one of our labels or one of the AWS rotation labels.
+func (a *AWSSecretsManager) listVersions(ctx context.Context) ([]types.SecretVersionsListEntry, error) {
+	paginator := secretsmanager.NewListSecretVersionIdsPaginator(a.client, &secretsmanager.ListSecretVersionIdsInput{
+		SecretId: aws.String(a.secretID),
+	})
+
+	var versions []types.SecretVersionsListEntry
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list secret versions: %w", err)
+		}
+		for _, version := range page.Versions {
+			if isManagedVersion(version.VersionStages) {
+				versions = append(versions, version)
+			}
+		}
+	}
+	return versions, nil
+}
+
+// scans all versions for a kid, used for versions stored before kid labels.
+func (a *AWSSecretsManager) findUnlabelled(ctx context.Context, id string) (*StoredSecret, error) {
+	secrets, err := a.GetAll(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return []*StoredSecret{latest}, nil
+	for _, s := range secrets {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("secret with id %s: %w", id, ErrNotFound)
+}
+
+const (
+	stageCurrent   = "AWSCURRENT"
+	stagePrevious  = "AWSPREVIOUS"
+	stagePending   = "AWSPENDING"
+	kidStagePrefix = "kid-"
+	// lease versions carry locksmith-lease-<name> while they hold the lease.
+	leaseStagePrefix = "locksmith-lease-"
+	// marks the newest lease version until its lease label is moved to it.
+	leaseClaimStage = "locksmith-lease-claim"
+)
+
+// returns the staging label used to find a version by its kid.
+func kidStage(id string) string {
+	return kidStagePrefix + id
+}
+
+func isManagedVersion(stages []string) bool {
+	for _, stage := range stages {
+		if stage == stageCurrent || stage == stagePrevious || stage == stagePending || strings.HasPrefix(stage, kidStagePrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasStage(stages []string, stage string) bool {
+	for _, s := range stages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
+
+func stateFromStages(stages []string) SecretState {
+	state := StatePrevious
+	for _, stage := range stages {
+		switch stage {
+		case stageCurrent:
+			return StateActive
+		case stagePending:
+			state = StatePending
+		}
+	}
+	return state
+}
+
+func decodeSecretValue(output *secretsmanager.GetSecretValueOutput) (*StoredSecret, error) {
+	storedSecret, err := DecodeRecord([]byte(aws.ToString(output.SecretString)))
+	if err != nil {
+		return nil, err
+	}
+	if storedSecret.CreatedAt.IsZero() && output.CreatedDate != nil {
+		storedSecret.CreatedAt = *output.CreatedDate
+	}
+	return storedSecret, nil
+}
+
+// AcquireLease writes the lease as a version of the secret that carries the
+// lease's staging label. Moving the label from the version that holds it is
+// refused by Secrets Manager once another holder has moved it, so only one of
+// two racing holders wins. Lease versions never carry AWSCURRENT, and
+// versions without their lease label are left to be deprecated.
+func (a *AWSSecretsManager) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (*Lease, error) {
+	current, versionID, err := a.getLease(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkLease(current, holder, time.Now()); err != nil {
+		return nil, err
+	}
+	if versionID == "" {
+		// Secrets Manager makes the first version of a secret AWSCURRENT, which must not be a lease.
+		if _, err := a.GetLatest(ctx); err != nil {
+			return nil, fmt.Errorf("failed to check for a current version before leasing: %w", err)
+		}
+	}
+
+	lease := newLease(name, holder, ttl)
+	data, err := encodeLease(lease)
+	if err != nil {
+		return nil, err
+	}
+	output, err := a.client.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+		SecretId:      aws.String(a.secretID),
+		SecretString:  aws.String(string(data)),
+		VersionStages: []string{leaseClaimStage},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write lease %s: %w", name, err)
+	}
+
+	err = a.moveStage(ctx, leaseStage(name), aws.ToString(output.VersionId), versionID)
+	var invalid *types.InvalidParameterException
+	if errors.As(err, &invalid) {
+		return nil, fmt.Errorf("%w: lease %s was taken while acquiring it", ErrLeaseHeld, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+// removes the lease's staging label if holder still has the lease.
+func (a *AWSSecretsManager) ReleaseLease(ctx context.Context, name, holder string) error {
+	current, versionID, err := a.getLease(ctx, name)
+	if err != nil || current == nil || current.Holder != holder {
+		return err
+	}
+
+	err = a.moveStage(ctx, leaseStage(name), "", versionID)
+	var invalid *types.InvalidParameterException
+	if errors.As(err, &invalid) {
+		// taken over after it expired
+		return nil
+	}
+	return err
+}
+
+// returns the lease and the id of the version holding it, or nil and an empty id without one.
+func (a *AWSSecretsManager) getLease(ctx context.Context, name string) (*Lease, string, error) {
+	output, err := a.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId:     aws.String(a.secretID),
+		VersionStage: aws.String(leaseStage(name)),
+	})
+	var notFound *types.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get lease %s: %w", name, err)
+	}
+
+	lease, err := decodeLease([]byte(aws.ToString(output.SecretString)))
+	if err != nil {
+		return nil, "", err
+	}
+	return lease, aws.ToString(output.VersionId), nil
+}
+
+// returns the staging label of the version holding a lease.
+func leaseStage(name string) string {
+	return leaseStagePrefix + name
+}
+
+// ETag hashes the staging labels of every version, which every write moves,
+// so polling costs one DescribeSecret call. Lease labels are left out.
+func (a *AWSSecretsManager) ETag(ctx context.Context) (string, error) {
+	output, err := a.client.DescribeSecret(ctx, &secretsmanager.DescribeSecretInput{SecretId: aws.String(a.secretID)})
+	if err != nil {
+		return "", fmt.Errorf("failed to describe secret: %w", err)
+	}
+
+	var parts []string
+	for versionID, stages := range output.VersionIdsToStages {
+		for _, stage := range stages {
+			if !strings.HasPrefix(stage, leaseStagePrefix) {
+				parts = append(parts, versionID+"="+stage)
+			}
+		}
+	}
+	return hashETag(parts), nil
 }
@@ -2,9 +2,14 @@ package storage
 
 import (
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"net/http"
+	"sort"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/keyvault/azsecrets"
 )
@@ -16,24 +21,39 @@ type AzureKeyVault struct {
 	secretName string
 }
 
+func init() {
+	Register(NewBackend("azure", "Azure", func(ctx context.Context, cfg *AzureConfig) (SecretStorage, error) {
+		a := NewAzureKeyVault()
+		if err := a.Setup(ctx, *cfg); err != nil {
+			return nil, err
+		}
+		return a, nil
+	}))
+}
+
 // NewAzureKeyVault creates a new AzureKeyVault.
 func NewAzureKeyVault() *AzureKeyVault {
 	return &AzureKeyVault{}
 }
 
-// Setup initializes the Azure Key Vault client.
-func (a *AzureKeyVault) Setup(ctx context.Context, config map[string]string) error {
-	vaultURI, ok := config["vaulturi"]
-	if !ok || vaultURI == "" {
-		return fmt.Errorf("vaultURI is required for Azure Key Vault")
-	}
-	a.vaultURI = vaultURI
+// creates an AzureKeyVault around an existing client, e.g. one pointed at a custom endpoint.
+func NewAzureKeyVaultFromClient(client *azsecrets.Client, secretName string) *AzureKeyVault {
+	return &AzureKeyVault{client: client, secretName: secretName}
+}
+
+// holds the settings for AzureKeyVault.
+type AzureConfig struct {
+	VaultURI   string `config:"vaultURI,required" env:"VAULT_URI" label:"Vault URI"`
+	SecretName string `config:"secretName,required" env:"SECRET_NAME" label:"Secret Name"`
+}
 
-	secretName, ok := config["secretname"]
-	if !ok || secretName == "" {
-		return fmt.Errorf("secretName is required for Azure Key Vault")
+// Setup initializes the Azure Key Vault client.
+func (a *AzureKeyVault) Setup(ctx context.Context, cfg AzureConfig) error {
+	if err := ValidateConfig("Azure Key Vault", &cfg); err != nil {
+		return err
 	}
-	a.secretName = secretName
+	a.vaultURI = cfg.VaultURI
+	a.secretName = cfg.SecretName
 
 	cred, err := azidentity.NewDefaultAzureCredential(nil)
 	if err != nil {
@@ -49,44 +69,517 @@ func (a *AzureKeyVault) Setup(ctx context.Context, config map[string]string) err
 }
 
 // Store creates a new version of a secret in Azure Key Vault.
-func (a *AzureKeyVault) Store(ctx context.Context, id string, value []byte, createdAt time.Time) error {
-	secretValue := string(value)
+// The record is base64 encoded because Key Vault values must be valid strings,
+// and the kid and state are kept as tags so versions can be found without reading them.
+// Storing an active secret demotes the previously active one first.
+func (a *AzureKeyVault) Store(ctx context.Context, secret *StoredSecret) error {
+	data, err := EncodeRecord(secret)
+	if err != nil {
+		return err
+	}
+
+	state := secret.State
+	if state == "" {
+		state = StateActive
+	}
+
+	secretValue := base64.StdEncoding.EncodeToString(data)
+	contentType := azureContentType
 	params := azsecrets.SetSecretParameters{
-		Value: &secretValue,
+		Value:       &secretValue,
+		ContentType: &contentType,
+		Tags:        azureTags(secret.ID, state),
+	}
+	if state != StateActive {
+		_, err := a.client.SetSecret(ctx, a.secretName, params, nil)
+		return err
+	}
+	return a.activate(ctx, "", func() error {
+		_, err := a.client.SetSecret(ctx, a.secretName, params, nil)
+		return err
+	})
+}
+
+// makes a version the active one. Key Vault cannot retag several versions at
+// once, so the active version is demoted before tag marks the new one: an
+// interrupted activation must not leave two versions tagged active, which
+// the keyring rejects. If tag fails, the demoted versions are tagged active
+// again.
+func (a *AzureKeyVault) activate(ctx context.Context, keep string, tag func() error) error {
+	demoted, err := a.demoteActive(ctx, keep)
+	if err == nil {
+		err = tag()
+	}
+	if err == nil {
+		return nil
+	}
+
+	// Restore even if ctx is why the activation failed.
+	restoreCtx := context.WithoutCancel(ctx)
+	for _, item := range demoted {
+		if restoreErr := a.setStateTag(restoreCtx, item, StateActive); restoreErr != nil {
+			return fmt.Errorf("%w, and restoring the active version failed: %w", err, restoreErr)
+		}
 	}
-	_, err := a.client.SetSecret(ctx, a.secretName, params, nil)
 	return err
 }
 
-// Get is not implemented for Azure, as we mainly care about storing and latest.
+// retags every other version marked active as previous and returns them.
+func (a *AzureKeyVault) demoteActive(ctx context.Context, keep string) ([]*azsecrets.SecretItem, error) {
+	var active []*azsecrets.SecretItem
+	pager := a.client.NewListSecretVersionsPager(a.secretName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list secret versions: %w", err)
+		}
+		for _, item := range page.Value {
+			if item.ID == nil || item.ID.Version() == keep || tagValue(item.Tags, azureStateTag) != string(StateActive) {
+				continue
+			}
+			active = append(active, item)
+		}
+	}
+
+	var demoted []*azsecrets.SecretItem
+	for _, item := range active {
+		if err := a.setStateTag(ctx, item, StatePrevious); err != nil {
+			return demoted, err
+		}
+		demoted = append(demoted, item)
+	}
+	return demoted, nil
+}
+
+// replaces the state tag of a version, keeping its other tags.
+func (a *AzureKeyVault) setStateTag(ctx context.Context, item *azsecrets.SecretItem, state SecretState) error {
+	tags := make(map[string]*string, len(item.Tags)+1)
+	for k, v := range item.Tags {
+		tags[k] = v
+	}
+	value := string(state)
+	tags[azureStateTag] = &value
+	if _, err := a.client.UpdateSecret(ctx, a.secretName, item.ID.Version(), azsecrets.UpdateSecretParameters{Tags: tags}, nil); err != nil {
+		return fmt.Errorf("failed to set state of secret version %s: %w", item.ID.Version(), err)
+	}
+	return nil
+}
+
+// returns the first enabled version matching the predicate, or nil.
+func (a *AzureKeyVault) findVersion(ctx context.Context, match func(*azsecrets.SecretItem) bool) (*azsecrets.SecretItem, error) {
+	pager := a.client.NewListSecretVersionsPager(a.secretName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list secret versions: %w", err)
+		}
+		for _, item := range page.Value {
+			if item.ID != nil && isEnabled(item.Attributes) && match(item) {
+				return item, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Get retrieves the version tagged with the given kid.
 func (a *AzureKeyVault) Get(ctx context.Context, id string) (*StoredSecret, error) {
-	return a.GetLatest(ctx)
+	var untagged []*azsecrets.SecretItem
+	pager := a.client.NewListSecretVersionsPager(a.secretName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list secret versions: %w", err)
+		}
+		for _, item := range page.Value {
+			if item.ID == nil || !isEnabled(item.Attributes) {
+				continue
+			}
+			kid := tagValue(item.Tags, azureKidTag)
+			if kid == id {
+				return a.getVersion(ctx, item.ID.Version())
+			}
+			if kid == "" {
+				untagged = append(untagged, item)
+			}
+		}
+	}
+
+	// Versions written before kid tags existed can only be matched by reading them.
+	for _, item := range untagged {
+		secret, err := a.getVersion(ctx, item.ID.Version())
+		if err != nil {
+			return nil, err
+		}
+		if secret.ID == id {
+			return secret, nil
+		}
+	}
+	return nil, fmt.Errorf("secret with id %s: %w", id, ErrNotFound)
 }
 
-// retrieves the latest version of a secret from Azure Key Vault.
+// retrieves the version tagged as active, or the latest version of a secret
+// that predates the tags.
 func (a *AzureKeyVault) GetLatest(ctx context.Context) (*StoredSecret, error) {
-	resp, err := a.client.GetSecret(ctx, a.secretName, "", nil)
+	item, err := a.findVersion(ctx, func(item *azsecrets.SecretItem) bool {
+		return tagValue(item.Tags, azureStateTag) == string(StateActive)
+	})
 	if err != nil {
 		return nil, err
 	}
-	// The CreatedOn field is in the Properties of the response.
-	// We need to dereference it to get the time.Time value.
-	var createdAt time.Time
-	if resp.SecretBundle.Attributes != nil && resp.SecretBundle.Attributes.Created != nil {
-		createdAt = *resp.SecretBundle.Attributes.Created
+	if item == nil {
+		return a.getVersion(ctx, "")
+	}
+	return a.getVersion(ctx, item.ID.Version())
+}
+
+// SetState retags the version holding a kid. Activating a version demotes
+// the active one first.
+func (a *AzureKeyVault) SetState(ctx context.Context, id string, state SecretState) error {
+	item, err := a.findVersion(ctx, func(item *azsecrets.SecretItem) bool {
+		return tagValue(item.Tags, azureKidTag) == id
+	})
+	if err != nil {
+		return err
+	}
+	if item == nil {
+		return fmt.Errorf("secret with id %s: %w", id, ErrNotFound)
+	}
+
+	if state != StateActive {
+		return a.setStateTag(ctx, item, state)
+	}
+	return a.activate(ctx, item.ID.Version(), func() error {
+		return a.setStateTag(ctx, item, state)
+	})
+}
+
+// Revoke disables the version holding a kid, so its value can no longer be read.
+func (a *AzureKeyVault) Revoke(ctx context.Context, id string) error {
+	item, err := a.findVersion(ctx, func(item *azsecrets.SecretItem) bool {
+		return tagValue(item.Tags, azureKidTag) == id
+	})
+	if err != nil {
+		return err
+	}
+	if item == nil {
+		return fmt.Errorf("secret with id %s: %w", id, ErrNotFound)
+	}
+	if tagValue(item.Tags, azureStateTag) == string(StateActive) {
+		return fmt.Errorf("secret %s: %w", id, ErrRevokeActive)
+	}
+
+	return a.disableVersion(ctx, a.secretName, item.ID.Version())
+}
+
+// Prune disables the versions holding the given kids, as Revoke does, listing
+// the versions once. Disabled versions are no longer read by GetAll. Versions
+// tagged active or pending are kept.
+func (a *AzureKeyVault) Prune(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	prune := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		prune[id] = true
+	}
+
+	var versions []string
+	pager := a.client.NewListSecretVersionsPager(a.secretName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list secret versions: %w", err)
+		}
+		for _, item := range page.Value {
+			if item.ID == nil || !isEnabled(item.Attributes) || !prune[tagValue(item.Tags, azureKidTag)] {
+				continue
+			}
+			switch SecretState(tagValue(item.Tags, azureStateTag)) {
+			case StateActive, StatePending:
+				continue
+			}
+			versions = append(versions, item.ID.Version())
+		}
 	}
 
-	return &StoredSecret{
-		Value:     []byte(*resp.Value),
-		CreatedAt: createdAt,
-	}, nil
+	for _, version := range versions {
+		if err := a.disableVersion(ctx, a.secretName, version); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// GetAll is not implemented for Azure.
+// GetAll retrieves every enabled version of the secret, newest first.
 func (a *AzureKeyVault) GetAll(ctx context.Context) ([]*StoredSecret, error) {
-	latest, err := a.GetLatest(ctx)
+	var secrets []*StoredSecret
+	pager := a.client.NewListSecretVersionsPager(a.secretName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list secret versions: %w", err)
+		}
+		for _, item := range page.Value {
+			if item.ID == nil || !isEnabled(item.Attributes) {
+				continue
+			}
+			secret, err := a.getVersion(ctx, item.ID.Version())
+			if err != nil {
+				return nil, err
+			}
+			secrets = append(secrets, secret)
+		}
+	}
+
+	sort.SliceStable(secrets, func(i, j int) bool {
+		return secrets[i].CreatedAt.After(secrets[j].CreatedAt)
+	})
+	return secrets, nil
+}
+
+// fetches and decodes a single version, an empty version means the latest one.
+func (a *AzureKeyVault) getVersion(ctx context.Context, version string) (*StoredSecret, error) {
+	resp, err := a.client.GetSecret(ctx, a.secretName, version, nil)
+	if err != nil {
+		if isAzureNotFound(err) {
+			return nil, fmt.Errorf("secret version %q: %w", version, ErrNotFound)
+		}
+		return nil, err
+	}
+	if resp.Value == nil {
+		return nil, fmt.Errorf("secret version %q has no value", version)
+	}
+
+	secret, err := decodeAzureValue(resp.ContentType, *resp.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	// The CreatedOn field is in the Properties of the response.
+	// It only matters for values stored before the record format.
+	if secret.CreatedAt.IsZero() && resp.Attributes != nil && resp.Attributes.Created != nil {
+		secret.CreatedAt = *resp.Attributes.Created
+	}
+	// Tags can be updated after the value is written, so they win over the record.
+	if state := tagValue(resp.Tags, azureStateTag); state != "" {
+		secret.State = SecretState(state)
+	}
+	return secret, nil
+}
+
+const (
+	azureContentType = RecordContentType + ";base64"
+	azureKidTag      = "kid"
+	azureStateTag    = "state"
+	azureHolderTag   = "holder"
+	azureExpiresTag  = "expires"
+	// how long a contender waits after writing its claim before reading who
+	// won, longer than the one second resolution of version creation times.
+	azureLeaseSettleDelay = 2 * time.Second
+)
+
+func azureTags(id string, state SecretState) map[string]*string {
+	tags := map[string]*string{azureKidTag: &id}
+	if state != "" {
+		stateValue := string(state)
+		tags[azureStateTag] = &stateValue
+	}
+	return tags
+}
+
+// decodes a value according to its content type, older values were stored as plain strings.
+func decodeAzureValue(contentType *string, value string) (*StoredSecret, error) {
+	if contentType == nil || *contentType != azureContentType {
+		return DecodeRecord([]byte(value))
+	}
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode secret value: %w", err)
+	}
+	return DecodeRecord(data)
+}
+
+func tagValue(tags map[string]*string, key string) string {
+	if v, ok := tags[key]; ok && v != nil {
+		return *v
+	}
+	return ""
+}
+
+func isEnabled(attributes *azsecrets.SecretAttributes) bool {
+	return attributes == nil || attributes.Enabled == nil || *attributes.Enabled
+}
+
+// AcquireLease keeps a lease in its own secret, "<secret>-lease-<name>", since
+// Key Vault has no conditional writes. Every attempt adds a version tagged
+// with its holder and expiry, waits for racing attempts to become visible and
+// then looks at the oldest unexpired, enabled version: its holder has the
+// lease, and a losing attempt disables its version again.
+func (a *AzureKeyVault) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (*Lease, error) {
+	leaseName := a.leaseSecretName(name)
+	versions, err := a.leaseVersions(ctx, leaseName, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) > 0 {
+		if err := checkLease(versions[0].lease, holder, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	lease := newLease(name, holder, ttl)
+	data, err := encodeLease(lease)
+	if err != nil {
+		return nil, err
+	}
+	value := string(data)
+	contentType := "application/json"
+	expires := lease.ExpiresAt.UTC().Format(time.RFC3339Nano)
+	resp, err := a.client.SetSecret(ctx, leaseName, azsecrets.SetSecretParameters{
+		Value:       &value,
+		ContentType: &contentType,
+		Tags:        map[string]*string{azureHolderTag: &holder, azureExpiresTag: &expires},
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write lease %s: %w", name, err)
+	}
+	if resp.ID == nil {
+		return nil, fmt.Errorf("lease %s was written without a version", name)
+	}
+
+	timer := time.NewTimer(azureLeaseSettleDelay)
+	select {
+	case <-ctx.Done():
+		timer.Stop()
+		return nil, ctx.Err()
+	case <-timer.C:
+	}
+
+	versions, err = a.leaseVersions(ctx, leaseName, name)
 	if err != nil {
 		return nil, err
 	}
-	return []*StoredSecret{latest}, nil
+	if len(versions) > 0 && versions[0].lease.Holder != holder {
+		if err := a.disableVersion(ctx, leaseName, resp.ID.Version()); err != nil {
+			return nil, err
+		}
+		return nil, checkLease(versions[0].lease, holder, time.Now())
+	}
+	return lease, nil
+}
+
+// disables every version of the lease secret written by holder.
+func (a *AzureKeyVault) ReleaseLease(ctx context.Context, name, holder string) error {
+	leaseName := a.leaseSecretName(name)
+	pager := a.client.NewListSecretVersionsPager(leaseName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if isAzureNotFound(err) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to list lease versions: %w", err)
+		}
+		for _, item := range page.Value {
+			if item.ID == nil || !isEnabled(item.Attributes) || tagValue(item.Tags, azureHolderTag) != holder {
+				continue
+			}
+			if err := a.disableVersion(ctx, leaseName, item.ID.Version()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// a version of a lease secret.
+type azureLeaseVersion struct {
+	lease   *Lease
+	created time.Time
+	version string
+}
+
+// returns the enabled, unexpired versions of a lease secret, oldest first.
+func (a *AzureKeyVault) leaseVersions(ctx context.Context, leaseName, name string) ([]azureLeaseVersion, error) {
+	now := time.Now()
+	var versions []azureLeaseVersion
+	pager := a.client.NewListSecretVersionsPager(leaseName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if isAzureNotFound(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list lease versions: %w", err)
+		}
+		for _, item := range page.Value {
+			if item.ID == nil || !isEnabled(item.Attributes) || item.Attributes == nil || item.Attributes.Created == nil {
+				continue
+			}
+			expires, err := time.Parse(time.RFC3339Nano, tagValue(item.Tags, azureExpiresTag))
+			if err != nil || !now.Before(expires) {
+				continue
+			}
+			versions = append(versions, azureLeaseVersion{
+				lease:   &Lease{Name: name, Holder: tagValue(item.Tags, azureHolderTag), ExpiresAt: expires},
+				created: *item.Attributes.Created,
+				version: item.ID.Version(),
+			})
+		}
+	}
+
+	// Creation times are in whole seconds, the version id breaks ties the same way for every contender.
+	sort.Slice(versions, func(i, j int) bool {
+		if !versions[i].created.Equal(versions[j].created) {
+			return versions[i].created.Before(versions[j].created)
+		}
+		return versions[i].version < versions[j].version
+	})
+	return versions, nil
+}
+
+func (a *AzureKeyVault) disableVersion(ctx context.Context, name, version string) error {
+	enabled := false
+	params := azsecrets.UpdateSecretParameters{SecretAttributes: &azsecrets.SecretAttributes{Enabled: &enabled}}
+	if _, err := a.client.UpdateSecret(ctx, name, version, params, nil); err != nil {
+		return fmt.Errorf("failed to disable secret version %s: %w", version, err)
+	}
+	return nil
+}
+
+func (a *AzureKeyVault) leaseSecretName(name string) string {
+	return a.secretName + "-lease-" + name
+}
+
+func isAzureNotFound(err error) bool {
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+}
+
+// ETag hashes the id, state tag, enabled flag and update time of every
+// version, so polling only lists versions instead of reading them.
+func (a *AzureKeyVault) ETag(ctx context.Context) (string, error) {
+	var parts []string
+	pager := a.client.NewListSecretVersionsPager(a.secretName, nil)
+	for pager.More() {
+		page, err := pager.NextPage(ctx)
+		if isAzureNotFound(err) {
+			return "", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to list secret versions: %w", err)
+		}
+		for _, item := range page.Value {
+			if item.ID == nil {
+				continue
+			}
+			var updated int64
+			if item.Attributes != nil && item.Attributes.Updated != nil {
+				updated = item.Attributes.Updated.UnixNano()
+			}
+			parts = append(parts, fmt.Sprintf("%s=%s,%t,%d", item.ID.Version(), tagValue(item.Tags, azureStateTag), isEnabled(item.Attributes), updated))
+		}
+	}
+	return hashETag(parts), nil
 }
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrConflict is wrapped by every ConflictError.
+var ErrConflict = errors.New("secret was changed by another writer")
+
+// ConflictError is returned by StoreIf when the latest secret is no longer the
+// one the caller expected, because another writer stored a newer one.
+type ConflictError struct {
+	// the kid the caller expected, empty if it expected no secret.
+	Expected string
+	// the kid of the latest secret found instead, empty if there is none.
+	Actual string
+}
+
+func (e *ConflictError) Error() string {
+	expected, actual := e.Expected, e.Actual
+	if expected == "" {
+		expected = "no secret"
+	}
+	if actual == "" {
+		actual = "no secret"
+	}
+	return fmt.Sprintf("%s: expected %s to be the latest secret, found %s", ErrConflict, expected, actual)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// ConditionalStorer is implemented by backends that can make a write
+// conditional on the latest secret, so a writer holding a stale keyring
+// cannot demote a secret it has never seen.
+type ConditionalStorer interface {
+	// stores secret like Store, but only if the secret GetLatest returns
+	// still has the kid expectedID, or there is no secret at all when
+	// expectedID is empty. Otherwise nothing is stored and a *ConflictError
+	// is returned.
+	StoreIf(ctx context.Context, secret *StoredSecret, expectedID string) error
+}
+
+// returns a *ConflictError unless the latest of secrets has the kid expectedID.
+func checkLatest(secrets []*StoredSecret, expectedID string) error {
+	var actual string
+	if latest := latestSecret(secrets); latest != nil {
+		actual = latest.ID
+	}
+	if actual != expectedID {
+		return &ConflictError{Expected: expectedID, Actual: actual}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// ConfigField describes one setting of a provider configuration struct.
+// Fields are declared with struct tags, for example:
+//
+//	SecretID string `config:"secretID,required" env:"SECRET_ID" label:"Secret ID"`
+type ConfigField struct {
+	// canonical key used by maps and the TUI.
+	Key string
+	// environment variable name, without any prefix.
+	Env string
+	// command line flag name.
+	Flag string
+	// human readable name shown to users.
+	Label    string
+	Required bool
+
+	index int
+}
+
+// looks up the value of a field, reporting whether it was set.
+type ConfigSource func(field ConfigField) (string, bool)
+
+// reports every required field that is missing from a provider configuration.
+type ConfigError struct {
+	Provider string
+	Missing  []ConfigField
+}
+
+func (e *ConfigError) Error() string {
+	names := make([]string, len(e.Missing))
+	for i, field := range e.Missing {
+		names[i] = fmt.Sprintf("%s (%s)", field.Label, field.Key)
+	}
+	return fmt.Sprintf("%s configuration is missing: %s", e.Provider, strings.Join(names, ", "))
+}
+
+// ConfigFields returns the fields declared on a pointer to a configuration struct.
+func ConfigFields(cfg any) []ConfigField {
+	t := reflect.TypeOf(cfg)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var fields []ConfigField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, ok := sf.Tag.Lookup("config")
+		if !ok || sf.Type.Kind() != reflect.String {
+			continue
+		}
+
+		key, opts, _ := strings.Cut(tag, ",")
+		field := ConfigField{
+			Key:      key,
+			Env:      sf.Tag.Get("env"),
+			Flag:     flagName(key),
+			Label:    sf.Tag.Get("label"),
+			Required: opts == "required",
+			index:    i,
+		}
+		if field.Label == "" {
+			field.Label = key
+		}
+		fields = append(fields, field)
+	}
+	return fields
+}
+
+// LoadConfig fills a pointer to a configuration struct from the given sources.
+// Later sources override earlier ones, so callers typically pass env first and
+// then flags or user input.
+func LoadConfig(cfg any, sources ...ConfigSource) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config must be a pointer to a struct, got %T", cfg)
+	}
+
+	for _, field := range ConfigFields(cfg) {
+		for _, source := range sources {
+			if value, ok := source(field); ok {
+				v.Elem().Field(field.index).SetString(strings.TrimSpace(value))
+			}
+		}
+	}
+	return nil
+}
+
+// ValidateConfig checks that every required field is set, reporting all missing fields at once.
+func ValidateConfig(provider string, cfg any) error {
+	v := reflect.Indirect(reflect.ValueOf(cfg))
+
+	var missing []ConfigField
+	for _, field := range ConfigFields(cfg) {
+		if field.Required && v.Field(field.index).String() == "" {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return &ConfigError{Provider: provider, Missing: missing}
+	}
+	return nil
+}
+
+// reads values keyed by ConfigField.Key.
+func MapSource(values map[string]string) ConfigSource {
+	return func(field ConfigField) (string, bool) {
+		value, ok := values[field.Key]
+		return value, ok && value != ""
+	}
+}
+
+// reads environment variables, prefix allows one process to hold several providers (e.g. "AWS_").
+func EnvSource(prefix string) ConfigSource {
+	return func(field ConfigField) (string, bool) {
+		if field.Env == "" {
+			return "", false
+		}
+		value, ok := os.LookupEnv(prefix + field.Env)
+		return value, ok && value != ""
+	}
+}
+
+// reads flags registered with BindFlags that were set explicitly on the command line.
+func FlagSource(fs *flag.FlagSet) ConfigSource {
+	set := make(map[string]string)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = f.Value.String()
+	})
+	return func(field ConfigField) (string, bool) {
+		value, ok := set[field.Flag]
+		return value, ok
+	}
+}
+
+// registers a string flag for every field of a configuration struct.
+// Flags that are already defined, for example by another provider, are skipped.
+func BindFlags(fs *flag.FlagSet, cfg any) {
+	for _, field := range ConfigFields(cfg) {
+		if fs.Lookup(field.Flag) != nil {
+			continue
+		}
+		usage := field.Label
+		if field.Env != "" {
+			usage = fmt.Sprintf("%s (env %s)", field.Label, field.Env)
+		}
+		fs.String(field.Flag, "", usage)
+	}
+}
+
+// converts a key like "secretID" to a flag name like "secret-id".
+func flagName(key string) string {
+	var b strings.Builder
+	runes := []rune(key)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevLower := i > 0 && unicode.IsLower(runes[i-1])
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1]) && i > 0 && unicode.IsUpper(runes[i-1])
+			if prevLower || nextLower {
+				b.WriteByte('-')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+)
+
+// ETagger is implemented by backends that can tell cheaply whether the stored
+// secrets changed, so processes that poll the keyring only read every secret
+// when something was written.
+type ETagger interface {
+	// returns a token that changes whenever a secret is stored, changes state
+	// or is revoked. It may also change without such a write, but equal
+	// tokens mean GetAll would return the same keyring.
+	ETag(ctx context.Context) (string, error)
+}
+
+// hashes metadata that identifies a keyring, in any order, into an etag.
+func hashETag(parts []string) string {
+	sorted := append([]string(nil), parts...)
+	sort.Strings(sorted)
+	sum := sha256.Sum256([]byte(strings.Join(sorted, "\n")))
+	return hex.EncodeToString(sum[:16])
+}
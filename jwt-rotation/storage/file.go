@@ -0,0 +1,421 @@
+package storage
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"token-toolkit/internal/fileutil"
+
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/scrypt"
+)
+
+func init() {
+	Register(NewBackend("file", "Local File", func(ctx context.Context, cfg *FileConfig) (SecretStorage, error) {
+		f := NewFileStorage()
+		if err := f.Setup(ctx, *cfg); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}))
+}
+
+// holds the settings for FileStorage. Exactly one of Passphrase or KeyFile must be set.
+type FileConfig struct {
+	Path       string `config:"path,required" env:"SECRETS_FILE" label:"File Path"`
+	Passphrase string `config:"passphrase" env:"SECRETS_PASSPHRASE" label:"Passphrase"`
+	KeyFile    string `config:"keyFile" env:"SECRETS_KEY_FILE" label:"Key File"`
+}
+
+// FileStorage keeps secrets in a local file encrypted with AES-256-GCM.
+// Writes go to a temporary file that is renamed into place, and a lock file
+// serializes access between processes.
+type FileStorage struct {
+	path     string
+	password []byte
+	keyFile  bool
+
+	mutex  sync.Mutex
+	keys   map[string][]byte
+	random io.Reader
+}
+
+// creates a new FileStorage.
+func NewFileStorage() *FileStorage {
+	return &FileStorage{keys: make(map[string][]byte), random: rand.Reader}
+}
+
+// Setup validates the configuration and reads the key file if one is given.
+func (f *FileStorage) Setup(ctx context.Context, cfg FileConfig) error {
+	if err := ValidateConfig("Local File", &cfg); err != nil {
+		return err
+	}
+
+	switch {
+	case cfg.Passphrase != "" && cfg.KeyFile != "":
+		return fmt.Errorf("local file storage takes either a passphrase or a key file, not both")
+	case cfg.Passphrase != "":
+		f.password = []byte(cfg.Passphrase)
+	case cfg.KeyFile != "":
+		key, err := os.ReadFile(cfg.KeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read key file: %w", err)
+		}
+		if len(key) < 32 {
+			return fmt.Errorf("key file must contain at least 32 bytes")
+		}
+		f.password = key
+		f.keyFile = true
+	default:
+		return &ConfigError{Provider: "Local File", Missing: []ConfigField{
+			{Key: "passphrase", Label: "Passphrase"},
+			{Key: "keyFile", Label: "Key File"},
+		}}
+	}
+
+	f.path = cfg.Path
+	return nil
+}
+
+// Store appends a secret to the file, an active secret demotes the previously active one.
+func (f *FileStorage) Store(ctx context.Context, secret *StoredSecret) error {
+	if secret == nil || secret.ID == "" {
+		return fmt.Errorf("cannot store a secret without an id")
+	}
+
+	return f.update(ctx, func(secrets []*StoredSecret) ([]*StoredSecret, error) {
+		return addSecret(secrets, secret)
+	})
+}
+
+// StoreIf adds a secret if the latest secret still has the kid expectedID,
+// checked under the same lock as the write.
+func (f *FileStorage) StoreIf(ctx context.Context, secret *StoredSecret, expectedID string) error {
+	if secret == nil || secret.ID == "" {
+		return fmt.Errorf("cannot store a secret without an id")
+	}
+
+	return f.update(ctx, func(secrets []*StoredSecret) ([]*StoredSecret, error) {
+		if err := checkLatest(secrets, expectedID); err != nil {
+			return nil, err
+		}
+		return addSecret(secrets, secret)
+	})
+}
+
+// retrieves a secret by its ID.
+func (f *FileStorage) Get(ctx context.Context, id string) (*StoredSecret, error) {
+	secrets, err := f.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range secrets {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("secret with id %s: %w", id, ErrNotFound)
+}
+
+// retrieves the active secret.
+func (f *FileStorage) GetLatest(ctx context.Context) (*StoredSecret, error) {
+	secrets, err := f.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	latest := latestSecret(secrets)
+	if latest == nil {
+		return nil, fmt.Errorf("no secrets stored in %s: %w", f.path, ErrNotFound)
+	}
+	return latest, nil
+}
+
+// changes the state of a secret in the file.
+func (f *FileStorage) SetState(ctx context.Context, id string, state SecretState) error {
+	return f.update(ctx, func(secrets []*StoredSecret) ([]*StoredSecret, error) {
+		return secrets, setState(secrets, id, state)
+	})
+}
+
+// removes a secret from the file, so its value is no longer stored anywhere.
+func (f *FileStorage) Revoke(ctx context.Context, id string) error {
+	return f.update(ctx, func(secrets []*StoredSecret) ([]*StoredSecret, error) {
+		return revoke(secrets, id)
+	})
+}
+
+// retrieves all secrets, newest first.
+func (f *FileStorage) GetAll(ctx context.Context) ([]*StoredSecret, error) {
+	secrets, err := f.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return sortedCopy(secrets), nil
+}
+
+// fileEnvelope is the on-disk format, the ciphertext holds a list of records.
+type fileEnvelope struct {
+	Version    int    `json:"v"`
+	KDF        string `json:"kdf"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+const (
+	fileVersion = 1
+	kdfScrypt   = "scrypt"
+	kdfHKDF     = "hkdf-sha256"
+	fileAAD     = "locksmith-file-storage"
+
+	// how often a busy lock file is retried until the context ends.
+	lockRetryInterval = 50 * time.Millisecond
+)
+
+// reads all secrets in storage order while holding a shared lock.
+func (f *FileStorage) read(ctx context.Context) ([]*StoredSecret, error) {
+	unlock, err := lockFile(ctx, f.path+".lock", false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	secrets, _, err := f.load()
+	return secrets, err
+}
+
+// ETag hashes the encrypted file, which is written with a fresh nonce every
+// time, so the keyring need not be decrypted to see whether it changed.
+func (f *FileStorage) ETag(ctx context.Context) (string, error) {
+	unlock, err := lockFile(ctx, f.path+".lock", false)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read secrets file: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:16]), nil
+}
+
+// applies a change to the stored secrets while holding an exclusive lock.
+func (f *FileStorage) update(ctx context.Context, change func([]*StoredSecret) ([]*StoredSecret, error)) error {
+	unlock, err := lockFile(ctx, f.path+".lock", true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	secrets, salt, err := f.load()
+	if err != nil {
+		return err
+	}
+	secrets, err = change(secrets)
+	if err != nil {
+		return err
+	}
+	return f.save(secrets, salt)
+}
+
+// reads and decrypts the file, a missing file is an empty store.
+func (f *FileStorage) load() ([]*StoredSecret, []byte, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read secrets file: %w", err)
+	}
+
+	var envelope fileEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse secrets file: %w", err)
+	}
+	if envelope.Version != fileVersion {
+		return nil, nil, fmt.Errorf("unsupported secrets file version %d", envelope.Version)
+	}
+	if envelope.KDF != f.kdf() {
+		return nil, nil, fmt.Errorf("secrets file was encrypted with %s, configure the matching passphrase or key file", envelope.KDF)
+	}
+
+	aead, err := f.cipher(envelope.Salt)
+	if err != nil {
+		return nil, nil, err
+	}
+	plaintext, err := aead.Open(nil, envelope.Nonce, envelope.Ciphertext, []byte(fileAAD))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decrypt secrets file, wrong passphrase or key file?")
+	}
+
+	var records []json.RawMessage
+	if err := json.Unmarshal(plaintext, &records); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse decrypted secrets: %w", err)
+	}
+	secrets := make([]*StoredSecret, 0, len(records))
+	for _, rec := range records {
+		secret, err := DecodeRecord(rec)
+		if err != nil {
+			return nil, nil, err
+		}
+		secrets = append(secrets, secret)
+	}
+	return secrets, envelope.Salt, nil
+}
+
+// encrypts the secrets and atomically replaces the file.
+func (f *FileStorage) save(secrets []*StoredSecret, salt []byte) error {
+	records := make([]json.RawMessage, 0, len(secrets))
+	for _, s := range secrets {
+		rec, err := EncodeRecord(s)
+		if err != nil {
+			return err
+		}
+		records = append(records, rec)
+	}
+	plaintext, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("failed to marshal secrets: %w", err)
+	}
+
+	if salt == nil {
+		salt = make([]byte, 16)
+		if _, err := io.ReadFull(f.random, salt); err != nil {
+			return fmt.Errorf("failed to generate salt: %w", err)
+		}
+	}
+	aead, err := f.cipher(salt)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(f.random, nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	data, err := json.Marshal(fileEnvelope{
+		Version:    fileVersion,
+		KDF:        f.kdf(),
+		Salt:       salt,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, []byte(fileAAD)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal secrets file: %w", err)
+	}
+	return fileutil.WriteFileAtomic(f.path, data, 0600)
+}
+
+func (f *FileStorage) kdf() string {
+	if f.keyFile {
+		return kdfHKDF
+	}
+	return kdfScrypt
+}
+
+// returns an AES-GCM cipher keyed for the given salt, caching the derived key.
+func (f *FileStorage) cipher(salt []byte) (cipher.AEAD, error) {
+	f.mutex.Lock()
+	key, ok := f.keys[string(salt)]
+	f.mutex.Unlock()
+
+	if !ok {
+		var err error
+		if f.keyFile {
+			key = make([]byte, 32)
+			_, err = io.ReadFull(hkdf.New(sha256.New, f.password, salt, []byte(fileAAD)), key)
+		} else {
+			key, err = scrypt.Key(f.password, salt, 1<<15, 8, 1, 32)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive encryption key: %w", err)
+		}
+
+		f.mutex.Lock()
+		f.keys[string(salt)] = key
+		f.mutex.Unlock()
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// AcquireLease takes a lease kept in a plain file next to the secrets file,
+// guarded by its own lock file so every process on the machine sees the same lease.
+func (f *FileStorage) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (*Lease, error) {
+	var lease *Lease
+	err := f.updateLeases(ctx, func(leases map[string]*Lease) error {
+		if err := checkLease(leases[name], holder, time.Now()); err != nil {
+			return err
+		}
+		lease = newLease(name, holder, ttl)
+		leases[name] = lease
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+// gives up a lease taken with AcquireLease.
+func (f *FileStorage) ReleaseLease(ctx context.Context, name, holder string) error {
+	return f.updateLeases(ctx, func(leases map[string]*Lease) error {
+		if lease := leases[name]; lease != nil && lease.Holder == holder {
+			delete(leases, name)
+		}
+		return nil
+	})
+}
+
+// applies a change to the lease file while holding its exclusive lock.
+// Leases only name their holders, so the file is not encrypted.
+func (f *FileStorage) updateLeases(ctx context.Context, change func(map[string]*Lease) error) error {
+	path := f.path + ".lease"
+	unlock, err := lockFile(ctx, path+".lock", true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	leases := make(map[string]*Lease)
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		return fmt.Errorf("failed to read lease file: %w", err)
+	default:
+		if err := json.Unmarshal(data, &leases); err != nil {
+			return fmt.Errorf("failed to parse lease file: %w", err)
+		}
+	}
+
+	if err := change(leases); err != nil {
+		return err
+	}
+	data, err = json.Marshal(leases)
+	if err != nil {
+		return fmt.Errorf("failed to marshal leases: %w", err)
+	}
+	return fileutil.WriteFileAtomic(path, data, 0600)
+}
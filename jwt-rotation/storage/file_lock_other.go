@@ -0,0 +1,13 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package storage
+
+import (
+	"context"
+	"errors"
+)
+
+// file locking is not available on this platform.
+func lockFile(ctx context.Context, path string, exclusive bool) (func(), error) {
+	return nil, errors.New("local file storage is not supported on this platform")
+}
@@ -0,0 +1,49 @@
+//go:build windows
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// takes a LockFileEx lock on path, retrying until it is free or ctx is done.
+func lockFile(ctx context.Context, path string, exclusive bool) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	flags := uint32(windows.LOCKFILE_FAIL_IMMEDIATELY)
+	if exclusive {
+		flags |= windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+
+	handle := windows.Handle(f.Fd())
+	for {
+		overlapped := new(windows.Overlapped)
+		err := windows.LockFileEx(handle, flags, 0, 1, 0, overlapped)
+		if err == nil {
+			return func() {
+				windows.UnlockFileEx(handle, 0, 1, 0, overlapped)
+				f.Close()
+			}, nil
+		}
+		if !errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, fmt.Errorf("timed out waiting for lock on %s: %w", path, ctx.Err())
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
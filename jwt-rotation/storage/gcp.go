@@ -2,12 +2,20 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	secretmanager "cloud.google.com/go/secretmanager/apiv1"
 	secretmanagerpb "cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
 	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
 )
 
 // GCPSecretManager implements the SecretStorage interface for GCP Secret Manager.
@@ -17,24 +25,39 @@ type GCPSecretManager struct {
 	secretID  string
 }
 
+func init() {
+	Register(NewBackend("gcp", "GCP", func(ctx context.Context, cfg *GCPConfig) (SecretStorage, error) {
+		g := NewGCPSecretManager()
+		if err := g.Setup(ctx, *cfg); err != nil {
+			return nil, err
+		}
+		return g, nil
+	}))
+}
+
 // NewGCPSecretManager creates a new GCPSecretManager.
 func NewGCPSecretManager() *GCPSecretManager {
 	return &GCPSecretManager{}
 }
 
-// Setup initializes the GCP Secret Manager client.
-func (g *GCPSecretManager) Setup(ctx context.Context, config map[string]string) error {
-	projectID, ok := config["projectID"]
-	if !ok || projectID == "" {
-		return fmt.Errorf("projectID is required for GCP Secret Manager")
-	}
-	g.projectID = projectID
+// creates a GCPSecretManager around an existing client, e.g. one pointed at a custom endpoint.
+func NewGCPSecretManagerFromClient(client *secretmanager.Client, projectID, secretID string) *GCPSecretManager {
+	return &GCPSecretManager{client: client, projectID: projectID, secretID: secretID}
+}
 
-	secretID, ok := config["secretID"]
-	if !ok || secretID == "" {
-		return fmt.Errorf("secretID is required for GCP Secret Manager")
+// holds the settings for GCPSecretManager.
+type GCPConfig struct {
+	ProjectID string `config:"projectID,required" env:"PROJECT_ID" label:"Project ID"`
+	SecretID  string `config:"secretID,required" env:"SECRET_ID" label:"Secret ID"`
+}
+
+// Setup initializes the GCP Secret Manager client.
+func (g *GCPSecretManager) Setup(ctx context.Context, cfg GCPConfig) error {
+	if err := ValidateConfig("GCP Secret Manager", &cfg); err != nil {
+		return err
 	}
-	g.secretID = secretID
+	g.projectID = cfg.ProjectID
+	g.secretID = cfg.SecretID
 
 	client, err := secretmanager.NewClient(ctx)
 	if err != nil {
@@ -44,80 +67,240 @@ func (g *GCPSecretManager) Setup(ctx context.Context, config map[string]string)
 	return nil
 }
 
-// Store adds a new secret version to an existing secret in GCP Secret Manager.
-func (g *GCPSecretManager) Store(ctx context.Context, id string, value []byte, createdAt time.Time) error {
-	parent := fmt.Sprintf("projects/%s/secrets/%s", g.projectID, g.secretID)
+// Store adds a new secret version to an existing secret in GCP Secret Manager
+// and records its kid and state on the parent secret. Storing an active secret
+// demotes the previously active one.
+func (g *GCPSecretManager) Store(ctx context.Context, secret *StoredSecret) error {
+	return g.store(ctx, secret, nil)
+}
+
+// StoreIf adds a version like Store, but indexes it only if the kid annotated
+// as active is still expectedID, checked in the same etag-conditional update.
+// A version that loses is disabled again. A secret that predates the index
+// is taken to match any expected kid.
+func (g *GCPSecretManager) StoreIf(ctx context.Context, secret *StoredSecret, expectedID string) error {
+	return g.store(ctx, secret, func(s *secretmanagerpb.Secret, number int64) error {
+		actual := activeKid(s)
+		if actual == "" && number > 1 && !hasKidAlias(s.VersionAliases) {
+			if expectedID != "" {
+				return nil
+			}
+			actual = legacyKid
+		}
+		if actual != expectedID {
+			return &ConflictError{Expected: expectedID, Actual: actual}
+		}
+		return nil
+	})
+}
+
+// adds a version and indexes it if check, when set, accepts the secret as
+// it is before the update. number is the new version's number.
+func (g *GCPSecretManager) store(ctx context.Context, secret *StoredSecret, check func(s *secretmanagerpb.Secret, number int64) error) error {
+	data, err := EncodeRecord(secret)
+	if err != nil {
+		return err
+	}
 
 	// Add a new secret version
-	_, err := g.client.AddSecretVersion(ctx, &secretmanagerpb.AddSecretVersionRequest{
-		Parent: parent,
+	version, err := g.client.AddSecretVersion(ctx, &secretmanagerpb.AddSecretVersionRequest{
+		Parent: g.secretName(),
 		Payload: &secretmanagerpb.SecretPayload{
-			Data: value,
+			Data: data,
 		},
 	})
 	if err != nil {
 		return fmt.Errorf("failed to add secret version: %w", err)
 	}
 
+	number, err := versionNumber(version.Name)
+	if err != nil {
+		return err
+	}
+
+	state := secret.State
+	if state == "" {
+		state = StateActive
+	}
+	err = g.updateIndex(ctx, func(s *secretmanagerpb.Secret) error {
+		if check != nil {
+			if err := check(s, number); err != nil {
+				return err
+			}
+		}
+		if number > 1 && !hasKidAlias(s.VersionAliases) {
+			// Keep the version that was active before the index existed in the
+			// keyring, its kid is derived from the value when it is read back.
+			s.VersionAliases[kidAlias(legacyKid)] = number - 1
+		}
+		s.VersionAliases[kidAlias(secret.ID)] = number
+		setStateAnnotation(s, secret.ID, state)
+		return nil
+	})
+	var conflict *ConflictError
+	if errors.As(err, &conflict) {
+		// Unindexed versions are still read from secrets that predate the index.
+		if _, disableErr := g.client.DisableSecretVersion(ctx, &secretmanagerpb.DisableSecretVersionRequest{Name: version.Name}); disableErr != nil {
+			return fmt.Errorf("%w, and failed to disable version %s: %v", err, version.Name, disableErr)
+		}
+	}
+	return err
+}
+
+// SetState updates the state annotation of a kid on the parent secret.
+func (g *GCPSecretManager) SetState(ctx context.Context, id string, state SecretState) error {
+	return g.updateIndex(ctx, func(s *secretmanagerpb.Secret) error {
+		if _, ok := s.VersionAliases[kidAlias(id)]; !ok {
+			return fmt.Errorf("secret with id %s: %w", id, ErrNotFound)
+		}
+		setStateAnnotation(s, id, state)
+		return nil
+	})
+}
+
+// Revoke removes a kid from the index and disables its version, so the
+// payload can no longer be accessed.
+func (g *GCPSecretManager) Revoke(ctx context.Context, id string) error {
+	var number int64
+	err := g.updateIndex(ctx, func(s *secretmanagerpb.Secret) error {
+		var ok bool
+		if number, ok = s.VersionAliases[kidAlias(id)]; !ok {
+			return fmt.Errorf("secret with id %s: %w", id, ErrNotFound)
+		}
+		if s.Annotations[stateAnnotation(id)] == string(StateActive) {
+			return fmt.Errorf("secret %s: %w", id, ErrRevokeActive)
+		}
+		delete(s.VersionAliases, kidAlias(id))
+		delete(s.Annotations, stateAnnotation(id))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s/versions/%d", g.secretName(), number)
+	if _, err := g.client.DisableSecretVersion(ctx, &secretmanagerpb.DisableSecretVersionRequest{Name: name}); err != nil {
+		return fmt.Errorf("failed to disable secret version %s: %w", name, err)
+	}
 	return nil
 }
 
-// Get retrieves a secret version by its version ID (we'll use our custom ID for this).
-// Note: GCP Secret Manager doesn't directly support getting a version by a custom ID stored in labels.
-// This implementation iterates through versions, which can be inefficient for many versions.
-func (g *GCPSecretManager) Get(ctx context.Context, id string) (*StoredSecret, error) {
-	// This is not efficient, GCP Secret Manager does not allow filtering by labels.
-	// A better approach would be to store the mapping of our ID to GCP's version number elsewhere.
-	// For this implementation, we will iterate and find the version.
-	secrets, err := g.GetAll(ctx)
+// Prune removes the given kids from the index in one update, dropping their
+// version aliases and state annotations, and disables their versions as
+// Revoke does. The active and pending kids are kept.
+func (g *GCPSecretManager) Prune(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	var numbers []int64
+	err := g.updateIndex(ctx, func(s *secretmanagerpb.Secret) error {
+		numbers = numbers[:0]
+		for _, id := range ids {
+			number, ok := s.VersionAliases[kidAlias(id)]
+			if !ok {
+				continue
+			}
+			switch SecretState(s.Annotations[stateAnnotation(id)]) {
+			case StateActive, StatePending:
+				continue
+			}
+			delete(s.VersionAliases, kidAlias(id))
+			delete(s.Annotations, stateAnnotation(id))
+			numbers = append(numbers, number)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, err
+		return err
 	}
-	for _, s := range secrets {
-		if s.ID == id {
-			return s, nil
+
+	for _, number := range numbers {
+		name := fmt.Sprintf("%s/versions/%d", g.secretName(), number)
+		if _, err := g.client.DisableSecretVersion(ctx, &secretmanagerpb.DisableSecretVersionRequest{Name: name}); err != nil {
+			return fmt.Errorf("failed to disable secret version %s: %w", name, err)
 		}
 	}
-	return nil, fmt.Errorf("secret with id %s not found", id)
+	return nil
 }
 
-// retrieves the latest version of a secret.
-func (g *GCPSecretManager) GetLatest(ctx context.Context) (*StoredSecret, error) {
-	// To get the creation time, we need to list the versions.
-	req := &secretmanagerpb.ListSecretVersionsRequest{
-		Parent:   fmt.Sprintf("projects/%s/secrets/%s", g.projectID, g.secretID),
-		PageSize: 1, // We only need the latest one
+// Get resolves the kid through its version alias, so only one payload is accessed.
+func (g *GCPSecretManager) Get(ctx context.Context, id string) (*StoredSecret, error) {
+	secret, err := g.client.GetSecret(ctx, &secretmanagerpb.GetSecretRequest{Name: g.secretName()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret: %w", err)
 	}
-	it := g.client.ListSecretVersions(ctx, req)
-	latestVersion, err := it.Next()
-	if err == iterator.Done {
-		return nil, fmt.Errorf("no secret versions found for %s", g.secretID)
+
+	if _, ok := secret.VersionAliases[kidAlias(id)]; !ok {
+		// Versions written before the kid index existed can only be found by reading them.
+		return g.findUnindexed(ctx, id)
 	}
+	return g.accessVersion(ctx, g.secretName()+"/versions/"+kidAlias(id), secret)
+}
+
+// retrieves the version annotated as active, or the latest version of a secret
+// that predates the annotations.
+func (g *GCPSecretManager) GetLatest(ctx context.Context) (*StoredSecret, error) {
+	secret, err := g.client.GetSecret(ctx, &secretmanagerpb.GetSecretRequest{Name: g.secretName()})
 	if err != nil {
-		return nil, fmt.Errorf("failed to list secret versions: %w", err)
+		return nil, fmt.Errorf("failed to get secret: %w", err)
 	}
 
-	// Now access the payload of the latest version
-	result, err := g.client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{
-		Name: latestVersion.Name,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to access latest secret version: %w", err)
+	version := "latest"
+	if id := activeKid(secret); id != "" {
+		version = kidAlias(id)
 	}
 
-	return &StoredSecret{
-		Value:     result.Payload.Data,
-		CreatedAt: latestVersion.CreateTime.AsTime(),
-	}, nil
+	latest, err := g.accessVersion(ctx, g.secretName()+"/versions/"+version, secret)
+	if status.Code(err) == codes.NotFound {
+		return nil, fmt.Errorf("no secret versions found for %s: %w", g.secretID, ErrNotFound)
+	}
+	return latest, err
 }
 
-// GetAll retrieves all versions of a secret.
+// GetAll retrieves the versions listed in the kid index, newest first.
+// Secrets that predate the index fall back to reading every enabled version.
 func (g *GCPSecretManager) GetAll(ctx context.Context) ([]*StoredSecret, error) {
-	parent := fmt.Sprintf("projects/%s/secrets/%s", g.projectID, g.secretID)
-	req := &secretmanagerpb.ListSecretVersionsRequest{
-		Parent: parent,
+	secret, err := g.client.GetSecret(ctx, &secretmanagerpb.GetSecretRequest{Name: g.secretName()})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret: %w", err)
 	}
-	it := g.client.ListSecretVersions(ctx, req)
+
+	var secrets []*StoredSecret
+	for alias := range secret.VersionAliases {
+		if !strings.HasPrefix(alias, kidAliasPrefix) {
+			continue
+		}
+		s, err := g.accessVersion(ctx, g.secretName()+"/versions/"+alias, secret)
+		if status.Code(err) == codes.FailedPrecondition {
+			// Disabled or destroyed versions are no longer part of the keyring.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, s)
+	}
+
+	if len(secrets) == 0 {
+		secrets, err = g.listUnindexed(ctx, secret)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.SliceStable(secrets, func(i, j int) bool {
+		return secrets[i].CreatedAt.After(secrets[j].CreatedAt)
+	})
+	return secrets, nil
+}
+
+// reads every enabled version, used for secrets stored before the kid index.
+func (g *GCPSecretManager) listUnindexed(ctx context.Context, secret *secretmanagerpb.Secret) ([]*StoredSecret, error) {
+	it := g.client.ListSecretVersions(ctx, &secretmanagerpb.ListSecretVersionsRequest{
+		Parent: g.secretName(),
+		Filter: "state:ENABLED",
+	})
 
 	var secrets []*StoredSecret
 	for {
@@ -129,24 +312,242 @@ func (g *GCPSecretManager) GetAll(ctx context.Context) ([]*StoredSecret, error)
 			return nil, fmt.Errorf("failed to list secret versions: %w", err)
 		}
 
-		// Access the secret payload
-		versionReq := &secretmanagerpb.AccessSecretVersionRequest{
-			Name: resp.Name,
-		}
-		result, err := g.client.AccessSecretVersion(ctx, versionReq)
+		s, err := g.accessVersion(ctx, resp.Name, secret)
 		if err != nil {
 			// Handle cases where a version might be disabled or destroyed
 			continue
 		}
+		if s.CreatedAt.IsZero() {
+			s.CreatedAt = resp.CreateTime.AsTime()
+		}
+		secrets = append(secrets, s)
+	}
+	return secrets, nil
+}
 
-		secrets = append(secrets, &StoredSecret{
-			// We can't easily get our custom ID back here without storing it in labels
-			// or having a way to map GCP's version number to our ID.
-			// Let's assume for now the secret value itself is what we need.
-			Value:     result.Payload.Data,
-			CreatedAt: resp.CreateTime.AsTime(),
+// scans unindexed versions for a kid.
+func (g *GCPSecretManager) findUnindexed(ctx context.Context, id string) (*StoredSecret, error) {
+	secrets, err := g.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range secrets {
+		if s.ID == id {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("secret with id %s: %w", id, ErrNotFound)
+}
+
+// accesses a version payload and applies the state recorded on the parent secret.
+func (g *GCPSecretManager) accessVersion(ctx context.Context, name string, secret *secretmanagerpb.Secret) (*StoredSecret, error) {
+	result, err := g.client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{
+		Name: name,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to access secret version %s: %w", name, err)
+	}
+
+	s, err := DecodeRecord(result.Payload.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode secret version %s: %w", result.Name, err)
+	}
+	if s.CreatedAt.IsZero() && s.ID == "" {
+		// Raw legacy payloads only carry their value, look up the creation time.
+		version, err := g.client.GetSecretVersion(ctx, &secretmanagerpb.GetSecretVersionRequest{Name: result.Name})
+		if err == nil {
+			s.CreatedAt = version.CreateTime.AsTime()
+		}
+	}
+	// Annotations can be updated after the payload is written, so they win over the record.
+	if state, ok := secret.Annotations[stateAnnotation(s.ID)]; ok && s.ID != "" {
+		s.State = SecretState(state)
+	}
+	return s, nil
+}
+
+// applies a change to the kid index, retrying when another writer updated the secret first.
+func (g *GCPSecretManager) updateIndex(ctx context.Context, update func(*secretmanagerpb.Secret) error) error {
+	const maxAttempts = 10
+
+	var err error
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		if attempt > 0 {
+			// Back off with jitter so concurrent writers do not keep colliding.
+			delay := time.Duration(attempt)*10*time.Millisecond + time.Duration(rand.Int63n(int64(10*time.Millisecond)))
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(delay):
+			}
+		}
+
+		var secret *secretmanagerpb.Secret
+		secret, err = g.client.GetSecret(ctx, &secretmanagerpb.GetSecretRequest{Name: g.secretName()})
+		if err != nil {
+			return fmt.Errorf("failed to get secret: %w", err)
+		}
+		if secret.VersionAliases == nil {
+			secret.VersionAliases = make(map[string]int64)
+		}
+		if secret.Annotations == nil {
+			secret.Annotations = make(map[string]string)
+		}
+		if err := update(secret); err != nil {
+			return err
+		}
+
+		_, err = g.client.UpdateSecret(ctx, &secretmanagerpb.UpdateSecretRequest{
+			Secret: &secretmanagerpb.Secret{
+				Name:           secret.Name,
+				Etag:           secret.Etag,
+				VersionAliases: secret.VersionAliases,
+				Annotations:    secret.Annotations,
+			},
+			UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"version_aliases", "annotations"}},
 		})
+		if code := status.Code(err); code != codes.Aborted && code != codes.FailedPrecondition {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update secret index: %w", err)
 	}
+	return nil
+}
 
-	return secrets, nil
+func (g *GCPSecretManager) secretName() string {
+	return fmt.Sprintf("projects/%s/secrets/%s", g.projectID, g.secretID)
+}
+
+const (
+	kidAliasPrefix        = "kid-"
+	stateAnnotationPrefix = "locksmith-state-"
+	leaseAnnotationPrefix = "locksmith-lease-"
+	legacyKid             = "legacy"
+)
+
+// records the state of a kid, demoting the active kid in the same update
+// so readers never see two active versions.
+func setStateAnnotation(s *secretmanagerpb.Secret, id string, state SecretState) {
+	if state == StateActive {
+		for key, value := range s.Annotations {
+			if strings.HasPrefix(key, stateAnnotationPrefix) && value == string(StateActive) {
+				s.Annotations[key] = string(StatePrevious)
+			}
+		}
+	}
+	s.Annotations[stateAnnotation(id)] = string(state)
+}
+
+// returns the kid annotated as active, or "" without one.
+func activeKid(s *secretmanagerpb.Secret) string {
+	for key, value := range s.Annotations {
+		id, ok := strings.CutPrefix(key, stateAnnotationPrefix)
+		if ok && value == string(StateActive) && s.VersionAliases[kidAlias(id)] != 0 {
+			return id
+		}
+	}
+	return ""
+}
+
+func hasKidAlias(aliases map[string]int64) bool {
+	for alias := range aliases {
+		if strings.HasPrefix(alias, kidAliasPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the version alias that points at the version holding a kid.
+func kidAlias(id string) string {
+	return kidAliasPrefix + id
+}
+
+// returns the annotation key holding the lifecycle state of a kid.
+func stateAnnotation(id string) string {
+	return stateAnnotationPrefix + id
+}
+
+// extracts the version number from a name like projects/p/secrets/s/versions/3.
+func versionNumber(name string) (int64, error) {
+	number, err := strconv.ParseInt(name[strings.LastIndex(name, "/")+1:], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected secret version name %q: %w", name, err)
+	}
+	return number, nil
+}
+
+// AcquireLease keeps the lease in an annotation of the secret. The update is
+// conditional on the secret's etag, so only one of two racing holders wins.
+func (g *GCPSecretManager) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (*Lease, error) {
+	var lease *Lease
+	err := g.updateIndex(ctx, func(s *secretmanagerpb.Secret) error {
+		current, err := decodeLease([]byte(s.Annotations[leaseAnnotation(name)]))
+		if err != nil {
+			return err
+		}
+		if err := checkLease(current, holder, time.Now()); err != nil {
+			return err
+		}
+
+		lease = newLease(name, holder, ttl)
+		data, err := encodeLease(lease)
+		if err != nil {
+			return err
+		}
+		s.Annotations[leaseAnnotation(name)] = string(data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lease, nil
+}
+
+// removes the lease annotation if holder still has the lease.
+func (g *GCPSecretManager) ReleaseLease(ctx context.Context, name, holder string) error {
+	return g.updateIndex(ctx, func(s *secretmanagerpb.Secret) error {
+		current, err := decodeLease([]byte(s.Annotations[leaseAnnotation(name)]))
+		if err != nil {
+			return err
+		}
+		if current != nil && current.Holder == holder {
+			delete(s.Annotations, leaseAnnotation(name))
+		}
+		return nil
+	})
+}
+
+// returns the annotation key holding a lease.
+func leaseAnnotation(name string) string {
+	return leaseAnnotationPrefix + name
+}
+
+// ETag hashes the kid aliases and state annotations of the secret, which
+// every write updates, so polling costs one GetSecret call. Leases are left
+// out, they do not change the keyring.
+func (g *GCPSecretManager) ETag(ctx context.Context) (string, error) {
+	secret, err := g.client.GetSecret(ctx, &secretmanagerpb.GetSecretRequest{Name: g.secretName()})
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret: %w", err)
+	}
+
+	var parts []string
+	for alias, number := range secret.VersionAliases {
+		if strings.HasPrefix(alias, kidAliasPrefix) {
+			parts = append(parts, fmt.Sprintf("%s=%d", alias, number))
+		}
+	}
+	for key, value := range secret.Annotations {
+		if strings.HasPrefix(key, stateAnnotationPrefix) {
+			parts = append(parts, key+"="+value)
+		}
+	}
+	if len(parts) == 0 {
+		// Without the index every version is read, its etag tracks new versions.
+		parts = append(parts, "etag="+secret.Etag)
+	}
+	return hashETag(parts), nil
 }
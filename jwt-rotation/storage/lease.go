@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrLeaseHeld is returned when another holder has a lease that has not expired.
+var ErrLeaseHeld = errors.New("lease is held by another rotator")
+
+// a claim on a named lease, which only one holder has until it expires.
+type Lease struct {
+	Name      string    `json:"name"`
+	Holder    string    `json:"holder"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Leaser is implemented by backends that can keep a lease next to the secrets,
+// so that rotators in different processes take turns. Expiry is judged by
+// each caller's clock, so TTLs should be well above the expected clock skew.
+type Leaser interface {
+	// takes the named lease for holder until ttl has passed. A lease the
+	// holder already has is renewed and an expired lease is taken over; a
+	// lease another holder still has fails with an error wrapping ErrLeaseHeld.
+	AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (*Lease, error)
+	// gives the lease up, doing nothing if holder no longer has it.
+	ReleaseLease(ctx context.Context, name, holder string) error
+}
+
+// returns an error wrapping ErrLeaseHeld if current keeps holder from taking the lease at now.
+func checkLease(current *Lease, holder string, now time.Time) error {
+	if current == nil || current.Holder == holder || !now.Before(current.ExpiresAt) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s holds %s until %s", ErrLeaseHeld, current.Holder, current.Name, current.ExpiresAt.UTC().Format(time.RFC3339))
+}
+
+func newLease(name, holder string, ttl time.Duration) *Lease {
+	return &Lease{Name: name, Holder: holder, ExpiresAt: time.Now().Add(ttl)}
+}
+
+// decodes a lease written by encodeLease, empty data means no lease.
+func decodeLease(data []byte) (*Lease, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var lease Lease
+	if err := json.Unmarshal(data, &lease); err != nil {
+		return nil, fmt.Errorf("failed to parse lease: %w", err)
+	}
+	return &lease, nil
+}
+
+func encodeLease(lease *Lease) ([]byte, error) {
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal lease: %w", err)
+	}
+	return data, nil
+}
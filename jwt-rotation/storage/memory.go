@@ -0,0 +1,307 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+func init() {
+	Register(NewBackend("memory", "In-Memory", func(ctx context.Context, cfg *MemoryConfig) (SecretStorage, error) {
+		return NewMemoryStorage(), nil
+	}))
+}
+
+// MemoryConfig has no settings, it only exists so the backend can be registered.
+type MemoryConfig struct{}
+
+// MemoryStorage keeps secrets in process memory.
+// It is meant for local development and tests, everything is lost on exit.
+type MemoryStorage struct {
+	mutex   sync.RWMutex
+	secrets []*StoredSecret
+	leases  map[string]*Lease
+	// counts writes to secrets, reported by ETag.
+	generation uint64
+}
+
+// creates an empty MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{}
+}
+
+// Store adds a secret, an active secret demotes the previously active one.
+func (m *MemoryStorage) Store(ctx context.Context, secret *StoredSecret) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if secret == nil || secret.ID == "" {
+		return fmt.Errorf("cannot store a secret without an id")
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	secrets, err := addSecret(m.secrets, secret)
+	if err != nil {
+		return err
+	}
+	m.secrets = secrets
+	m.generation++
+	return nil
+}
+
+// StoreIf adds a secret if the latest secret still has the kid expectedID.
+func (m *MemoryStorage) StoreIf(ctx context.Context, secret *StoredSecret, expectedID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if secret == nil || secret.ID == "" {
+		return fmt.Errorf("cannot store a secret without an id")
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := checkLatest(m.secrets, expectedID); err != nil {
+		return err
+	}
+	secrets, err := addSecret(m.secrets, secret)
+	if err != nil {
+		return err
+	}
+	m.secrets = secrets
+	m.generation++
+	return nil
+}
+
+// retrieves a secret by its ID.
+func (m *MemoryStorage) Get(ctx context.Context, id string) (*StoredSecret, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, s := range m.secrets {
+		if s.ID == id {
+			return copySecret(s), nil
+		}
+	}
+	return nil, fmt.Errorf("secret with id %s: %w", id, ErrNotFound)
+}
+
+// retrieves the active secret.
+func (m *MemoryStorage) GetLatest(ctx context.Context) (*StoredSecret, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	latest := latestSecret(m.secrets)
+	if latest == nil {
+		return nil, fmt.Errorf("no secrets stored: %w", ErrNotFound)
+	}
+	return copySecret(latest), nil
+}
+
+// retrieves all secrets, newest first.
+func (m *MemoryStorage) GetAll(ctx context.Context) ([]*StoredSecret, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return sortedCopy(m.secrets), nil
+}
+
+// changes the state of a secret.
+func (m *MemoryStorage) SetState(ctx context.Context, id string, state SecretState) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := setState(m.secrets, id, state); err != nil {
+		return err
+	}
+	m.generation++
+	return nil
+}
+
+// destroys a secret.
+func (m *MemoryStorage) Revoke(ctx context.Context, id string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	secrets, err := revoke(m.secrets, id)
+	if err != nil {
+		return err
+	}
+	m.secrets = secrets
+	m.generation++
+	return nil
+}
+
+// returns the number of writes so far.
+func (m *MemoryStorage) ETag(ctx context.Context) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return strconv.FormatUint(m.generation, 10), nil
+}
+
+// returns the active secret, falling back to the most recently stored one.
+func latestSecret(secrets []*StoredSecret) *StoredSecret {
+	for i := len(secrets) - 1; i >= 0; i-- {
+		if secrets[i].State == StateActive {
+			return secrets[i]
+		}
+	}
+	if len(secrets) == 0 {
+		return nil
+	}
+	return secrets[len(secrets)-1]
+}
+
+// sets the state of the secret with the given id, demoting the active secret
+// if another one becomes active.
+func setState(secrets []*StoredSecret, id string, state SecretState) error {
+	var target *StoredSecret
+	for _, s := range secrets {
+		if s.ID == id {
+			target = s
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("secret with id %s: %w", id, ErrNotFound)
+	}
+
+	if state == StateActive {
+		for _, s := range secrets {
+			if s != target && s.State == StateActive {
+				s.State = StatePrevious
+			}
+		}
+	}
+	target.State = state
+	return nil
+}
+
+// removes the secret with the given id, which must not be active.
+func revoke(secrets []*StoredSecret, id string) ([]*StoredSecret, error) {
+	kept := make([]*StoredSecret, 0, len(secrets))
+	found := false
+	for _, s := range secrets {
+		if s.ID != id {
+			kept = append(kept, s)
+			continue
+		}
+		if s.State == StateActive {
+			return nil, fmt.Errorf("secret %s: %w", id, ErrRevokeActive)
+		}
+		found = true
+	}
+	if !found {
+		return nil, fmt.Errorf("secret with id %s: %w", id, ErrNotFound)
+	}
+	return kept, nil
+}
+
+// appends a copy of secret unless its kid is taken.
+func addSecret(secrets []*StoredSecret, secret *StoredSecret) ([]*StoredSecret, error) {
+	for _, s := range secrets {
+		if s.ID == secret.ID {
+			return nil, fmt.Errorf("secret with id %s already exists", secret.ID)
+		}
+	}
+	return appendSecret(secrets, secret), nil
+}
+
+// appends a copy of secret, demoting the current active secret if the new one is active.
+func appendSecret(secrets []*StoredSecret, secret *StoredSecret) []*StoredSecret {
+	stored := copySecret(secret)
+	if stored.State == "" {
+		stored.State = StateActive
+	}
+	if stored.State == StateActive {
+		for _, s := range secrets {
+			if s.State == StateActive {
+				s.State = StatePrevious
+			}
+		}
+	}
+	return append(secrets, stored)
+}
+
+// returns copies of secrets ordered newest first.
+func sortedCopy(secrets []*StoredSecret) []*StoredSecret {
+	all := make([]*StoredSecret, len(secrets))
+	for i, s := range secrets {
+		all[i] = copySecret(s)
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].CreatedAt.After(all[j].CreatedAt)
+	})
+	return all
+}
+
+func copySecret(s *StoredSecret) *StoredSecret {
+	c := *s
+	c.Value = append([]byte(nil), s.Value...)
+	return &c
+}
+
+// AcquireLease takes a lease held in memory, which only coordinates rotators in this process.
+func (m *MemoryStorage) AcquireLease(ctx context.Context, name, holder string, ttl time.Duration) (*Lease, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if err := checkLease(m.leases[name], holder, time.Now()); err != nil {
+		return nil, err
+	}
+	if m.leases == nil {
+		m.leases = make(map[string]*Lease)
+	}
+	lease := newLease(name, holder, ttl)
+	m.leases[name] = lease
+	copied := *lease
+	return &copied, nil
+}
+
+// gives up a lease taken with AcquireLease.
+func (m *MemoryStorage) ReleaseLease(ctx context.Context, name, holder string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if lease := m.leases[name]; lease != nil && lease.Holder == holder {
+		delete(m.leases, name)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package storage
+
+import "context"
+
+// Pruner is implemented by backends that keep metadata for every secret they
+// ever stored and read all of it back in GetAll, so secrets whose grace
+// period has ended have to be retired for the keyring to stay bounded.
+type Pruner interface {
+	// retires the secrets with the given kids so GetAll no longer returns
+	// them. Kids that are unknown or already pruned are skipped, and the
+	// active secret is never pruned.
+	Prune(ctx context.Context, ids []string) error
+}
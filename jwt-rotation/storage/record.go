@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// RecordVersion is the version of the record format written by this package.
+const RecordVersion = 1
+
+// RecordContentType identifies a payload encoded with EncodeRecord.
+const RecordContentType = "application/vnd.locksmith.secret+json"
+
+// describes where a secret is in its rotation lifecycle.
+type SecretState string
+
+const (
+	// the secret currently used for signing.
+	StateActive SecretState = "active"
+	// a secret that was rotated out and is only kept for validation.
+	StatePrevious SecretState = "previous"
+	// a secret published for validation ahead of being promoted to active.
+	StatePending SecretState = "pending"
+)
+
+// record is the envelope persisted by every backend.
+type record struct {
+	Version   int         `json:"v"`
+	ID        string      `json:"kid"`
+	Value     []byte      `json:"value"`
+	CreatedAt time.Time   `json:"createdAt"`
+	State     SecretState `json:"state,omitempty"`
+}
+
+// legacyRecord is the untagged StoredSecret JSON written by older AWS deployments.
+type legacyRecord struct {
+	ID        string    `json:"ID"`
+	Value     []byte    `json:"Value"`
+	CreatedAt time.Time `json:"CreatedAt"`
+}
+
+// EncodeRecord serializes a secret into the versioned record format.
+func EncodeRecord(secret *StoredSecret) ([]byte, error) {
+	if secret == nil {
+		return nil, fmt.Errorf("cannot encode a nil secret")
+	}
+	if secret.ID == "" {
+		return nil, fmt.Errorf("cannot encode a secret without an id")
+	}
+
+	data, err := json.Marshal(record{
+		Version:   RecordVersion,
+		ID:        secret.ID,
+		Value:     secret.Value,
+		CreatedAt: secret.CreatedAt.UTC(),
+		State:     secret.State,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal secret record: %w", err)
+	}
+	return data, nil
+}
+
+// DecodeRecord parses a payload written by EncodeRecord.
+// Payloads written before the record format existed are still accepted: the
+// legacy AWS JSON keeps its ID, while raw secret bytes come back with an empty
+// ID and zero CreatedAt so callers can fill them from backend metadata.
+func DecodeRecord(data []byte) (*StoredSecret, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '{' || !json.Valid(trimmed) {
+		return &StoredSecret{Value: data}, nil
+	}
+
+	var probe struct {
+		Version *int `json:"v"`
+	}
+	if err := json.Unmarshal(trimmed, &probe); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret record: %w", err)
+	}
+
+	if probe.Version == nil {
+		var legacy legacyRecord
+		if err := json.Unmarshal(trimmed, &legacy); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal legacy secret record: %w", err)
+		}
+		if legacy.Value == nil {
+			// Valid JSON that isn't one of ours, treat it as an opaque value.
+			return &StoredSecret{Value: data}, nil
+		}
+		return &StoredSecret{
+			ID:        legacy.ID,
+			Value:     legacy.Value,
+			CreatedAt: legacy.CreatedAt,
+		}, nil
+	}
+
+	if *probe.Version > RecordVersion {
+		return nil, fmt.Errorf("unsupported secret record version %d", *probe.Version)
+	}
+
+	var rec record
+	if err := json.Unmarshal(trimmed, &rec); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal secret record: %w", err)
+	}
+	return &StoredSecret{
+		ID:        rec.ID,
+		Value:     rec.Value,
+		CreatedAt: rec.CreatedAt,
+		State:     rec.State,
+	}, nil
+}
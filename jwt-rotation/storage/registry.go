@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Backend describes a storage provider that can be selected by name.
+// Built-in providers register themselves in init, plugins can do the same
+// from their own package.
+type Backend struct {
+	// identifier used on the command line and in env vars, e.g. "aws".
+	Name string
+	// name shown in the TUI, e.g. "AWS".
+	DisplayName string
+	// returns a pointer to an empty configuration struct, which also serves as the schema.
+	NewConfig func() any
+	// creates a ready to use backend from a configuration returned by NewConfig.
+	Open func(ctx context.Context, cfg any) (SecretStorage, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	backends   []Backend
+)
+
+// NewBackend builds a Backend around a typed configuration struct.
+func NewBackend[C any](name, displayName string, open func(ctx context.Context, cfg *C) (SecretStorage, error)) Backend {
+	return Backend{
+		Name:        name,
+		DisplayName: displayName,
+		NewConfig:   func() any { return new(C) },
+		Open: func(ctx context.Context, cfg any) (SecretStorage, error) {
+			typed, ok := cfg.(*C)
+			if !ok {
+				return nil, fmt.Errorf("%s: unexpected configuration type %T", name, cfg)
+			}
+			return open(ctx, typed)
+		},
+	}
+}
+
+// Register makes a backend available to Lookup and Open.
+// It panics if a backend with the same name is already registered.
+func Register(b Backend) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if b.Name == "" || b.NewConfig == nil || b.Open == nil {
+		panic("storage: Register called with an incomplete backend")
+	}
+	if b.DisplayName == "" {
+		b.DisplayName = b.Name
+	}
+	for _, existing := range backends {
+		if strings.EqualFold(existing.Name, b.Name) {
+			panic("storage: Register called twice for backend " + b.Name)
+		}
+	}
+	backends = append(backends, b)
+}
+
+// returns every registered backend in registration order.
+func Backends() []Backend {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	return append([]Backend(nil), backends...)
+}
+
+// Lookup finds a backend by its name or display name, ignoring case.
+func Lookup(name string) (Backend, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	for _, b := range backends {
+		if strings.EqualFold(b.Name, name) || strings.EqualFold(b.DisplayName, name) {
+			return b, true
+		}
+	}
+	return Backend{}, false
+}
+
+// Open loads the configuration of the named backend from the given sources
+// and returns the configured storage.
+func Open(ctx context.Context, name string, sources ...ConfigSource) (SecretStorage, error) {
+	b, ok := Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("unsupported storage provider: %q", name)
+	}
+
+	cfg := b.NewConfig()
+	if err := LoadConfig(cfg, sources...); err != nil {
+		return nil, err
+	}
+	return b.Open(ctx, cfg)
+}
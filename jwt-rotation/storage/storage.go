@@ -2,26 +2,41 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
+var (
+	// ErrNotFound is returned when a backend has no secret with the requested ID.
+	ErrNotFound = errors.New("secret not found")
+	// ErrRevokeActive is returned when revoking the secret that is currently active.
+	ErrRevokeActive = errors.New("the active secret cannot be revoked")
+)
+
 // represents a secret stored in the backend.
 type StoredSecret struct {
 	ID        string
 	Value     []byte
 	CreatedAt time.Time
+	State     SecretState
 }
 
 // defines the interface for storing and retrieving secrets.
+// Each backend is configured through its own typed Setup before use.
 type SecretStorage interface {
-	// configures the storage provider.
-	Setup(ctx context.Context, config map[string]string) error
 	// stores a new secret.
-	Store(ctx context.Context, id string, value []byte, createdAt time.Time) error
+	Store(ctx context.Context, secret *StoredSecret) error
 	// retrieves a secret by its ID.
 	Get(ctx context.Context, id string) (*StoredSecret, error)
-	// retrieves the most recently stored secret.
+	// retrieves the active secret, or the most recently stored one if none is marked active.
 	GetLatest(ctx context.Context) (*StoredSecret, error)
 	// retrieves all secrets for token validation.
 	GetAll(ctx context.Context) ([]*StoredSecret, error)
+	// changes the lifecycle state of a stored secret. Making a secret
+	// active demotes the previously active one to previous.
+	SetState(ctx context.Context, id string, state SecretState) error
+	// disables or destroys a secret so it is no longer returned by Get or
+	// GetAll. The active secret cannot be revoked, another one has to be
+	// made active first.
+	Revoke(ctx context.Context, id string) error
 }
@@ -0,0 +1,39 @@
+package storage_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"token-toolkit/jwt-rotation/storage"
+	"token-toolkit/jwt-rotation/storage/storagetest"
+)
+
+func TestMemory(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.SecretStorage {
+		return storage.NewMemoryStorage()
+	})
+}
+
+func TestFile(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.SecretStorage {
+		f := storage.NewFileStorage()
+		cfg := storage.FileConfig{Path: filepath.Join(t.TempDir(), "secrets.enc"), Passphrase: "conformance"}
+		if err := f.Setup(context.Background(), cfg); err != nil {
+			t.Fatalf("setup file storage: %v", err)
+		}
+		return f
+	})
+}
+
+func TestAWS(t *testing.T) {
+	storagetest.Run(t, storagetest.NewFakeAWS)
+}
+
+func TestGCP(t *testing.T) {
+	storagetest.Run(t, storagetest.NewFakeGCP)
+}
+
+func TestAzure(t *testing.T) {
+	storagetest.Run(t, storagetest.NewFakeAzure)
+}
@@ -0,0 +1,305 @@
+package storagetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+
+	"token-toolkit/jwt-rotation/storage"
+)
+
+// NewFakeAWS returns an AWSSecretsManager connected to an in-process HTTP
+// server that speaks the Secrets Manager JSON protocol for the operations
+// the backend uses. The server holds a single empty secret and is closed
+// when the test ends.
+func NewFakeAWS(t *testing.T) storage.SecretStorage {
+	t.Helper()
+
+	const secretID = "test-secret"
+	fake := &fakeAWS{name: secretID}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	client := secretsmanager.New(secretsmanager.Options{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		Credentials:  aws.AnonymousCredentials{},
+		HTTPClient:   server.Client(),
+	})
+	s := storage.NewAWSSecretsManagerFromClient(client, secretID)
+	fakeAWSBackends.Store(s, fake)
+	t.Cleanup(func() { fakeAWSBackends.Delete(s) })
+	return s
+}
+
+// the fakes behind the backends NewFakeAWS returned.
+var fakeAWSBackends sync.Map
+
+// StartAWSRotation stages a new version labelled AWSPENDING on a backend
+// returned by NewFakeAWS and enables rotation, as RotateSecret does before it
+// invokes the rotation function with versionID as the ClientRequestToken.
+func StartAWSRotation(t *testing.T, s storage.SecretStorage, versionID string) {
+	t.Helper()
+	fake, ok := fakeAWSBackends.Load(s)
+	if !ok {
+		t.Fatal("StartAWSRotation needs a backend returned by NewFakeAWS")
+	}
+	f := fake.(*fakeAWS)
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if err := f.startRotation(versionID); err != nil {
+		t.Fatalf("failed to start rotation: %v", err)
+	}
+}
+
+// fakeAWS keeps one secret and its versions in memory.
+type fakeAWS struct {
+	mutex           sync.Mutex
+	name            string
+	versions        []*fakeAWSVersion
+	rotationEnabled bool
+}
+
+type fakeAWSVersion struct {
+	id      string
+	value   *string
+	stages  []string
+	created time.Time
+}
+
+// awsError is rendered the way the JSON 1.1 protocol reports modeled errors.
+type awsError struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+}
+
+func (e *awsError) Error() string { return e.Type + ": " + e.Message }
+
+func (f *fakeAWS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	operation := strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "secretsmanager.")
+
+	var req struct {
+		SecretId            string
+		SecretString        *string
+		SecretBinary        []byte
+		ClientRequestToken  string
+		VersionStages       []string
+		VersionId           string
+		VersionStage        string
+		IncludeDeprecated   bool
+		RemoveFromVersionId string
+		MoveToVersionId     string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeAWS(w, nil, &awsError{"InvalidRequestException", err.Error()})
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if req.SecretId != f.name {
+		writeAWS(w, nil, &awsError{"ResourceNotFoundException", "Secrets Manager can't find the specified secret."})
+		return
+	}
+
+	switch operation {
+	case "PutSecretValue":
+		if req.SecretString == nil {
+			writeAWS(w, nil, &awsError{"InvalidParameterException", "only SecretString is supported by the fake"})
+			return
+		}
+		stages := req.VersionStages
+		if len(stages) == 0 {
+			stages = []string{"AWSCURRENT"}
+		}
+		// A version staged by RotateSecret receives its value here.
+		version := f.byID(req.ClientRequestToken)
+		if version == nil || req.ClientRequestToken == "" {
+			version = f.newVersion(req.ClientRequestToken)
+		} else if version.value != nil {
+			writeAWS(w, nil, &awsError{"ResourceExistsException", "a version with this ClientRequestToken already exists"})
+			return
+		}
+		version.value = req.SecretString
+		for _, stage := range stages {
+			f.moveStage(stage, version)
+		}
+		writeAWS(w, map[string]any{"ARN": f.name, "Name": f.name, "VersionId": version.id, "VersionStages": version.stages}, nil)
+
+	case "GetSecretValue":
+		var version *fakeAWSVersion
+		switch {
+		case req.VersionId != "":
+			version = f.byID(req.VersionId)
+		case req.VersionStage != "":
+			version = f.byStage(req.VersionStage)
+		default:
+			version = f.byStage("AWSCURRENT")
+		}
+		if version == nil || version.value == nil {
+			writeAWS(w, nil, &awsError{"ResourceNotFoundException", "Secrets Manager can't find the specified secret value."})
+			return
+		}
+		writeAWS(w, map[string]any{
+			"ARN":           f.name,
+			"Name":          f.name,
+			"VersionId":     version.id,
+			"SecretString":  *version.value,
+			"VersionStages": version.stages,
+			"CreatedDate":   float64(version.created.UnixNano()) / 1e9,
+		}, nil)
+
+	case "ListSecretVersionIds":
+		versions := []map[string]any{}
+		for i := len(f.versions) - 1; i >= 0; i-- {
+			version := f.versions[i]
+			if len(version.stages) == 0 && !req.IncludeDeprecated {
+				continue
+			}
+			versions = append(versions, map[string]any{
+				"VersionId":     version.id,
+				"VersionStages": version.stages,
+				"CreatedDate":   float64(version.created.UnixNano()) / 1e9,
+			})
+		}
+		writeAWS(w, map[string]any{"ARN": f.name, "Name": f.name, "Versions": versions}, nil)
+
+	case "UpdateSecretVersionStage":
+		if req.RemoveFromVersionId != "" {
+			current := f.byStage(req.VersionStage)
+			if current == nil || current.id != req.RemoveFromVersionId {
+				writeAWS(w, nil, &awsError{"InvalidParameterException", fmt.Sprintf("the staging label %s is not attached to version %s", req.VersionStage, req.RemoveFromVersionId)})
+				return
+			}
+		}
+		// Secrets Manager refuses to take a label from a version the caller did not name.
+		if current := f.byStage(req.VersionStage); req.MoveToVersionId != "" && req.RemoveFromVersionId == "" && current != nil && current.id != req.MoveToVersionId {
+			writeAWS(w, nil, &awsError{"InvalidParameterException", fmt.Sprintf("the staging label %s is attached to version %s, which must be named in RemoveFromVersionId", req.VersionStage, current.id)})
+			return
+		}
+		if req.MoveToVersionId == "" {
+			if version := f.byStage(req.VersionStage); version != nil {
+				version.stages = without(version.stages, req.VersionStage)
+			}
+		} else {
+			version := f.byID(req.MoveToVersionId)
+			if version == nil {
+				writeAWS(w, nil, &awsError{"ResourceNotFoundException", "Secrets Manager can't find the specified secret version."})
+				return
+			}
+			f.moveStage(req.VersionStage, version)
+		}
+		writeAWS(w, map[string]any{"ARN": f.name, "Name": f.name}, nil)
+
+	case "DescribeSecret":
+		stages := map[string][]string{}
+		for _, version := range f.versions {
+			if len(version.stages) > 0 {
+				stages[version.id] = version.stages
+			}
+		}
+		writeAWS(w, map[string]any{"ARN": f.name, "Name": f.name, "RotationEnabled": f.rotationEnabled, "VersionIdsToStages": stages}, nil)
+
+	case "RotateSecret":
+		if err := f.startRotation(req.ClientRequestToken); err != nil {
+			writeAWS(w, nil, err)
+			return
+		}
+		writeAWS(w, map[string]any{"ARN": f.name, "Name": f.name, "VersionId": req.ClientRequestToken}, nil)
+
+	default:
+		writeAWS(w, nil, &awsError{"InvalidRequestException", "operation " + operation + " is not supported by the fake"})
+	}
+}
+
+// stages the new version like Secrets Manager does before invoking the
+// rotation function, the caller then runs the steps itself.
+func (f *fakeAWS) startRotation(versionID string) *awsError {
+	if pending := f.byStage("AWSPENDING"); pending != nil {
+		return &awsError{"InvalidRequestException", "a previous rotation isn't complete"}
+	}
+	if versionID == "" || f.byID(versionID) != nil {
+		return &awsError{"InvalidParameterException", "a new ClientRequestToken is required by the fake"}
+	}
+	f.rotationEnabled = true
+	f.moveStage("AWSPENDING", f.newVersion(versionID))
+	return nil
+}
+
+// attaches a staging label to version, moving AWSCURRENT also moves AWSPREVIOUS.
+func (f *fakeAWS) moveStage(stage string, version *fakeAWSVersion) {
+	previous := f.byStage(stage)
+	if previous == version {
+		return
+	}
+	if previous != nil {
+		previous.stages = without(previous.stages, stage)
+		if stage == "AWSCURRENT" {
+			if old := f.byStage("AWSPREVIOUS"); old != nil {
+				old.stages = without(old.stages, "AWSPREVIOUS")
+			}
+			previous.stages = append(previous.stages, "AWSPREVIOUS")
+		}
+	}
+	version.stages = append(version.stages, stage)
+}
+
+// appends a version without a value, an empty id is generated.
+func (f *fakeAWS) newVersion(id string) *fakeAWSVersion {
+	if id == "" {
+		id = fmt.Sprintf("version-%d", len(f.versions)+1)
+	}
+	version := &fakeAWSVersion{id: id, created: time.Now()}
+	f.versions = append(f.versions, version)
+	return version
+}
+
+func (f *fakeAWS) byID(id string) *fakeAWSVersion {
+	for _, version := range f.versions {
+		if version.id == id {
+			return version
+		}
+	}
+	return nil
+}
+
+func (f *fakeAWS) byStage(stage string) *fakeAWSVersion {
+	for _, version := range f.versions {
+		for _, s := range version.stages {
+			if s == stage {
+				return version
+			}
+		}
+	}
+	return nil
+}
+
+func without(stages []string, stage string) []string {
+	kept := stages[:0:0]
+	for _, s := range stages {
+		if s != stage {
+			kept = append(kept, s)
+		}
+	}
+	return kept
+}
+
+func writeAWS(w http.ResponseWriter, body any, err *awsError) {
+	w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+	if err != nil {
+		w.Header().Set("X-Amzn-ErrorType", err.Type)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(err)
+		return
+	}
+	json.NewEncoder(w).Encode(body)
+}
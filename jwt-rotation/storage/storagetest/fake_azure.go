@@ -0,0 +1,217 @@
+package storagetest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/keyvault/azsecrets"
+
+	"token-toolkit/jwt-rotation/storage"
+)
+
+// NewFakeAzure returns an AzureKeyVault connected to an in-process HTTPS
+// server that implements the Key Vault REST calls the backend uses,
+// including the bearer challenge the client expects on its first request.
+// The server is closed when the test ends.
+func NewFakeAzure(t *testing.T) storage.SecretStorage {
+	t.Helper()
+
+	const secretName = "test-secret"
+	fake := &fakeAzure{}
+	server := httptest.NewTLSServer(fake)
+	t.Cleanup(server.Close)
+	fake.vaultURL = server.URL
+
+	client, err := azsecrets.NewClient(server.URL, fakeCredential{}, &azsecrets.ClientOptions{
+		ClientOptions: policy.ClientOptions{
+			Transport: server.Client(),
+			Retry:     policy.RetryOptions{MaxRetries: -1},
+		},
+		DisableChallengeResourceVerification: true,
+	})
+	if err != nil {
+		t.Fatalf("failed to create key vault client: %v", err)
+	}
+
+	// The client resolves the auth challenge on its first request without
+	// locking, so complete it before the suite issues concurrent calls.
+	if _, err := client.NewListSecretVersionsPager(secretName, nil).NextPage(context.Background()); err != nil {
+		t.Fatalf("failed to authenticate against the fake key vault: %v", err)
+	}
+	s := storage.NewAzureKeyVaultFromClient(client, secretName)
+	registerWriteFailer(t, s, fake)
+	return s
+}
+
+// fakeCredential hands out a static token accepted by fakeAzure.
+type fakeCredential struct{}
+
+func (fakeCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "fake-token", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+// fakeAzure keeps the versions of every secret in memory, oldest first.
+type fakeAzure struct {
+	vaultURL string
+
+	mutex   sync.Mutex
+	counter int
+	secrets map[string][]*azsecrets.SecretBundle
+	// counts down the writes until one fails, 0 when none should.
+	failAt int
+}
+
+func (f *fakeAzure) failWrite(n int) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.failAt = n
+}
+
+func (f *fakeAzure) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer fake-token" {
+		w.Header().Set("WWW-Authenticate", `Bearer authorization="https://login.microsoftonline.com/tenant", resource="https://vault.azure.net"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// Paths look like /secrets/{name}, /secrets/{name}/versions or /secrets/{name}/{version}.
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "secrets" {
+		writeAzureError(w, http.StatusBadRequest, "BadParameter", "unsupported path "+r.URL.Path)
+		return
+	}
+	name := parts[1]
+	version := ""
+	if len(parts) > 2 {
+		version = parts[2]
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if (r.Method == http.MethodPut || r.Method == http.MethodPatch) && f.failAt > 0 {
+		f.failAt--
+		if f.failAt == 0 {
+			writeAzureError(w, http.StatusInternalServerError, "InternalError", "injected write failure")
+			return
+		}
+	}
+
+	switch {
+	case r.Method == http.MethodPut && len(parts) == 2:
+		var params azsecrets.SetSecretParameters
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			writeAzureError(w, http.StatusBadRequest, "BadParameter", err.Error())
+			return
+		}
+		writeAzure(w, f.set(name, params))
+
+	case r.Method == http.MethodGet && version == "versions":
+		result := azsecrets.SecretListResult{Value: []*azsecrets.SecretItem{}}
+		for _, bundle := range f.secrets[name] {
+			result.Value = append(result.Value, &azsecrets.SecretItem{
+				Attributes:  bundle.Attributes,
+				ContentType: bundle.ContentType,
+				ID:          bundle.ID,
+				Tags:        bundle.Tags,
+			})
+		}
+		writeAzure(w, result)
+
+	case r.Method == http.MethodGet:
+		bundle := f.find(name, version)
+		if bundle == nil {
+			writeAzureError(w, http.StatusNotFound, "SecretNotFound", fmt.Sprintf("A secret with (name/id) %s/%s was not found in this key vault.", name, version))
+			return
+		}
+		if bundle.Attributes.Enabled != nil && !*bundle.Attributes.Enabled {
+			writeAzureError(w, http.StatusForbidden, "Forbidden", "Operation get is not allowed on a disabled secret.")
+			return
+		}
+		writeAzure(w, bundle)
+
+	case r.Method == http.MethodPatch && version != "":
+		bundle := f.find(name, version)
+		if bundle == nil {
+			writeAzureError(w, http.StatusNotFound, "SecretNotFound", fmt.Sprintf("A secret with (name/id) %s/%s was not found in this key vault.", name, version))
+			return
+		}
+		var params azsecrets.UpdateSecretParameters
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			writeAzureError(w, http.StatusBadRequest, "BadParameter", err.Error())
+			return
+		}
+		if params.ContentType != nil {
+			bundle.ContentType = params.ContentType
+		}
+		if params.Tags != nil {
+			bundle.Tags = params.Tags
+		}
+		if params.SecretAttributes != nil && params.SecretAttributes.Enabled != nil {
+			bundle.Attributes.Enabled = params.SecretAttributes.Enabled
+		}
+		updated := time.Now().UTC().Truncate(time.Second)
+		bundle.Attributes.Updated = &updated
+		writeAzure(w, bundle)
+
+	default:
+		writeAzureError(w, http.StatusMethodNotAllowed, "BadParameter", r.Method+" "+r.URL.Path+" is not supported by the fake")
+	}
+}
+
+// adds a new version of a secret.
+func (f *fakeAzure) set(name string, params azsecrets.SetSecretParameters) *azsecrets.SecretBundle {
+	if f.secrets == nil {
+		f.secrets = make(map[string][]*azsecrets.SecretBundle)
+	}
+	f.counter++
+	id := azsecrets.ID(fmt.Sprintf("%s/secrets/%s/%032x", f.vaultURL, name, f.counter))
+	enabled := true
+	now := time.Now().UTC().Truncate(time.Second)
+	bundle := &azsecrets.SecretBundle{
+		Attributes:  &azsecrets.SecretAttributes{Enabled: &enabled, Created: &now, Updated: &now},
+		ContentType: params.ContentType,
+		ID:          &id,
+		Tags:        params.Tags,
+		Value:       params.Value,
+	}
+	f.secrets[name] = append(f.secrets[name], bundle)
+	return bundle
+}
+
+// finds a version of a secret, an empty version means the latest one.
+func (f *fakeAzure) find(name, version string) *azsecrets.SecretBundle {
+	versions := f.secrets[name]
+	if version == "" {
+		if len(versions) == 0 {
+			return nil
+		}
+		return versions[len(versions)-1]
+	}
+	for _, bundle := range versions {
+		if bundle.ID.Version() == version {
+			return bundle
+		}
+	}
+	return nil
+}
+
+func writeAzure(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeAzureError(w http.ResponseWriter, statusCode int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]any{"error": map[string]string{"code": code, "message": message}})
+}
@@ -0,0 +1,248 @@
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	secretmanagerpb "cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"token-toolkit/jwt-rotation/storage"
+)
+
+// NewFakeGCP returns a GCPSecretManager connected to an in-process gRPC
+// server that implements the parts of Secret Manager the backend uses.
+// The server holds a single empty secret and is stopped when the test ends.
+func NewFakeGCP(t *testing.T) storage.SecretStorage {
+	t.Helper()
+
+	const projectID, secretID = "test-project", "test-secret"
+	fake := &fakeGCP{
+		secret: &secretmanagerpb.Secret{
+			Name:       fmt.Sprintf("projects/%s/secrets/%s", projectID, secretID),
+			CreateTime: timestamppb.Now(),
+			Etag:       strconv.Quote("1"),
+		},
+		etag: 1,
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	server := grpc.NewServer()
+	secretmanagerpb.RegisterSecretManagerServiceServer(server, fake)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	client, err := secretmanager.NewClient(context.Background(),
+		option.WithEndpoint(listener.Addr().String()),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	)
+	if err != nil {
+		t.Fatalf("failed to create secret manager client: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return storage.NewGCPSecretManagerFromClient(client, projectID, secretID)
+}
+
+// fakeGCP keeps one secret and its versions in memory.
+type fakeGCP struct {
+	secretmanagerpb.UnimplementedSecretManagerServiceServer
+
+	mutex    sync.Mutex
+	secret   *secretmanagerpb.Secret
+	etag     int
+	versions []*fakeGCPVersion
+}
+
+type fakeGCPVersion struct {
+	meta *secretmanagerpb.SecretVersion
+	data []byte
+}
+
+func (f *fakeGCP) GetSecret(ctx context.Context, req *secretmanagerpb.GetSecretRequest) (*secretmanagerpb.Secret, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if req.Name != f.secret.Name {
+		return nil, status.Errorf(codes.NotFound, "secret %s not found", req.Name)
+	}
+	return proto.Clone(f.secret).(*secretmanagerpb.Secret), nil
+}
+
+func (f *fakeGCP) UpdateSecret(ctx context.Context, req *secretmanagerpb.UpdateSecretRequest) (*secretmanagerpb.Secret, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if req.Secret.GetName() != f.secret.Name {
+		return nil, status.Errorf(codes.NotFound, "secret %s not found", req.Secret.GetName())
+	}
+	if req.Secret.Etag != "" && req.Secret.Etag != f.secret.Etag {
+		return nil, status.Errorf(codes.Aborted, "etag mismatch")
+	}
+	for _, path := range req.UpdateMask.GetPaths() {
+		switch path {
+		case "version_aliases":
+			for alias, number := range req.Secret.VersionAliases {
+				if f.version(number) == nil {
+					return nil, status.Errorf(codes.InvalidArgument, "alias %s points at unknown version %d", alias, number)
+				}
+			}
+			f.secret.VersionAliases = req.Secret.VersionAliases
+		case "annotations":
+			f.secret.Annotations = req.Secret.Annotations
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "unsupported update mask path %s", path)
+		}
+	}
+	f.etag++
+	f.secret.Etag = strconv.Quote(strconv.Itoa(f.etag))
+	return proto.Clone(f.secret).(*secretmanagerpb.Secret), nil
+}
+
+func (f *fakeGCP) AddSecretVersion(ctx context.Context, req *secretmanagerpb.AddSecretVersionRequest) (*secretmanagerpb.SecretVersion, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if req.Parent != f.secret.Name {
+		return nil, status.Errorf(codes.NotFound, "secret %s not found", req.Parent)
+	}
+	version := &fakeGCPVersion{
+		meta: &secretmanagerpb.SecretVersion{
+			Name:       fmt.Sprintf("%s/versions/%d", f.secret.Name, len(f.versions)+1),
+			CreateTime: timestamppb.Now(),
+			State:      secretmanagerpb.SecretVersion_ENABLED,
+		},
+		data: append([]byte(nil), req.Payload.GetData()...),
+	}
+	f.versions = append(f.versions, version)
+	return proto.Clone(version.meta).(*secretmanagerpb.SecretVersion), nil
+}
+
+func (f *fakeGCP) GetSecretVersion(ctx context.Context, req *secretmanagerpb.GetSecretVersionRequest) (*secretmanagerpb.SecretVersion, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	version, err := f.resolve(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Clone(version.meta).(*secretmanagerpb.SecretVersion), nil
+}
+
+func (f *fakeGCP) AccessSecretVersion(ctx context.Context, req *secretmanagerpb.AccessSecretVersionRequest) (*secretmanagerpb.AccessSecretVersionResponse, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	version, err := f.resolve(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if version.meta.State != secretmanagerpb.SecretVersion_ENABLED {
+		return nil, status.Errorf(codes.FailedPrecondition, "version %s is %s", version.meta.Name, version.meta.State)
+	}
+	return &secretmanagerpb.AccessSecretVersionResponse{
+		Name:    version.meta.Name,
+		Payload: &secretmanagerpb.SecretPayload{Data: append([]byte(nil), version.data...)},
+	}, nil
+}
+
+func (f *fakeGCP) ListSecretVersions(ctx context.Context, req *secretmanagerpb.ListSecretVersionsRequest) (*secretmanagerpb.ListSecretVersionsResponse, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if req.Parent != f.secret.Name {
+		return nil, status.Errorf(codes.NotFound, "secret %s not found", req.Parent)
+	}
+	resp := &secretmanagerpb.ListSecretVersionsResponse{}
+	// Newest first, like the real service.
+	for i := len(f.versions) - 1; i >= 0; i-- {
+		version := f.versions[i]
+		if req.Filter == "state:ENABLED" && version.meta.State != secretmanagerpb.SecretVersion_ENABLED {
+			continue
+		}
+		resp.Versions = append(resp.Versions, proto.Clone(version.meta).(*secretmanagerpb.SecretVersion))
+	}
+	resp.TotalSize = int32(len(resp.Versions))
+	return resp, nil
+}
+
+func (f *fakeGCP) DisableSecretVersion(ctx context.Context, req *secretmanagerpb.DisableSecretVersionRequest) (*secretmanagerpb.SecretVersion, error) {
+	return f.setState(req.Name, secretmanagerpb.SecretVersion_DISABLED)
+}
+
+func (f *fakeGCP) EnableSecretVersion(ctx context.Context, req *secretmanagerpb.EnableSecretVersionRequest) (*secretmanagerpb.SecretVersion, error) {
+	return f.setState(req.Name, secretmanagerpb.SecretVersion_ENABLED)
+}
+
+func (f *fakeGCP) DestroySecretVersion(ctx context.Context, req *secretmanagerpb.DestroySecretVersionRequest) (*secretmanagerpb.SecretVersion, error) {
+	return f.setState(req.Name, secretmanagerpb.SecretVersion_DESTROYED)
+}
+
+func (f *fakeGCP) setState(name string, state secretmanagerpb.SecretVersion_State) (*secretmanagerpb.SecretVersion, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	version, err := f.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	if version.meta.State == secretmanagerpb.SecretVersion_DESTROYED {
+		return nil, status.Errorf(codes.FailedPrecondition, "version %s is destroyed", version.meta.Name)
+	}
+	version.meta.State = state
+	if state == secretmanagerpb.SecretVersion_DESTROYED {
+		version.meta.DestroyTime = timestamppb.Now()
+		version.data = nil
+	}
+	return proto.Clone(version.meta).(*secretmanagerpb.SecretVersion), nil
+}
+
+// resolves a version name that ends in a number, an alias or "latest".
+func (f *fakeGCP) resolve(name string) (*fakeGCPVersion, error) {
+	prefix := f.secret.Name + "/versions/"
+	if !strings.HasPrefix(name, prefix) {
+		return nil, status.Errorf(codes.NotFound, "version %s not found", name)
+	}
+	ref := strings.TrimPrefix(name, prefix)
+
+	var version *fakeGCPVersion
+	if ref == "latest" {
+		for i := len(f.versions) - 1; i >= 0; i-- {
+			if f.versions[i].meta.State == secretmanagerpb.SecretVersion_ENABLED {
+				version = f.versions[i]
+				break
+			}
+		}
+	} else if number, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		version = f.version(number)
+	} else if number, ok := f.secret.VersionAliases[ref]; ok {
+		version = f.version(number)
+	}
+	if version == nil {
+		return nil, status.Errorf(codes.NotFound, "version %s not found", name)
+	}
+	return version, nil
+}
+
+func (f *fakeGCP) version(number int64) *fakeGCPVersion {
+	if number < 1 || number > int64(len(f.versions)) {
+		return nil
+	}
+	return f.versions[number-1]
+}
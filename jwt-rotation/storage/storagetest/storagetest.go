@@ -0,0 +1,704 @@
+// Package storagetest checks that a storage.SecretStorage implementation
+// honours the contract the rotation manager relies on.
+//
+// A backend runs the suite from its own tests:
+//
+//	func TestConformance(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) storage.SecretStorage {
+//			return newEmptyBackend(t)
+//		})
+//	}
+//
+// The package also provides in-process fakes of AWS Secrets Manager, GCP
+// Secret Manager and Azure Key Vault, so the cloud backends can be exercised
+// without credentials: storagetest.Run(t, storagetest.NewFakeAWS).
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"token-toolkit/jwt-rotation/storage"
+)
+
+// Factory returns an empty, ready to use backend. It is called once per subtest.
+type Factory func(t *testing.T) storage.SecretStorage
+
+// Run executes the conformance suite against backends created by newStorage.
+func Run(t *testing.T, newStorage Factory) {
+	t.Helper()
+
+	t.Run("Empty", func(t *testing.T) { testEmpty(t, newStorage(t)) })
+	t.Run("RoundTrip", func(t *testing.T) { testRoundTrip(t, newStorage(t)) })
+	t.Run("Ordering", func(t *testing.T) { testOrdering(t, newStorage(t)) })
+	t.Run("Latest", func(t *testing.T) { testLatest(t, newStorage(t)) })
+	t.Run("NotFound", func(t *testing.T) { testNotFound(t, newStorage(t)) })
+	t.Run("States", func(t *testing.T) { testStates(t, newStorage(t)) })
+	t.Run("InterruptedActivation", func(t *testing.T) { testInterruptedActivation(t, newStorage(t)) })
+	t.Run("Revoke", func(t *testing.T) { testRevoke(t, newStorage(t)) })
+	t.Run("Prune", func(t *testing.T) { testPrune(t, newStorage(t)) })
+	t.Run("BinaryValues", func(t *testing.T) { testBinaryValues(t, newStorage(t)) })
+	t.Run("ConcurrentStore", func(t *testing.T) { testConcurrentStore(t, newStorage(t)) })
+	t.Run("ConditionalStore", func(t *testing.T) { testConditionalStore(t, newStorage(t)) })
+	t.Run("ConcurrentConditionalStore", func(t *testing.T) { testConcurrentConditionalStore(t, newStorage(t)) })
+	t.Run("ETag", func(t *testing.T) { testETag(t, newStorage(t)) })
+	t.Run("Lease", func(t *testing.T) { testLease(t, newStorage(t)) })
+	t.Run("LeaseExpiry", func(t *testing.T) { testLeaseExpiry(t, newStorage(t)) })
+	t.Run("LeaseContention", func(t *testing.T) { testLeaseContention(t, newStorage(t)) })
+}
+
+// fails a single write request of a fake backend.
+type writeFailer interface {
+	// makes the nth write from now fail, 0 turns failing off.
+	failWrite(n int)
+}
+
+// the fakes that can fail writes, by the backend they return.
+var writeFailers sync.Map
+
+func registerWriteFailer(t *testing.T, s storage.SecretStorage, failer writeFailer) {
+	writeFailers.Store(s, failer)
+	t.Cleanup(func() { writeFailers.Delete(s) })
+}
+
+// base time for generated secrets, truncated so backends with coarse clocks still compare equal.
+var epoch = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func newSecret(i int) *storage.StoredSecret {
+	return &storage.StoredSecret{
+		ID:        fmt.Sprintf("kid%09d", i),
+		Value:     bytes.Repeat([]byte{byte(i), 0xff, 0x00}, 22),
+		CreatedAt: epoch.Add(time.Duration(i) * time.Minute),
+		State:     storage.StateActive,
+	}
+}
+
+func store(t *testing.T, s storage.SecretStorage, secret *storage.StoredSecret) {
+	t.Helper()
+	if err := s.Store(context.Background(), secret); err != nil {
+		t.Fatalf("Store(%s) failed: %v", secret.ID, err)
+	}
+}
+
+func assertSecret(t *testing.T, got, want *storage.StoredSecret) {
+	t.Helper()
+	if got == nil {
+		t.Fatalf("got nil secret, want %s", want.ID)
+	}
+	if got.ID != want.ID {
+		t.Errorf("ID = %q, want %q", got.ID, want.ID)
+	}
+	if !bytes.Equal(got.Value, want.Value) {
+		t.Errorf("Value of %s = %x, want %x", want.ID, got.Value, want.Value)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) {
+		t.Errorf("CreatedAt of %s = %s, want %s", want.ID, got.CreatedAt, want.CreatedAt)
+	}
+}
+
+func testEmpty(t *testing.T, s storage.SecretStorage) {
+	ctx := context.Background()
+
+	all, err := s.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("GetAll on an empty backend failed: %v", err)
+	}
+	if len(all) != 0 {
+		t.Errorf("GetAll on an empty backend returned %d secrets", len(all))
+	}
+
+	if _, err := s.GetLatest(ctx); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetLatest on an empty backend: got %v, want storage.ErrNotFound", err)
+	}
+}
+
+func testRoundTrip(t *testing.T, s storage.SecretStorage) {
+	ctx := context.Background()
+	want := newSecret(1)
+	store(t, s, want)
+
+	got, err := s.Get(ctx, want.ID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	assertSecret(t, got, want)
+	if got.State != storage.StateActive {
+		t.Errorf("State = %q, want %q", got.State, storage.StateActive)
+	}
+
+	all, err := s.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("GetAll failed: %v", err)
+	}
+	if len(all) != 1 {
+		t.Fatalf("GetAll returned %d secrets, want 1", len(all))
+	}
+	assertSecret(t, all[0], want)
+}
+
+func testOrdering(t *testing.T, s storage.SecretStorage) {
+	ctx := context.Background()
+
+	// Store out of CreatedAt order, GetAll must still return newest first.
+	secrets := []*storage.StoredSecret{newSecret(2), newSecret(1), newSecret(3)}
+	for _, secret := range secrets {
+		secret.State = storage.StatePrevious
+		store(t, s, secret)
+	}
+
+	all, err := s.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("GetAll failed: %v", err)
+	}
+	if len(all) != len(secrets) {
+		t.Fatalf("GetAll returned %d secrets, want %d", len(all), len(secrets))
+	}
+	for i, wantID := range []string{secrets[2].ID, secrets[0].ID, secrets[1].ID} {
+		if all[i].ID != wantID {
+			t.Errorf("GetAll()[%d].ID = %q, want %q", i, all[i].ID, wantID)
+		}
+	}
+}
+
+func testLatest(t *testing.T, s storage.SecretStorage) {
+	ctx := context.Background()
+	for i := 1; i <= 3; i++ {
+		store(t, s, newSecret(i))
+	}
+
+	latest, err := s.GetLatest(ctx)
+	if err != nil {
+		t.Fatalf("GetLatest failed: %v", err)
+	}
+	assertSecret(t, latest, newSecret(3))
+
+	all, err := s.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("GetAll failed: %v", err)
+	}
+	active := 0
+	for _, secret := range all {
+		if secret.State == storage.StateActive {
+			active++
+			if secret.ID != latest.ID {
+				t.Errorf("secret %s is active, want only %s", secret.ID, latest.ID)
+			}
+		}
+	}
+	if active != 1 {
+		t.Errorf("GetAll reported %d active secrets, want 1", active)
+	}
+}
+
+func testNotFound(t *testing.T, s storage.SecretStorage) {
+	store(t, s, newSecret(1))
+
+	_, err := s.Get(context.Background(), "does-not-exist")
+	if !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Get of an unknown id: got %v, want storage.ErrNotFound", err)
+	}
+}
+
+func testStates(t *testing.T, s storage.SecretStorage) {
+	ctx := context.Background()
+	current, pending := newSecret(1), newSecret(2)
+	pending.State = storage.StatePending
+	store(t, s, current)
+	store(t, s, pending)
+
+	assertStates(t, s, map[string]storage.SecretState{
+		current.ID: storage.StateActive,
+		pending.ID: storage.StatePending,
+	})
+	if latest, err := s.GetLatest(ctx); err != nil {
+		t.Fatalf("GetLatest failed: %v", err)
+	} else if latest.ID != current.ID {
+		t.Errorf("GetLatest returned pending secret %s, want active %s", latest.ID, current.ID)
+	}
+
+	if err := s.SetState(ctx, pending.ID, storage.StateActive); err != nil {
+		t.Fatalf("SetState failed: %v", err)
+	}
+	assertStates(t, s, map[string]storage.SecretState{
+		current.ID: storage.StatePrevious,
+		pending.ID: storage.StateActive,
+	})
+	if latest, err := s.GetLatest(ctx); err != nil {
+		t.Fatalf("GetLatest failed: %v", err)
+	} else if latest.ID != pending.ID {
+		t.Errorf("GetLatest = %s after promotion, want %s", latest.ID, pending.ID)
+	}
+
+	if err := s.SetState(ctx, "does-not-exist", storage.StateActive); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("SetState of an unknown id: got %v, want storage.ErrNotFound", err)
+	}
+}
+
+// activating a secret may take several writes, whichever of them fails, the
+// backend must be left with exactly one active secret.
+func testInterruptedActivation(t *testing.T, s storage.SecretStorage) {
+	value, ok := writeFailers.Load(s)
+	if !ok {
+		t.Skip("backend cannot fail single writes")
+	}
+	failer := value.(writeFailer)
+	ctx := context.Background()
+
+	store(t, s, newSecret(0))
+	// The failed calls return errors, only what they leave behind is checked.
+	for n := 1; n <= 3; n++ {
+		stored := newSecret(2 * n)
+		failer.failWrite(n)
+		_ = s.Store(ctx, stored)
+		failer.failWrite(0)
+		assertOneActive(t, s, fmt.Sprintf("Store failing write %d", n))
+
+		pending := newSecret(2*n + 1)
+		pending.State = storage.StatePending
+		store(t, s, pending)
+		failer.failWrite(n)
+		_ = s.SetState(ctx, pending.ID, storage.StateActive)
+		failer.failWrite(0)
+		assertOneActive(t, s, fmt.Sprintf("SetState failing write %d", n))
+	}
+}
+
+func assertOneActive(t *testing.T, s storage.SecretStorage, after string) {
+	t.Helper()
+	all, err := s.GetAll(context.Background())
+	if err != nil {
+		t.Fatalf("GetAll failed: %v", err)
+	}
+	var active []string
+	for _, secret := range all {
+		if secret.State == storage.StateActive {
+			active = append(active, secret.ID)
+		}
+	}
+	if len(active) != 1 {
+		t.Errorf("after %s: active secrets = %v, want exactly one", after, active)
+	}
+}
+
+func assertStates(t *testing.T, s storage.SecretStorage, want map[string]storage.SecretState) {
+	t.Helper()
+	all, err := s.GetAll(context.Background())
+	if err != nil {
+		t.Fatalf("GetAll failed: %v", err)
+	}
+	for _, secret := range all {
+		if state, ok := want[secret.ID]; ok && secret.State != state {
+			t.Errorf("state of %s = %q, want %q", secret.ID, secret.State, state)
+		}
+	}
+}
+
+func testRevoke(t *testing.T, s storage.SecretStorage) {
+	ctx := context.Background()
+	revoked, kept, current := newSecret(1), newSecret(2), newSecret(3)
+	revoked.State = storage.StatePrevious
+	kept.State = storage.StatePrevious
+	store(t, s, revoked)
+	store(t, s, kept)
+	store(t, s, current)
+
+	if err := s.Revoke(ctx, revoked.ID); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if _, err := s.Get(ctx, revoked.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Get of a revoked secret: got %v, want storage.ErrNotFound", err)
+	}
+	all, err := s.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("GetAll failed: %v", err)
+	}
+	if len(all) != 2 {
+		t.Errorf("GetAll returned %d secrets after revoking one of 3, want 2", len(all))
+	}
+	for _, secret := range all {
+		if secret.ID == revoked.ID {
+			t.Errorf("GetAll still returns revoked secret %s", revoked.ID)
+		}
+	}
+	if latest, err := s.GetLatest(ctx); err != nil {
+		t.Fatalf("GetLatest failed: %v", err)
+	} else if latest.ID != current.ID {
+		t.Errorf("GetLatest = %s after revoking, want %s", latest.ID, current.ID)
+	}
+
+	if err := s.Revoke(ctx, current.ID); !errors.Is(err, storage.ErrRevokeActive) {
+		t.Errorf("Revoke of the active secret: got %v, want storage.ErrRevokeActive", err)
+	}
+	if err := s.Revoke(ctx, revoked.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Revoke of a revoked secret: got %v, want storage.ErrNotFound", err)
+	}
+}
+
+func testPrune(t *testing.T, s storage.SecretStorage) {
+	ctx := context.Background()
+	p, ok := s.(storage.Pruner)
+	if !ok {
+		t.Skip("backend does not implement storage.Pruner")
+	}
+	expired, kept, current := newSecret(1), newSecret(2), newSecret(3)
+	expired.State = storage.StatePrevious
+	kept.State = storage.StatePrevious
+	store(t, s, expired)
+	store(t, s, kept)
+	store(t, s, current)
+
+	if err := p.Prune(ctx, []string{expired.ID, current.ID, "does-not-exist"}); err != nil {
+		t.Fatalf("Prune failed: %v", err)
+	}
+	if _, err := s.Get(ctx, expired.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Get of a pruned secret: got %v, want storage.ErrNotFound", err)
+	}
+	all, err := s.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("GetAll failed: %v", err)
+	}
+	seen := make(map[string]bool)
+	for _, secret := range all {
+		seen[secret.ID] = true
+	}
+	if seen[expired.ID] {
+		t.Errorf("GetAll still returns pruned secret %s", expired.ID)
+	}
+	if !seen[kept.ID] || !seen[current.ID] {
+		t.Errorf("GetAll = %v after pruning, want %s and %s", seen, kept.ID, current.ID)
+	}
+	if latest, err := s.GetLatest(ctx); err != nil {
+		t.Fatalf("GetLatest failed: %v", err)
+	} else if latest.ID != current.ID {
+		t.Errorf("GetLatest = %s after pruning the active secret's kid, want %s", latest.ID, current.ID)
+	}
+
+	if err := p.Prune(ctx, []string{expired.ID}); err != nil {
+		t.Errorf("Prune of a pruned secret failed: %v", err)
+	}
+}
+
+func testBinaryValues(t *testing.T, s storage.SecretStorage) {
+	value := make([]byte, 256)
+	for i := range value {
+		value[i] = byte(i)
+	}
+	want := newSecret(1)
+	want.Value = value
+	store(t, s, want)
+
+	got, err := s.Get(context.Background(), want.ID)
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	assertSecret(t, got, want)
+}
+
+func testConcurrentStore(t *testing.T, s storage.SecretStorage) {
+	const writers = 8
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			secret := newSecret(i)
+			secret.State = storage.StatePrevious
+			if err := s.Store(context.Background(), secret); err != nil {
+				errs <- fmt.Errorf("Store(%s): %w", secret.ID, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	all, err := s.GetAll(context.Background())
+	if err != nil {
+		t.Fatalf("GetAll failed: %v", err)
+	}
+	seen := make(map[string]bool)
+	for _, secret := range all {
+		seen[secret.ID] = true
+	}
+	for i := 0; i < writers; i++ {
+		if id := newSecret(i).ID; !seen[id] {
+			t.Errorf("secret %s stored concurrently is missing from GetAll", id)
+		}
+	}
+}
+
+// returns the backend as a storage.ConditionalStorer, skipping backends without conditional writes.
+func conditionalStorer(t *testing.T, s storage.SecretStorage) storage.ConditionalStorer {
+	t.Helper()
+	cs, ok := s.(storage.ConditionalStorer)
+	if !ok {
+		t.Skip("backend does not implement storage.ConditionalStorer")
+	}
+	return cs
+}
+
+func testConditionalStore(t *testing.T, s storage.SecretStorage) {
+	ctx := context.Background()
+	cs := conditionalStorer(t, s)
+	first, second, stale, pending := newSecret(1), newSecret(2), newSecret(3), newSecret(4)
+	pending.State = storage.StatePending
+
+	if err := cs.StoreIf(ctx, first, ""); err != nil {
+		t.Fatalf("StoreIf into an empty backend failed: %v", err)
+	}
+	if err := cs.StoreIf(ctx, second, first.ID); err != nil {
+		t.Fatalf("StoreIf with the latest kid failed: %v", err)
+	}
+
+	err := cs.StoreIf(ctx, stale, first.ID)
+	var conflict *storage.ConflictError
+	if !errors.As(err, &conflict) || !errors.Is(err, storage.ErrConflict) {
+		t.Fatalf("StoreIf with a stale kid: got %v, want a *storage.ConflictError", err)
+	}
+	if conflict.Expected != first.ID || conflict.Actual != second.ID {
+		t.Errorf("conflict = %+v, want expected %s and actual %s", conflict, first.ID, second.ID)
+	}
+	if err := cs.StoreIf(ctx, newSecret(5), ""); !errors.Is(err, storage.ErrConflict) {
+		t.Errorf("StoreIf expecting no secret into a non-empty backend: got %v, want storage.ErrConflict", err)
+	}
+	if _, err := s.Get(ctx, stale.ID); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Get of a secret refused by StoreIf: got %v, want storage.ErrNotFound", err)
+	}
+
+	if err := cs.StoreIf(ctx, pending, second.ID); err != nil {
+		t.Fatalf("StoreIf of a pending secret failed: %v", err)
+	}
+	assertStates(t, s, map[string]storage.SecretState{
+		first.ID:   storage.StatePrevious,
+		second.ID:  storage.StateActive,
+		pending.ID: storage.StatePending,
+	})
+	all, err := s.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("GetAll failed: %v", err)
+	}
+	if len(all) != 3 {
+		t.Errorf("GetAll returned %d secrets, want the 3 stored without conflict", len(all))
+	}
+	if latest, err := s.GetLatest(ctx); err != nil {
+		t.Fatalf("GetLatest failed: %v", err)
+	} else if latest.ID != second.ID {
+		t.Errorf("GetLatest = %s, want %s", latest.ID, second.ID)
+	}
+}
+
+func testConcurrentConditionalStore(t *testing.T, s storage.SecretStorage) {
+	const writers = 6
+	cs := conditionalStorer(t, s)
+	base := newSecret(0)
+	store(t, s, base)
+
+	var wg sync.WaitGroup
+	results := make(chan error, writers)
+	for i := 1; i <= writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results <- cs.StoreIf(context.Background(), newSecret(i), base.ID)
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+
+	stored := 0
+	for err := range results {
+		switch {
+		case err == nil:
+			stored++
+		case !errors.Is(err, storage.ErrConflict):
+			t.Errorf("StoreIf failed: %v", err)
+		}
+	}
+	if stored != 1 {
+		t.Errorf("%d of %d concurrent writers expecting the same kid stored, want 1", stored, writers)
+	}
+	all, err := s.GetAll(context.Background())
+	if err != nil {
+		t.Fatalf("GetAll failed: %v", err)
+	}
+	if len(all) != 2 {
+		t.Errorf("GetAll returned %d secrets, want 2", len(all))
+	}
+}
+
+func testETag(t *testing.T, s storage.SecretStorage) {
+	ctx := context.Background()
+	e, ok := s.(storage.ETagger)
+	if !ok {
+		t.Skip("backend does not implement storage.ETagger")
+	}
+	etag := func() string {
+		t.Helper()
+		tag, err := e.ETag(ctx)
+		if err != nil {
+			t.Fatalf("ETag failed: %v", err)
+		}
+		return tag
+	}
+	first, second := newSecret(1), newSecret(2)
+	store(t, s, first)
+
+	tag := etag()
+	if again := etag(); again != tag {
+		t.Errorf("ETag changed from %q to %q without a write", tag, again)
+	}
+	if l, ok := s.(storage.Leaser); ok {
+		if _, err := l.AcquireLease(ctx, "rotation", "a", time.Minute); err != nil {
+			t.Fatalf("AcquireLease failed: %v", err)
+		}
+		if again := etag(); again != tag {
+			t.Errorf("ETag changed from %q to %q by a lease", tag, again)
+		}
+	}
+
+	writes := []struct {
+		name  string
+		write func() error
+	}{
+		{"Store", func() error { return s.Store(ctx, second) }},
+		{"SetState", func() error { return s.SetState(ctx, first.ID, storage.StateActive) }},
+		{"Revoke", func() error { return s.Revoke(ctx, second.ID) }},
+	}
+	for _, w := range writes {
+		if err := w.write(); err != nil {
+			t.Fatalf("%s failed: %v", w.name, err)
+		}
+		if next := etag(); next == tag {
+			t.Errorf("ETag %q did not change after %s", tag, w.name)
+		} else {
+			tag = next
+		}
+	}
+}
+
+// returns the backend as a storage.Leaser with an active secret stored, skipping backends without leases.
+func leaser(t *testing.T, s storage.SecretStorage) storage.Leaser {
+	t.Helper()
+	l, ok := s.(storage.Leaser)
+	if !ok {
+		t.Skip("backend does not implement storage.Leaser")
+	}
+	store(t, s, newSecret(1))
+	return l
+}
+
+func testLease(t *testing.T, s storage.SecretStorage) {
+	ctx := context.Background()
+	l := leaser(t, s)
+
+	lease, err := l.AcquireLease(ctx, "rotation", "a", time.Minute)
+	if err != nil {
+		t.Fatalf("AcquireLease failed: %v", err)
+	}
+	if lease.Holder != "a" || time.Until(lease.ExpiresAt) <= 0 {
+		t.Errorf("AcquireLease = %+v, want a lease held by a that has not expired", lease)
+	}
+	if _, err := l.AcquireLease(ctx, "rotation", "b", time.Minute); !errors.Is(err, storage.ErrLeaseHeld) {
+		t.Errorf("AcquireLease of a held lease: got %v, want storage.ErrLeaseHeld", err)
+	}
+
+	renewed, err := l.AcquireLease(ctx, "rotation", "a", time.Hour)
+	if err != nil {
+		t.Fatalf("AcquireLease to renew failed: %v", err)
+	}
+	if !renewed.ExpiresAt.After(lease.ExpiresAt) {
+		t.Errorf("renewed lease expires at %s, want after %s", renewed.ExpiresAt, lease.ExpiresAt)
+	}
+	if _, err := l.AcquireLease(ctx, "other", "b", time.Minute); err != nil {
+		t.Errorf("AcquireLease of a different lease failed: %v", err)
+	}
+
+	if err := l.ReleaseLease(ctx, "rotation", "b"); err != nil {
+		t.Fatalf("ReleaseLease by another holder failed: %v", err)
+	}
+	if _, err := l.AcquireLease(ctx, "rotation", "b", time.Minute); !errors.Is(err, storage.ErrLeaseHeld) {
+		t.Errorf("AcquireLease after another holder released: got %v, want storage.ErrLeaseHeld", err)
+	}
+	if err := l.ReleaseLease(ctx, "rotation", "a"); err != nil {
+		t.Fatalf("ReleaseLease failed: %v", err)
+	}
+	if _, err := l.AcquireLease(ctx, "rotation", "b", time.Minute); err != nil {
+		t.Errorf("AcquireLease after release failed: %v", err)
+	}
+
+	// Leases must not show up as secrets.
+	all, err := s.GetAll(ctx)
+	if err != nil {
+		t.Fatalf("GetAll failed: %v", err)
+	}
+	if len(all) != 1 {
+		t.Errorf("GetAll returned %d secrets with leases held, want 1", len(all))
+	}
+	if latest, err := s.GetLatest(ctx); err != nil {
+		t.Fatalf("GetLatest failed: %v", err)
+	} else {
+		assertSecret(t, latest, newSecret(1))
+	}
+}
+
+func testLeaseExpiry(t *testing.T, s storage.SecretStorage) {
+	ctx := context.Background()
+	l := leaser(t, s)
+
+	lease, err := l.AcquireLease(ctx, "rotation", "a", 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("AcquireLease failed: %v", err)
+	}
+	time.Sleep(time.Until(lease.ExpiresAt) + 50*time.Millisecond)
+
+	if _, err := l.AcquireLease(ctx, "rotation", "b", time.Minute); err != nil {
+		t.Fatalf("AcquireLease of an expired lease failed: %v", err)
+	}
+	// The previous holder must not take it back or release it.
+	if err := l.ReleaseLease(ctx, "rotation", "a"); err != nil {
+		t.Fatalf("ReleaseLease of a lease taken over failed: %v", err)
+	}
+	if _, err := l.AcquireLease(ctx, "rotation", "a", time.Minute); !errors.Is(err, storage.ErrLeaseHeld) {
+		t.Errorf("AcquireLease by the previous holder: got %v, want storage.ErrLeaseHeld", err)
+	}
+}
+
+func testLeaseContention(t *testing.T, s storage.SecretStorage) {
+	const contenders = 6
+	l := leaser(t, s)
+
+	var wg sync.WaitGroup
+	results := make(chan error, contenders)
+	for i := 0; i < contenders; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := l.AcquireLease(context.Background(), "rotation", fmt.Sprintf("holder-%d", i), time.Minute)
+			results <- err
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+
+	winners := 0
+	for err := range results {
+		switch {
+		case err == nil:
+			winners++
+		case !errors.Is(err, storage.ErrLeaseHeld):
+			t.Errorf("AcquireLease failed: %v", err)
+		}
+	}
+	if winners != 1 {
+		t.Errorf("%d of %d concurrent contenders acquired the lease, want 1", winners, contenders)
+	}
+}
@@ -0,0 +1,220 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"token-toolkit/jwt-rotation/storage"
+)
+
+// ErrVerifyOnly is returned when a manager created with NewJWTVerifier is asked to change the keyring.
+var ErrVerifyOnly = errors.New("manager only verifies tokens")
+
+// DefaultSyncInterval is used when a policy does not set SyncInterval.
+const DefaultSyncInterval = time.Minute
+
+// a running keyring sync loop.
+type keyringSync struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewJWTVerifier creates a manager for processes that only validate tokens.
+// It loads the keyring without generating an initial secret and refuses to
+// sign tokens or change the keyring with ErrVerifyOnly; StartKeyringSync
+// keeps it up to date with rotations made elsewhere.
+func NewJWTVerifier(ctx context.Context, policy RotationPolicy, store storage.SecretStorage, notifier Notifier) (*JWTManager, error) {
+	rm := &RotationManager{
+		policy:          policy,
+		previousSecrets: make([]*Secret, 0),
+		storage:         store,
+		notifier:        notifier,
+		verifyOnly:      true,
+	}
+	if _, err := rm.SyncKeyring(ctx); err != nil {
+		return nil, fmt.Errorf("could not load keyring: %w", err)
+	}
+	return &JWTManager{RotationManager: rm}, nil
+}
+
+// registers a hook that is called with the new keyring, as GetSecrets returns
+// it, whenever a sync loads a keyring that differs from the one in use.
+// Hooks run on the syncing goroutine after the new keyring is in place.
+func (rm *RotationManager) OnKeyringChanged(hook func(secrets []*Secret)) {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	rm.keyringHooks = append(rm.keyringHooks, hook)
+}
+
+// SyncKeyring reloads the keyring from storage and reports whether it changed.
+// Backends implementing storage.ETagger are asked first whether anything was
+// written since the last sync, so an unchanged keyring is not read again.
+// The new keyring is published as one snapshot, so token validation never
+// sees a mix of the old and new keyring. A read that overlaps a change this
+// process makes to the keyring is discarded and left to the next sync.
+func (rm *RotationManager) SyncKeyring(ctx context.Context) (bool, error) {
+	changed, err := rm.syncKeyring(ctx)
+
+	rm.mutex.Lock()
+	rm.lastSync = time.Now()
+	rm.syncError = err
+	hooks := rm.keyringHooks
+	rm.mutex.Unlock()
+
+	if changed {
+		for _, hook := range hooks {
+			hook(rm.GetSecrets())
+		}
+	}
+	return changed, err
+}
+
+func (rm *RotationManager) syncKeyring(ctx context.Context) (bool, error) {
+	storageCtx, cancel := rm.storageContext(ctx)
+	defer cancel()
+
+	var etag string
+	if tagger, ok := rm.storage.(storage.ETagger); ok {
+		var err error
+		if etag, err = tagger.ETag(storageCtx); err != nil {
+			return false, fmt.Errorf("failed to check keyring for changes: %w", err)
+		}
+
+		rm.mutex.Lock()
+		if etag != "" && etag == rm.keyringETag {
+			// Nothing was written, but previous secrets may have reached the end of their grace period.
+			before := keyringFingerprint(rm.activeSecret, rm.pendingSecret, rm.previousSecrets)
+			rm.cleanupOldSecrets()
+			changed := before != keyringFingerprint(rm.activeSecret, rm.pendingSecret, rm.previousSecrets)
+			rm.mutex.Unlock()
+			return changed, nil
+		}
+		rm.mutex.Unlock()
+	}
+
+	// Every change this process makes to the keyring publishes a new snapshot.
+	before := rm.keyring()
+	stored, err := rm.storage.GetAll(storageCtx)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return false, fmt.Errorf("failed to load secrets: %w", err)
+	}
+	active, pending, previous, err := buildKeyring(stored, rm.policy.GracePeriod, time.Now())
+	if err != nil {
+		return false, err
+	}
+	if active == nil && !rm.verifyOnly {
+		return false, errors.New("no active secret found in storage")
+	}
+
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	if rm.keyring() != before {
+		// The keyring changed while storage was read, e.g. this process
+		// rotated, and the read may predate that change. The etag is left
+		// as it was, so the next sync reads storage again.
+		return false, nil
+	}
+	changed := keyringFingerprint(active, pending, previous) != keyringFingerprint(rm.activeSecret, rm.pendingSecret, rm.previousSecrets)
+	if changed {
+		rm.activeSecret, rm.pendingSecret, rm.previousSecrets = active, pending, previous
+		rm.publishKeyring()
+	}
+	rm.keyringETag = etag
+	return changed, nil
+}
+
+// identifies a keyring by its kids and their roles.
+func keyringFingerprint(active, pending *Secret, previous []*Secret) string {
+	var b strings.Builder
+	if active != nil {
+		b.WriteString(active.ID)
+	}
+	b.WriteString("|")
+	if pending != nil {
+		b.WriteString(pending.ID)
+	}
+	for _, secret := range previous {
+		b.WriteString("|")
+		b.WriteString(secret.ID)
+	}
+	return b.String()
+}
+
+// StartKeyringSync starts a background goroutine that calls SyncKeyring every
+// SyncInterval of the policy plus a random delay up to SyncJitter, so that
+// many processes do not poll storage in lockstep. Starting a loop that is
+// already running does nothing. The loop ends when the context is cancelled
+// or StopKeyringSync is called.
+func (rm *RotationManager) StartKeyringSync(ctx context.Context) {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	if rm.sync != nil {
+		return
+	}
+	loop := &keyringSync{stop: make(chan struct{}), done: make(chan struct{})}
+	rm.sync = loop
+	go rm.runKeyringSync(ctx, loop)
+}
+
+func (rm *RotationManager) runKeyringSync(ctx context.Context, loop *keyringSync) {
+	defer func() {
+		rm.mutex.Lock()
+		if rm.sync == loop {
+			rm.sync = nil
+		}
+		rm.mutex.Unlock()
+		close(loop.done)
+	}()
+
+	for {
+		timer := time.NewTimer(rm.syncDelay())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-loop.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if _, err := rm.SyncKeyring(ctx); err != nil && ctx.Err() == nil {
+			// The keyring in use stays valid, the next sync tries again.
+			fmt.Printf("Error syncing keyring: %v\n", err)
+		}
+	}
+}
+
+// returns the policy's sync interval plus jitter.
+func (rm *RotationManager) syncDelay() time.Duration {
+	delay := rm.policy.SyncInterval
+	if delay <= 0 {
+		delay = DefaultSyncInterval
+	}
+	if rm.policy.SyncJitter > 0 {
+		delay += rand.N(rm.policy.SyncJitter)
+	}
+	return delay
+}
+
+// StopKeyringSync stops the keyring sync loop and waits until a sync in
+// flight has finished. The loop can be started again afterwards.
+func (rm *RotationManager) StopKeyringSync() {
+	rm.mutex.Lock()
+	loop := rm.sync
+	rm.sync = nil
+	rm.mutex.Unlock()
+
+	if loop == nil {
+		return
+	}
+	close(loop.stop)
+	<-loop.done
+}
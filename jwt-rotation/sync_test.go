@@ -0,0 +1,62 @@
+package secrets
+
+import (
+	"context"
+	"testing"
+
+	"token-toolkit/jwt-rotation/storage"
+)
+
+// a backend whose next GetAll runs a hook after reading, so the result it
+// returns predates whatever the hook changes.
+type staleReadStorage struct {
+	storage.SecretStorage
+	afterRead func()
+}
+
+func (s *staleReadStorage) GetAll(ctx context.Context) ([]*storage.StoredSecret, error) {
+	stored, err := s.SecretStorage.GetAll(ctx)
+	if hook := s.afterRead; hook != nil {
+		s.afterRead = nil
+		hook()
+	}
+	return stored, err
+}
+
+func TestSyncKeyringDiscardsReadsOverlappingAChange(t *testing.T) {
+	ctx := context.Background()
+	store := &staleReadStorage{SecretStorage: storage.NewMemoryStorage()}
+	generator, err := NewRandomSecretGenerator(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rm, err := NewRotationManager(ctx, RotationPolicy{}, store, generator, nil)
+	if err != nil {
+		t.Fatalf("NewRotationManager failed: %v", err)
+	}
+
+	var rotated *Secret
+	store.afterRead = func() {
+		if rotated, err = rm.RotateSecret(ctx); err != nil {
+			t.Errorf("RotateSecret failed: %v", err)
+		}
+	}
+	changed, err := rm.SyncKeyring(ctx)
+	if err != nil {
+		t.Fatalf("SyncKeyring failed: %v", err)
+	}
+	if changed {
+		t.Error("SyncKeyring applied a read taken before the rotation")
+	}
+	if active := rm.GetSecrets()[0]; active.ID != rotated.ID {
+		t.Fatalf("active secret after the sync = %s, want the rotated %s", active.ID, rotated.ID)
+	}
+
+	// The next sync reads storage again and finds it matching.
+	if changed, err := rm.SyncKeyring(ctx); err != nil || changed {
+		t.Errorf("second SyncKeyring = %t, %v; want no change", changed, err)
+	}
+	if active := rm.GetSecrets()[0]; active.ID != rotated.ID {
+		t.Errorf("active secret after the second sync = %s, want %s", active.ID, rotated.ID)
+	}
+}
@@ -0,0 +1,109 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ErrTokenTooOld is returned when a token was issued longer ago than the
+// validation policy's MaxAge.
+var ErrTokenTooOld = errors.New("token is too old")
+
+// defines the claims a token must carry to be valid, on top of its signature.
+// The zero policy only checks the signature and, when present, the exp, nbf
+// and iat claims.
+type ValidationPolicy struct {
+	// the iss claim tokens must have, empty accepts any issuer.
+	Issuer string `json:"issuer,omitempty"`
+	// tokens must have one of these values in their aud claim, empty accepts any audience.
+	Audience []string `json:"audience,omitempty"`
+	// claims tokens must carry, e.g. "exp" or "sub".
+	RequiredClaims []string `json:"requiredClaims,omitempty"`
+	// how far exp, nbf and iat may be off to allow for clock skew.
+	Leeway time.Duration `json:"leeway,omitempty"`
+	// the longest ago a token may have been issued. Tokens then need an iat claim.
+	MaxAge time.Duration `json:"maxAge,omitempty"`
+	// the signing algorithms accepted, e.g. "RS256". Empty accepts the
+	// algorithm of each key in the keyring.
+	Algorithms []string `json:"algorithms,omitempty"`
+}
+
+// TokenParser parses tokens and enforces a ValidationPolicy. It is safe for
+// concurrent use.
+type TokenParser struct {
+	policy ValidationPolicy
+	parser *jwt.Parser
+}
+
+// the parser used until a policy is set.
+var defaultTokenParser, _ = NewTokenParser(ValidationPolicy{})
+
+// creates a TokenParser for the policy, checking that its algorithms exist.
+func NewTokenParser(policy ValidationPolicy) (*TokenParser, error) {
+	if policy.Leeway < 0 || policy.MaxAge < 0 {
+		return nil, errors.New("leeway and max age must not be negative")
+	}
+	for _, alg := range policy.Algorithms {
+		if method := jwt.GetSigningMethod(alg); method == nil || method == jwt.SigningMethodNone {
+			return nil, fmt.Errorf("unsupported signing algorithm %q", alg)
+		}
+	}
+
+	options := []jwt.ParserOption{jwt.WithLeeway(policy.Leeway)}
+	if policy.Issuer != "" {
+		options = append(options, jwt.WithIssuer(policy.Issuer))
+	}
+	if len(policy.Audience) > 0 {
+		options = append(options, jwt.WithAudience(policy.Audience...))
+	}
+	if len(policy.Algorithms) > 0 {
+		options = append(options, jwt.WithValidMethods(policy.Algorithms))
+	}
+	if policy.MaxAge > 0 {
+		// A token issued in the future could otherwise outlive MaxAge.
+		options = append(options, jwt.WithIssuedAt())
+	}
+	return &TokenParser{policy: policy, parser: jwt.NewParser(options...)}, nil
+}
+
+// Parse parses and validates a token string, looking up its key with keyFunc.
+// Errors wrap the jwt package's errors, e.g. jwt.ErrTokenExpired, or
+// ErrTokenTooOld.
+func (p *TokenParser) Parse(tokenString string, keyFunc jwt.Keyfunc) (*jwt.Token, error) {
+	token, err := p.parser.Parse(tokenString, keyFunc)
+	if err != nil {
+		return token, err
+	}
+	if err := p.checkClaims(token); err != nil {
+		token.Valid = false
+		return token, fmt.Errorf("%w: %w", jwt.ErrTokenInvalidClaims, err)
+	}
+	return token, nil
+}
+
+// checks the claims the jwt package has no option for.
+func (p *TokenParser) checkClaims(token *jwt.Token) error {
+	claims, _ := token.Claims.(jwt.MapClaims)
+	for _, name := range p.policy.RequiredClaims {
+		if claims[name] == nil {
+			return fmt.Errorf("%w: %s", jwt.ErrTokenRequiredClaimMissing, name)
+		}
+	}
+
+	if p.policy.MaxAge > 0 {
+		issuedAt, err := claims.GetIssuedAt()
+		if err != nil {
+			return err
+		}
+		if issuedAt == nil {
+			return fmt.Errorf("%w: iat", jwt.ErrTokenRequiredClaimMissing)
+		}
+		if time.Since(issuedAt.Time) > p.policy.MaxAge+p.policy.Leeway {
+			return fmt.Errorf("%w: issued at %s", ErrTokenTooOld, issuedAt.Time.Format(time.RFC3339))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package secrets
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestTokenParser(t *testing.T) {
+	hmacKey := []byte("0123456789abcdef0123456789abcdef")
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Hands out the key for the token's algorithm, so only the policy decides
+	// which algorithms pass. Unsigned tokens get the HMAC key, as a careless
+	// key function would.
+	keyFunc := func(token *jwt.Token) (any, error) {
+		if token.Method == jwt.SigningMethodES256 {
+			return &ecKey.PublicKey, nil
+		}
+		return hmacKey, nil
+	}
+
+	now := time.Now()
+	ago := func(d time.Duration) float64 { return float64(now.Add(-d).Unix()) }
+
+	tests := []struct {
+		name    string
+		policy  ValidationPolicy
+		method  jwt.SigningMethod
+		claims  jwt.MapClaims
+		wantErr error
+	}{
+		{
+			name:   "zero policy accepts a signed token",
+			claims: jwt.MapClaims{"sub": "user"},
+		},
+		{
+			name:    "zero policy rejects an unsigned token",
+			method:  jwt.SigningMethodNone,
+			claims:  jwt.MapClaims{"sub": "user"},
+			wantErr: jwt.ErrTokenSignatureInvalid,
+		},
+		{
+			name:    "unsigned token outside the allowed algorithms",
+			policy:  ValidationPolicy{Algorithms: []string{"HS256"}},
+			method:  jwt.SigningMethodNone,
+			claims:  jwt.MapClaims{"sub": "user"},
+			wantErr: jwt.ErrTokenSignatureInvalid,
+		},
+		{
+			name:    "algorithm outside the allowed ones",
+			policy:  ValidationPolicy{Algorithms: []string{"ES256"}},
+			claims:  jwt.MapClaims{"sub": "user"},
+			wantErr: jwt.ErrTokenSignatureInvalid,
+		},
+		{
+			name:   "allowed algorithm",
+			policy: ValidationPolicy{Algorithms: []string{"RS256", "ES256"}},
+			method: jwt.SigningMethodES256,
+			claims: jwt.MapClaims{"sub": "user"},
+		},
+		{
+			name:    "expired",
+			claims:  jwt.MapClaims{"exp": ago(time.Second)},
+			wantErr: jwt.ErrTokenExpired,
+		},
+		{
+			name:   "expired inside the leeway",
+			policy: ValidationPolicy{Leeway: time.Minute},
+			claims: jwt.MapClaims{"exp": ago(30 * time.Second)},
+		},
+		{
+			name:    "expired beyond the leeway",
+			policy:  ValidationPolicy{Leeway: time.Minute},
+			claims:  jwt.MapClaims{"exp": ago(2 * time.Minute)},
+			wantErr: jwt.ErrTokenExpired,
+		},
+		{
+			name:   "not valid yet inside the leeway",
+			policy: ValidationPolicy{Leeway: time.Minute},
+			claims: jwt.MapClaims{"nbf": ago(-30 * time.Second)},
+		},
+		{
+			name:    "not valid yet beyond the leeway",
+			policy:  ValidationPolicy{Leeway: time.Minute},
+			claims:  jwt.MapClaims{"nbf": ago(-2 * time.Minute)},
+			wantErr: jwt.ErrTokenNotValidYet,
+		},
+		{
+			name:    "max age without iat",
+			policy:  ValidationPolicy{MaxAge: time.Hour},
+			claims:  jwt.MapClaims{"sub": "user"},
+			wantErr: jwt.ErrTokenRequiredClaimMissing,
+		},
+		{
+			name:   "max age with a recent iat",
+			policy: ValidationPolicy{MaxAge: time.Hour},
+			claims: jwt.MapClaims{"iat": ago(30 * time.Minute)},
+		},
+		{
+			name:    "issued longer ago than max age",
+			policy:  ValidationPolicy{MaxAge: time.Hour},
+			claims:  jwt.MapClaims{"iat": ago(2 * time.Hour)},
+			wantErr: ErrTokenTooOld,
+		},
+		{
+			name:   "max age exceeded inside the leeway",
+			policy: ValidationPolicy{MaxAge: time.Hour, Leeway: time.Minute},
+			claims: jwt.MapClaims{"iat": ago(time.Hour + 30*time.Second)},
+		},
+		{
+			name:    "max age with iat in the future",
+			policy:  ValidationPolicy{MaxAge: time.Hour, Leeway: time.Minute},
+			claims:  jwt.MapClaims{"iat": ago(-2 * time.Minute)},
+			wantErr: jwt.ErrTokenUsedBeforeIssued,
+		},
+		{
+			name:   "matching issuer",
+			policy: ValidationPolicy{Issuer: "https://auth.example.com"},
+			claims: jwt.MapClaims{"iss": "https://auth.example.com"},
+		},
+		{
+			name:    "wrong issuer",
+			policy:  ValidationPolicy{Issuer: "https://auth.example.com"},
+			claims:  jwt.MapClaims{"iss": "https://evil.example.com"},
+			wantErr: jwt.ErrTokenInvalidIssuer,
+		},
+		{
+			name:    "missing issuer",
+			policy:  ValidationPolicy{Issuer: "https://auth.example.com"},
+			claims:  jwt.MapClaims{"sub": "user"},
+			wantErr: jwt.ErrTokenRequiredClaimMissing,
+		},
+		{
+			name:   "one of the allowed audiences",
+			policy: ValidationPolicy{Audience: []string{"api", "admin"}},
+			claims: jwt.MapClaims{"aud": []any{"other", "admin"}},
+		},
+		{
+			name:    "wrong audience",
+			policy:  ValidationPolicy{Audience: []string{"api", "admin"}},
+			claims:  jwt.MapClaims{"aud": "other"},
+			wantErr: jwt.ErrTokenInvalidAudience,
+		},
+		{
+			name:    "missing audience",
+			policy:  ValidationPolicy{Audience: []string{"api"}},
+			claims:  jwt.MapClaims{"sub": "user"},
+			wantErr: jwt.ErrTokenRequiredClaimMissing,
+		},
+		{
+			name:   "required claims present",
+			policy: ValidationPolicy{RequiredClaims: []string{"sub", "exp"}},
+			claims: jwt.MapClaims{"sub": "user", "exp": ago(-time.Hour)},
+		},
+		{
+			name:    "required claim missing",
+			policy:  ValidationPolicy{RequiredClaims: []string{"sub", "exp"}},
+			claims:  jwt.MapClaims{"sub": "user"},
+			wantErr: jwt.ErrTokenRequiredClaimMissing,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parser, err := NewTokenParser(tt.policy)
+			if err != nil {
+				t.Fatalf("NewTokenParser failed: %v", err)
+			}
+
+			method := tt.method
+			if method == nil {
+				method = jwt.SigningMethodHS256
+			}
+			var key any = hmacKey
+			switch method {
+			case jwt.SigningMethodES256:
+				key = ecKey
+			case jwt.SigningMethodNone:
+				key = jwt.UnsafeAllowNoneSignatureType
+			}
+			signed, err := jwt.NewWithClaims(method, tt.claims).SignedString(key)
+			if err != nil {
+				t.Fatalf("failed to sign token: %v", err)
+			}
+
+			token, err := parser.Parse(signed, keyFunc)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Parse failed: %v", err)
+				}
+				if !token.Valid {
+					t.Error("accepted token is not marked valid")
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if token != nil && token.Valid {
+				t.Error("rejected token is marked valid")
+			}
+		})
+	}
+}
+
+func TestNewTokenParserRejectsInvalidPolicies(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy ValidationPolicy
+	}{
+		{"negative leeway", ValidationPolicy{Leeway: -time.Second}},
+		{"negative max age", ValidationPolicy{MaxAge: -time.Second}},
+		{"unknown algorithm", ValidationPolicy{Algorithms: []string{"HS999"}}},
+		{"none algorithm", ValidationPolicy{Algorithms: []string{"HS256", "none"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTokenParser(tt.policy); err == nil {
+				t.Error("NewTokenParser accepted the policy")
+			}
+		})
+	}
+}
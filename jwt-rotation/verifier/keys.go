@@ -0,0 +1,117 @@
+package verifier
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+
+	secrets "token-toolkit/jwt-rotation"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// a public key from the JWKS with the only signing method it accepts.
+type remoteKey struct {
+	method jwt.SigningMethod
+	// already converted to an interface, so handing it to the JWT library does not allocate.
+	key any
+}
+
+// parses the signing keys of a JWKS by kid. Keys meant for encryption, keys
+// without a kid and key types that cannot verify signatures are skipped, so
+// a symmetric key can never be used.
+func parseKeys(jwks *secrets.JWKS) map[string]*remoteKey {
+	keys := make(map[string]*remoteKey, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Kid == "" || (jwk.Use != "" && jwk.Use != "sig") {
+			continue
+		}
+		key, err := parseKey(jwk)
+		if err != nil {
+			fmt.Printf("Skipping JWKS key %s: %v\n", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys
+}
+
+// parses one JWK. Without an alg, the algorithm is inferred from the key type.
+func parseKey(jwk secrets.JWK) (*remoteKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeField(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decodeField(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA public key")
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+		return withMethod(jwk.Alg, "RS256", pub, "RS256", "RS384", "RS512", "PS256", "PS384", "PS512")
+	case "EC":
+		var curve elliptic.Curve
+		var alg string
+		switch jwk.Crv {
+		case "P-256":
+			curve, alg = elliptic.P256(), "ES256"
+		case "P-384":
+			curve, alg = elliptic.P384(), "ES384"
+		case "P-521":
+			curve, alg = elliptic.P521(), "ES512"
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeField(jwk.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := decodeField(jwk.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("point is not on curve %s", jwk.Crv)
+		}
+		return withMethod(jwk.Alg, alg, pub, alg)
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeField(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 public key")
+		}
+		return withMethod(jwk.Alg, "EdDSA", ed25519.PublicKey(x), "EdDSA")
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
+
+// pairs a key with the algorithm the JWK names, or with fallback when it
+// names none. The algorithm must be one of allowed for the key type.
+func withMethod(alg, fallback string, key any, allowed ...string) (*remoteKey, error) {
+	if alg == "" {
+		alg = fallback
+	}
+	for _, a := range allowed {
+		if a == alg {
+			return &remoteKey{method: jwt.GetSigningMethod(alg), key: key}, nil
+		}
+	}
+	return nil, fmt.Errorf("algorithm %q does not match the key type", alg)
+}
+
+func decodeField(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
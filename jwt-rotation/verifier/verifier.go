@@ -0,0 +1,341 @@
+// Package verifier validates tokens against a JWKS published by a locksmith
+// keyring, for services that have no access to the secret storage.
+package verifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	secrets "token-toolkit/jwt-rotation"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DefaultCacheTTL is how long a JWKS is cached when the response has no cache headers.
+	DefaultCacheTTL = 5 * time.Minute
+	// DefaultMaxCacheTTL caps the lifetime the cache headers may ask for.
+	DefaultMaxCacheTTL = 24 * time.Hour
+	// DefaultMinRefreshInterval is the least time between two fetches.
+	DefaultMinRefreshInterval = 30 * time.Second
+	// DefaultFetchTimeout bounds each fetch.
+	DefaultFetchTimeout = 10 * time.Second
+)
+
+// the largest JWKS that is read.
+const maxJWKSSize = 1 << 20
+
+// configures a RemoteVerifier, zero values use the defaults.
+type Options struct {
+	// the client used to fetch the JWKS, http.DefaultClient when nil.
+	Client *http.Client
+	// used when the response carries no Cache-Control max-age or Expires.
+	CacheTTL time.Duration
+	// the longest the JWKS is cached, whatever the headers say.
+	MaxCacheTTL time.Duration
+	// the least time between two fetches. It bounds how often tokens with
+	// unknown kids can make the verifier refetch, and how often a failing
+	// JWKS URL is retried.
+	MinRefreshInterval time.Duration
+	// bounds each fetch.
+	FetchTimeout time.Duration
+	// the claims tokens must carry, as for secrets.JWTManager.
+	Validation secrets.ValidationPolicy
+}
+
+// the keys of one JWKS response.
+type keySet struct {
+	keys map[string]*remoteKey
+	// when the keys must be revalidated.
+	expires time.Time
+	// validators for conditional requests.
+	etag         string
+	lastModified string
+}
+
+// RemoteVerifier validates tokens against the keys of a remote JWKS. It
+// offers the same ValidateToken as secrets.JWTManager. Keys are cached as the
+// response's Cache-Control or Expires headers allow, and refetched when they
+// expire or a token names a kid that is not in the cache, at most once every
+// MinRefreshInterval. Only one fetch runs at a time. Expired keys stay in use
+// while they are refetched in the background, only a token with an unknown
+// kid waits for the fetch. If a refetch fails, the cached keys stay in use.
+type RemoteVerifier struct {
+	url     string
+	options Options
+	parser  *secrets.TokenParser
+	keys    atomic.Pointer[keySet]
+
+	// guards the fields below, never held while fetching.
+	mutex sync.Mutex
+	// closed when the running fetch ends, nil when none runs.
+	fetching    chan struct{}
+	lastAttempt time.Time
+	lastError   error
+}
+
+var _ secrets.TokenValidator = (*RemoteVerifier)(nil)
+
+// creates a verifier for the JWKS at jwksURL and fetches it once, so a wrong
+// URL is reported right away.
+func NewRemoteVerifier(ctx context.Context, jwksURL string, options Options) (*RemoteVerifier, error) {
+	if options.Client == nil {
+		options.Client = http.DefaultClient
+	}
+	if options.CacheTTL <= 0 {
+		options.CacheTTL = DefaultCacheTTL
+	}
+	if options.MaxCacheTTL <= 0 {
+		options.MaxCacheTTL = DefaultMaxCacheTTL
+	}
+	if options.MinRefreshInterval <= 0 {
+		options.MinRefreshInterval = DefaultMinRefreshInterval
+	}
+	if options.FetchTimeout <= 0 {
+		options.FetchTimeout = DefaultFetchTimeout
+	}
+
+	parser, err := secrets.NewTokenParser(options.Validation)
+	if err != nil {
+		return nil, fmt.Errorf("invalid validation policy: %w", err)
+	}
+
+	v := &RemoteVerifier{url: jwksURL, options: options, parser: parser}
+	v.keys.Store(&keySet{})
+	if err := v.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// ValidateToken parses and validates a JWT token string. The key is looked up
+// by the token's kid, and the token must use the algorithm of that key. The
+// claims are then checked against Options.Validation.
+func (v *RemoteVerifier) ValidateToken(tokenString string) (*jwt.Token, error) {
+	return v.parser.Parse(tokenString, v.keyFunc)
+}
+
+func (v *RemoteVerifier) keyFunc(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	set := v.keys.Load()
+	if !time.Now().Before(set.expires) {
+		// Keep validating with the expired keys while they are refetched.
+		v.refresh(false)
+	}
+	key, ok := set.keys[kid]
+	if !ok {
+		// The kid may belong to a key published since the last fetch.
+		if done := v.refresh(true); done != nil {
+			<-done
+		}
+		key, ok = v.keys.Load().keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("token validation failed: key with kid '%s' not found", kid)
+	}
+	if token.Method != key.method {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.key, nil
+}
+
+// Refresh fetches the JWKS now, regardless of the cache and MinRefreshInterval.
+// A fetch that is already running is waited for first.
+func (v *RemoteVerifier) Refresh(ctx context.Context) error {
+	for {
+		v.mutex.Lock()
+		running := v.fetching
+		if running == nil {
+			v.startFetch()
+			v.mutex.Unlock()
+			return v.fetch(ctx)
+		}
+		v.mutex.Unlock()
+
+		select {
+		case <-running:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// returns the error of the last fetch, nil if it succeeded.
+func (v *RemoteVerifier) LastError() error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	return v.lastError
+}
+
+// refetches the JWKS in the background unless a fetch is running or another
+// caller just fetched, and returns a channel closed when the running fetch
+// ends, nil if none runs. With unknownKid the cached keys are refetched even
+// if they have not expired.
+func (v *RemoteVerifier) refresh(unknownKid bool) <-chan struct{} {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if v.fetching != nil {
+		return v.fetching
+	}
+	// Another caller may have fetched since the keys were loaded.
+	if !unknownKid && time.Now().Before(v.keys.Load().expires) {
+		return nil
+	}
+	if time.Since(v.lastAttempt) < v.options.MinRefreshInterval {
+		return nil
+	}
+
+	done := v.startFetch()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), v.options.FetchTimeout)
+		defer cancel()
+		if err := v.fetch(ctx); err != nil {
+			fmt.Printf("Error refreshing JWKS from %s: %v\n", v.url, err)
+		}
+	}()
+	return done
+}
+
+// marks a fetch as running. The caller must hold the mutex and then call fetch.
+func (v *RemoteVerifier) startFetch() chan struct{} {
+	v.fetching = make(chan struct{})
+	v.lastAttempt = time.Now()
+	return v.fetching
+}
+
+// fetches the JWKS and replaces the cached keys, then marks the fetch started
+// by startFetch as ended. On failure the cached keys are kept until the next
+// attempt is allowed.
+func (v *RemoteVerifier) fetch(ctx context.Context) error {
+	now := time.Now()
+	// No other fetch can replace the keys while this one runs.
+	set := v.keys.Load()
+	next, err := v.get(ctx, set, now)
+
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if err != nil {
+		stale := *set
+		stale.expires = now.Add(v.options.MinRefreshInterval)
+		next = &stale
+	}
+	v.keys.Store(next)
+	v.lastError = err
+	close(v.fetching)
+	v.fetching = nil
+	return err
+}
+
+// requests the JWKS, conditionally if the cached keys have validators.
+func (v *RemoteVerifier) get(ctx context.Context, cached *keySet, now time.Time) (*keySet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, v.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWKS URL: %w", err)
+	}
+	req.Header.Set("Accept", secrets.JWKSContentType+", application/json")
+	if cached.keys != nil {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	resp, err := v.options.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	next := &keySet{
+		expires:      now.Add(v.cacheTTL(resp.Header, now)),
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached.keys != nil:
+		next.keys = cached.keys
+		if next.etag == "" {
+			next.etag = cached.etag
+		}
+		if next.lastModified == "" {
+			next.lastModified = cached.lastModified
+		}
+		return next, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("failed to fetch JWKS: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS: %w", err)
+	}
+	if len(body) > maxJWKSSize {
+		return nil, errors.New("JWKS is larger than 1 MiB")
+	}
+	var jwks secrets.JWKS
+	if err := json.Unmarshal(body, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+	next.keys = parseKeys(&jwks)
+	return next, nil
+}
+
+// returns how long a response may be cached: its Cache-Control max-age minus
+// its Age, or else the time until Expires, bounded by MinRefreshInterval and
+// MaxCacheTTL. no-cache and no-store count as zero, so the keys are
+// revalidated as often as MinRefreshInterval allows.
+func (v *RemoteVerifier) cacheTTL(header http.Header, now time.Time) time.Duration {
+	ttl, ok := headerTTL(header, now)
+	if !ok {
+		ttl = v.options.CacheTTL
+	}
+	return min(max(ttl, v.options.MinRefreshInterval), v.options.MaxCacheTTL)
+}
+
+// reads the freshness lifetime from the cache headers, false if they set none.
+func headerTTL(header http.Header, now time.Time) (time.Duration, bool) {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache", "no-store":
+			return 0, true
+		case "max-age":
+			seconds, err := strconv.ParseInt(strings.Trim(value, `"`), 10, 64)
+			if err != nil {
+				continue
+			}
+			ttl := time.Duration(seconds) * time.Second
+			if age, err := strconv.ParseInt(header.Get("Age"), 10, 64); err == nil {
+				ttl -= time.Duration(age) * time.Second
+			}
+			return ttl, true
+		}
+	}
+
+	if expires := header.Get("Expires"); expires != "" {
+		at, err := http.ParseTime(expires)
+		if err != nil {
+			// An invalid Expires means already expired.
+			return 0, true
+		}
+		if date, err := http.ParseTime(header.Get("Date")); err == nil {
+			now = date
+		}
+		return at.Sub(now), true
+	}
+	return 0, false
+}
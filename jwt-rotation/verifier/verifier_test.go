@@ -0,0 +1,108 @@
+package verifier
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	secrets "token-toolkit/jwt-rotation"
+	"token-toolkit/jwt-rotation/storage"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// validates a token in the background, the result is sent on the returned channel.
+func validate(v *RemoteVerifier, token string) <-chan error {
+	result := make(chan error, 1)
+	go func() {
+		_, err := v.ValidateToken(token)
+		result <- err
+	}()
+	return result
+}
+
+func TestExpiredKeysAreRefreshedInTheBackground(t *testing.T) {
+	ctx := context.Background()
+	generator, err := secrets.NewKeyGenerator(secrets.AlgES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jm, err := secrets.NewJWTManagerWithGenerator(ctx, secrets.RotationPolicy{GracePeriod: time.Hour}, generator, storage.NewMemoryStorage(), nil)
+	if err != nil {
+		t.Fatalf("NewJWTManagerWithGenerator failed: %v", err)
+	}
+	sign := func() string {
+		t.Helper()
+		token, err := jm.SignToken(jwt.RegisteredClaims{Subject: "test"})
+		if err != nil {
+			t.Fatalf("SignToken failed: %v", err)
+		}
+		return token
+	}
+
+	// Every fetch after the first hangs until release is closed.
+	release := make(chan struct{})
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) > 1 {
+			<-release
+		}
+		jwks, err := jm.JWKS()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-cache")
+		json.NewEncoder(w).Encode(jwks)
+	}))
+	t.Cleanup(server.Close)
+	released := false
+	t.Cleanup(func() {
+		if !released {
+			close(release)
+		}
+	})
+
+	v, err := NewRemoteVerifier(ctx, server.URL, Options{MinRefreshInterval: time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewRemoteVerifier failed: %v", err)
+	}
+	known := sign()
+	time.Sleep(10 * time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		select {
+		case err := <-validate(v, known):
+			if err != nil {
+				t.Fatalf("ValidateToken with expired keys failed: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("ValidateToken waited for the refetch of expired keys")
+		}
+	}
+	for deadline := time.Now().Add(5 * time.Second); requests.Load() < 2 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("JWKS fetched %d times, want the first fetch and one refetch", got)
+	}
+
+	if _, err := jm.RotateSecret(ctx); err != nil {
+		t.Fatalf("RotateSecret failed: %v", err)
+	}
+	unknown := validate(v, sign())
+	select {
+	case err := <-unknown:
+		t.Fatalf("ValidateToken of an unknown kid returned %v before the running fetch ended", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	released = true
+	if err := <-unknown; err != nil {
+		t.Fatalf("ValidateToken of the rotated kid failed: %v", err)
+	}
+}
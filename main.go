@@ -61,6 +61,12 @@ type model struct {
 	styles            *Styles
 	message           string
 	initialAction     initialAction
+	// details asked for by revoke and rollback, e.g. the kid and a reason.
+	actionInputs []textinput.Model
+
+	// cancelled on ctrl+c so in-flight provider calls stop with the UI.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 type appState int
@@ -73,6 +79,8 @@ const (
 	enteringConfig
 	choosingNotifier
 	choosingMode
+	enteringDetails
+	confirmingAction
 	generatingScript
 	rotating
 	done
@@ -87,15 +95,27 @@ const (
 const (
 	actionRotate initialAction = iota
 	actionCheckStatus
+	actionRevoke
+	actionRollback
 )
 
+var actionChoices = []string{"Rotate Secrets", "Check Status", "Revoke a Key", "Roll Back to the Previous Key"}
+
 func initialModel() model {
 	s := spinner.New()
 	s.Spinner = spinner.Dot
 	s.Style = lipgloss.NewStyle().Foreground(lipgloss.Color("205"))
 
+	var providerChoices []string
+	for _, backend := range storage.Backends() {
+		providerChoices = append(providerChoices, backend.DisplayName)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
 	return model{
-		providerChoices:   []string{"GCP", "AWS", "Azure"},
+		ctx:               ctx,
+		cancel:            cancel,
+		providerChoices:   providerChoices,
 		state:             choosingAction,
 		notifierChoices:   []string{"Sentry", "Slack"},
 		selectedNotifiers: make(map[int]struct{}),
@@ -114,6 +134,10 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 	switch msg := msg.(type) {
 	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			m.cancel()
+			return m, tea.Quit
+		}
 		switch m.state {
 		case choosingAction:
 			return updateChoosingAction(msg, m)
@@ -125,6 +149,10 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return updateChoosingNotifier(msg, m)
 		case choosingMode:
 			return updateChoosingMode(msg, m)
+		case enteringDetails:
+			return updateEnteringDetails(msg, m)
+		case confirmingAction:
+			return updateConfirmingAction(msg, m)
 		case done, appError:
 			switch msg.String() {
 			case "ctrl+c", "q":
@@ -142,13 +170,21 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case *rotationStartedMsg:
 		m.state = rotating
 		return m, nil
+	case *revokedMsg:
+		m.state = done
+		m.message = revocationSummary(msg.revocation)
+		return m, tea.Quit
+	case *rolledBackMsg:
+		m.state = done
+		m.message = rollbackSummary(msg.rollback)
+		return m, tea.Quit
 	case *scriptGeneratedMsg:
 		m.state = done
 		m.message = "Deployment script generated: " + msg.filename
 		return m, tea.Quit
 	case *statusMsg:
 		m.state = done
-		m.message = fmt.Sprintf("Last rotation: %s", msg.lastRotated.Format(time.RFC3339))
+		m.message = rotationTimesSummary(msg.lastRotated, msg.nextRotation)
 		return m, tea.Quit
 	}
 
@@ -167,7 +203,7 @@ func updateChoosingAction(msg tea.KeyMsg, m model) (tea.Model, tea.Cmd) {
 			m.cursor--
 		}
 	case "down", "j":
-		if m.cursor < 1 {
+		if m.cursor < len(actionChoices)-1 {
 			m.cursor++
 		}
 	case "enter":
@@ -197,11 +233,32 @@ func updateChoosingProvider(msg tea.KeyMsg, m model) (tea.Model, tea.Cmd) {
 		m.state = enteringConfig
 		m.cursor = 0
 		m.configInputs = setupConfigInputs(m.provider)
+		if len(m.configInputs) == 0 {
+			// Nothing to configure, e.g. for the in-memory storage.
+			return configEntered(m)
+		}
 		return m, m.configInputs[0].Focus()
 	}
 	return m, nil
 }
 
+// moves on from the provider configuration to the next step of the action.
+func configEntered(m model) (tea.Model, tea.Cmd) {
+	if m.initialAction == actionCheckStatus {
+		m.state = rotating // we can reuse this state to show a spinner
+		return m, checkStatus(m)
+	}
+	if m.initialAction == actionRevoke || m.initialAction == actionRollback {
+		m.state = enteringDetails
+		m.cursor = 0
+		m.actionInputs = setupActionInputs(m.initialAction)
+		return m, m.actionInputs[0].Focus()
+	}
+	m.state = choosingNotifier
+	m.cursor = 0
+	return m, nil
+}
+
 func updateEnteringConfig(msg tea.KeyMsg, m model) (tea.Model, tea.Cmd) {
 	var cmds []tea.Cmd
 	var cmd tea.Cmd
@@ -211,13 +268,7 @@ func updateEnteringConfig(msg tea.KeyMsg, m model) (tea.Model, tea.Cmd) {
 		return m, tea.Quit
 	case "enter":
 		if m.cursor == len(m.configInputs) {
-			if m.initialAction == actionCheckStatus {
-				m.state = rotating // we can reuse this state to show a spinner
-				return m, checkStatus(m)
-			}
-			m.state = choosingNotifier
-			m.cursor = 0
-			return m, nil
+			return configEntered(m)
 		}
 		if m.cursor < len(m.configInputs)-1 {
 			m.cursor++
@@ -272,6 +323,10 @@ func updateChoosingNotifier(msg tea.KeyMsg, m model) (tea.Model, tea.Cmd) {
 			m.selectedNotifiers[m.cursor] = struct{}{}
 		}
 	case "enter":
+		if m.initialAction == actionRevoke || m.initialAction == actionRollback {
+			m.state = confirmingAction
+			return m, nil
+		}
 		m.state = choosingMode
 		m.cursor = 0
 		return m, nil
@@ -279,6 +334,70 @@ func updateChoosingNotifier(msg tea.KeyMsg, m model) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+func updateEnteringDetails(msg tea.KeyMsg, m model) (tea.Model, tea.Cmd) {
+	var cmds []tea.Cmd
+	var cmd tea.Cmd
+
+	switch msg.String() {
+	case "ctrl+c":
+		return m, tea.Quit
+	case "enter":
+		if m.cursor == len(m.actionInputs)-1 {
+			if m.initialAction == actionRevoke && strings.TrimSpace(m.actionInputs[0].Value()) == "" {
+				m.cursor = 0
+				return m, m.actionInputs[0].Focus()
+			}
+			m.actionInputs[m.cursor].Blur()
+			m.state = choosingNotifier
+			m.cursor = 0
+			return m, nil
+		}
+		m.actionInputs[m.cursor].Blur()
+		m.cursor++
+		cmds = append(cmds, m.actionInputs[m.cursor].Focus())
+	case "up":
+		if m.cursor > 0 {
+			m.actionInputs[m.cursor].Blur()
+			m.cursor--
+			cmds = append(cmds, m.actionInputs[m.cursor].Focus())
+		}
+	case "down":
+		if m.cursor < len(m.actionInputs)-1 {
+			m.actionInputs[m.cursor].Blur()
+			m.cursor++
+			cmds = append(cmds, m.actionInputs[m.cursor].Focus())
+		}
+	}
+
+	for i := range m.actionInputs {
+		m.actionInputs[i], cmd = m.actionInputs[i].Update(msg)
+		cmds = append(cmds, cmd)
+	}
+
+	return m, tea.Batch(cmds...)
+}
+
+func updateConfirmingAction(msg tea.KeyMsg, m model) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c", "q", "n", "esc":
+		m.state = done
+		m.message = "Cancelled, nothing was changed."
+		return m, tea.Quit
+	case "y":
+		m.state = rotating
+		if m.initialAction == actionRollback {
+			return m, tea.Batch(runRollback(m, false), m.spinner.Tick)
+		}
+		return m, tea.Batch(runRevocation(m), m.spinner.Tick)
+	case "r":
+		if m.initialAction == actionRollback {
+			m.state = rotating
+			return m, tea.Batch(runRollback(m, true), m.spinner.Tick)
+		}
+	}
+	return m, nil
+}
+
 func updateChoosingMode(msg tea.KeyMsg, m model) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "ctrl+c", "q":
@@ -288,7 +407,7 @@ func updateChoosingMode(msg tea.KeyMsg, m model) (tea.Model, tea.Cmd) {
 			m.cursor--
 		}
 	case "down", "j":
-		if m.cursor < 1 {
+		if m.cursor < len(modeChoices(m.provider))-1 {
 			m.cursor++
 		}
 	case "enter":
@@ -305,6 +424,14 @@ func updateChoosingMode(msg tea.KeyMsg, m model) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// the ways to run a rotation. Only cloud providers can be deployed to run periodically.
+func modeChoices(provider string) []string {
+	if !deployment.CanDeploy(provider) {
+		return []string{"Run once"}
+	}
+	return []string{"Run once", "Run periodically (deploy to cloud)"}
+}
+
 func (m model) View() string {
 	var b strings.Builder
 
@@ -315,8 +442,7 @@ func (m model) View() string {
 	case choosingAction:
 		b.WriteString(m.styles.Title.Render("What would you like to do?"))
 		b.WriteString("\n")
-		actions := []string{"Rotate Secrets", "Check Status"}
-		for i, action := range actions {
+		for i, action := range actionChoices {
 			if m.cursor == i {
 				b.WriteString(m.styles.Selected.Render(action))
 			} else {
@@ -378,8 +504,7 @@ func (m model) View() string {
 	case choosingMode:
 		b.WriteString(m.styles.Title.Render("How do you want to run the rotation?"))
 		b.WriteString("\n\n")
-		choices := []string{"Run once", "Run periodically (deploy to cloud)"}
-		for i, choice := range choices {
+		for i, choice := range modeChoices(m.provider) {
 			if m.cursor == i {
 				b.WriteString(m.styles.Selected.Render(choice))
 			} else {
@@ -387,10 +512,45 @@ func (m model) View() string {
 			}
 			b.WriteString("\n")
 		}
+	case enteringDetails:
+		if m.initialAction == actionRollback {
+			b.WriteString(m.styles.Title.Render("Why are you rolling back?"))
+		} else {
+			b.WriteString(m.styles.Title.Render("Which secret should be revoked?"))
+		}
+		b.WriteString("\n")
+		for i, input := range m.actionInputs {
+			b.WriteString(input.View())
+			if m.cursor == i {
+				b.WriteString(" <")
+			}
+			b.WriteString("\n")
+		}
+
+	case confirmingAction:
+		if m.initialAction == actionRollback {
+			b.WriteString(m.styles.Error.Render("Roll back to the previous signing key?"))
+			b.WriteString("\n\n")
+			b.WriteString("The previous key signs again and the current key is demoted.\n")
+			b.WriteString("Press 'y' to keep the current key for verification, 'r' to retire (revoke) it, or 'n' to cancel.\n")
+		} else {
+			b.WriteString(m.styles.Error.Render(fmt.Sprintf("Revoke secret %s?", strings.TrimSpace(m.actionInputs[0].Value()))))
+			b.WriteString("\n\n")
+			b.WriteString("Tokens signed with it stop validating immediately, and it is replaced first if it is signing.\n")
+			b.WriteString("Press 'y' to revoke or 'n' to cancel.\n")
+		}
+
 	case generatingScript:
 		b.WriteString(fmt.Sprintf("%s Generating deployment script...", m.spinner.View()))
 	case rotating:
-		b.WriteString(fmt.Sprintf("%s Rotating secret...", m.spinner.View()))
+		switch m.initialAction {
+		case actionRevoke:
+			b.WriteString(fmt.Sprintf("%s Revoking secret...", m.spinner.View()))
+		case actionRollback:
+			b.WriteString(fmt.Sprintf("%s Rolling back...", m.spinner.View()))
+		default:
+			b.WriteString(fmt.Sprintf("%s Rotating secret...", m.spinner.View()))
+		}
 	case done:
 		b.WriteString(m.styles.Title.Render(m.message))
 	case appError:
@@ -402,158 +562,323 @@ func (m model) View() string {
 }
 
 func setupConfigInputs(provider string) []textinput.Model {
-	var inputs []textinput.Model
-	switch provider {
-	case "GCP":
-		inputs = make([]textinput.Model, 2)
-		inputs[0] = textinput.New()
-		inputs[0].Placeholder = "Project ID"
-		inputs[0].Focus()
-		inputs[1] = textinput.New()
-		inputs[1].Placeholder = "Secret ID"
-	case "AWS":
-		inputs = make([]textinput.Model, 2)
-		inputs[0] = textinput.New()
-		inputs[0].Placeholder = "Secret ID"
-		inputs[0].Focus()
-		inputs[1] = textinput.New()
-		inputs[1].Placeholder = "Region"
-	case "Azure":
-		inputs = make([]textinput.Model, 2)
-		inputs[0] = textinput.New()
-		inputs[0].Placeholder = "Vault URI"
+	cfg, err := newProviderConfig(provider)
+	if err != nil {
+		return nil
+	}
+
+	fields := storage.ConfigFields(cfg)
+	env := storage.EnvSource("")
+	inputs := make([]textinput.Model, len(fields))
+	for i, field := range fields {
+		inputs[i] = textinput.New()
+		inputs[i].Placeholder = field.Label
+		if value, ok := env(field); ok {
+			inputs[i].SetValue(value)
+		}
+	}
+	if len(inputs) > 0 {
 		inputs[0].Focus()
-		inputs[1] = textinput.New()
-		inputs[1].Placeholder = "Secret Name"
 	}
 	return inputs
 }
 
+// returns the inputs for the details of a revoke or rollback.
+func setupActionInputs(action initialAction) []textinput.Model {
+	reason := textinput.New()
+	reason.Placeholder = "Reason"
+	if action != actionRevoke {
+		return []textinput.Model{reason}
+	}
+
+	kid := textinput.New()
+	kid.Placeholder = "Secret ID (kid)"
+	return []textinput.Model{kid, reason}
+}
+
+// loads the provider configuration from the values typed into the TUI.
+func loadInputConfig(m model) (any, error) {
+	cfg, err := newProviderConfig(m.provider)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	for i, field := range storage.ConfigFields(cfg) {
+		if i < len(m.configInputs) {
+			values[field.Key] = m.configInputs[i].Value()
+		}
+	}
+	if err := storage.LoadConfig(cfg, storage.MapSource(values)); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// returns an empty configuration struct for a provider.
+func newProviderConfig(provider string) (any, error) {
+	backend, ok := storage.Lookup(provider)
+	if !ok {
+		return nil, fmt.Errorf("unsupported provider: %s", provider)
+	}
+	return backend.NewConfig(), nil
+}
+
+// creates and configures the storage backend for a provider.
+func openStorage(ctx context.Context, provider string, cfg any) (storage.SecretStorage, error) {
+	backend, ok := storage.Lookup(provider)
+	if !ok {
+		return nil, fmt.Errorf("unsupported provider: %s", provider)
+	}
+	return backend.Open(ctx, cfg)
+}
+
+// builds a notifier from the selected notifier names.
+func buildNotifier(names []string) secrets.Notifier {
+	var notifiersList []secrets.Notifier
+	for _, name := range names {
+		switch name {
+		case "Sentry":
+			sentryNotifier, err := notifiers.NewSentryNotifier()
+			if err != nil {
+				log.Printf("Failed to create sentry notifier: %v", err)
+			} else if sentryNotifier != nil {
+				notifiersList = append(notifiersList, sentryNotifier)
+			}
+		case "Slack":
+			slackNotifier, err := notifiers.NewSlackNotifier()
+			if err != nil {
+				log.Printf("Failed to create slack notifier: %v", err)
+			} else if slackNotifier != nil {
+				notifiersList = append(notifiersList, slackNotifier)
+			}
+		}
+	}
+
+	return notifiers.NewMultiNotifier(notifiersList...)
+}
+
+// returns the rotation policy used for one-off rotations.
+func defaultPolicy() secrets.RotationPolicy {
+	return secrets.RotationPolicy{
+		RotationInterval: 0,
+		GracePeriod:      48 * time.Hour,
+		StorageTimeout:   30 * time.Second,
+	}
+}
+
+// opens the provider and loads its keyring into a JWT manager.
+func openManager(ctx context.Context, provider string, cfg any, policy secrets.RotationPolicy, notifier secrets.Notifier) (*secrets.JWTManager, error) {
+	storageProvider, err := openStorage(ctx, provider, cfg)
+	if err != nil {
+		log.Printf("Error setting up storage: %v", err)
+		return nil, err
+	}
+
+	generator, err := secrets.KeyGeneratorFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	secretManager, err := secrets.NewJWTManagerWithGenerator(ctx, policy, generator, storageProvider, notifier)
+	if err != nil {
+		log.Printf("Failed to create secret manager: %v", err)
+		return nil, err
+	}
+	return secretManager, nil
+}
+
+// performs a single rotation against the configured provider.
+// The rotation is rolled back if any of the canaries fails.
+func rotateOnce(ctx context.Context, provider string, cfg any, policy secrets.RotationPolicy, notifier secrets.Notifier, canaries ...secrets.Canary) error {
+	secretManager, err := openManager(ctx, provider, cfg, policy, notifier)
+	if err != nil {
+		return err
+	}
+	secretManager.AddCanary(canaries...)
+
+	if _, err := secretManager.RotateSecret(ctx); err != nil {
+		log.Printf("Failed to rotate secret: %v", err)
+		return err
+	}
+	return nil
+}
+
+// returns when the secret was last rotated and when the rotation schedule set
+// in ROTATION_SCHEDULE next comes due, zero if none is set.
+func rotationTimes(ctx context.Context, provider string, cfg any) (last, next time.Time, err error) {
+	storageProvider, err := openStorage(ctx, provider, cfg)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	latestSecret, err := storageProvider.GetLatest(ctx)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+
+	policy := defaultPolicy()
+	if err := policy.LoadScheduleEnv(); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	next, err = policy.NextRotation(latestSecret.CreatedAt, time.Now())
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return latestSecret.CreatedAt, next, nil
+}
+
+// describes when the secret was last and will next be rotated.
+func rotationTimesSummary(last, next time.Time) string {
+	summary := fmt.Sprintf("Last rotation: %s", last.Format(time.RFC3339))
+	if next.IsZero() {
+		return summary + "\nNext rotation: not scheduled, set ROTATION_SCHEDULE to show it"
+	}
+	return summary + fmt.Sprintf("\nNext rotation: %s", next.Format(time.RFC3339))
+}
+
 func runRotation(m model) tea.Cmd {
 	return func() tea.Msg {
-		config := make(map[string]string)
-		for _, input := range m.configInputs {
-			config[strings.ToLower(strings.ReplaceAll(input.Placeholder, " ", ""))] = input.Value()
+		cfg, err := loadInputConfig(m)
+		if err != nil {
+			return &rotationErrMsg{err}
 		}
 
-		var storageProvider storage.SecretStorage
-		switch m.provider {
-		case "GCP":
-			storageProvider = storage.NewGCPSecretManager()
-		case "AWS":
-			storageProvider = storage.NewAWSSecretsManager()
-		case "Azure":
-			storageProvider = storage.NewAzureKeyVault()
+		var names []string
+		for i := range m.selectedNotifiers {
+			names = append(names, m.notifierChoices[i])
 		}
 
-		ctx := context.Background()
-		if err := storageProvider.Setup(ctx, config); err != nil {
-			log.Printf("Error setting up storage: %v", err)
+		if err := rotateOnce(m.ctx, m.provider, cfg, defaultPolicy(), buildNotifier(names)); err != nil {
 			return &rotationErrMsg{err}
 		}
+		return &rotationMsg{}
+	}
+}
 
-		policy := secrets.RotationPolicy{
-			RotationInterval: 0,
-			GracePeriod:      48 * time.Hour,
+func runRevocation(m model) tea.Cmd {
+	return func() tea.Msg {
+		cfg, err := loadInputConfig(m)
+		if err != nil {
+			return &rotationErrMsg{err}
 		}
 
-		var notifiersList []secrets.Notifier
+		var names []string
 		for i := range m.selectedNotifiers {
-			switch m.notifierChoices[i] {
-			case "Sentry":
-				sentryNotifier, err := notifiers.NewSentryNotifier()
-				if err != nil {
-					log.Printf("Failed to create sentry notifier: %v", err)
-				} else if sentryNotifier != nil {
-					notifiersList = append(notifiersList, sentryNotifier)
-				}
-			case "Slack":
-				slackNotifier, err := notifiers.NewSlackNotifier()
-				if err != nil {
-					log.Printf("Failed to create slack notifier: %v", err)
-				} else if slackNotifier != nil {
-					notifiersList = append(notifiersList, slackNotifier)
-				}
-			}
+			names = append(names, m.notifierChoices[i])
 		}
 
-		notifier := notifiers.NewMultiNotifier(notifiersList...)
-
-		secretManager, err := secrets.NewJWTManager(policy, 64, storageProvider, notifier)
+		secretManager, err := openManager(m.ctx, m.provider, cfg, defaultPolicy(), buildNotifier(names))
 		if err != nil {
-			log.Printf("Failed to create secret manager: %v", err)
 			return &rotationErrMsg{err}
 		}
-
-		if _, err := secretManager.RotateSecret(); err != nil {
-			log.Printf("Failed to rotate secret: %v", err)
+		kid := strings.TrimSpace(m.actionInputs[0].Value())
+		revocation, err := secretManager.Revoke(m.ctx, kid, strings.TrimSpace(m.actionInputs[1].Value()))
+		if err != nil {
 			return &rotationErrMsg{err}
 		}
-		return &rotationMsg{}
+		return &revokedMsg{revocation: revocation}
 	}
 }
 
-func checkStatus(m model) tea.Cmd {
+func runRollback(m model, retire bool) tea.Cmd {
 	return func() tea.Msg {
-		if m.provider == "" {
-			return &rotationErrMsg{fmt.Errorf("provider not selected")}
+		cfg, err := loadInputConfig(m)
+		if err != nil {
+			return &rotationErrMsg{err}
 		}
 
-		config := make(map[string]string)
-		for _, input := range m.configInputs {
-			config[strings.ToLower(strings.ReplaceAll(input.Placeholder, " ", ""))] = input.Value()
+		var names []string
+		for i := range m.selectedNotifiers {
+			names = append(names, m.notifierChoices[i])
 		}
 
-		var storageProvider storage.SecretStorage
-		switch m.provider {
-		case "GCP":
-			storageProvider = storage.NewGCPSecretManager()
-		case "AWS":
-			storageProvider = storage.NewAWSSecretsManager()
-		case "Azure":
-			storageProvider = storage.NewAzureKeyVault()
-		default:
-			return &rotationErrMsg{fmt.Errorf("unsupported provider: %s", m.provider)}
+		secretManager, err := openManager(m.ctx, m.provider, cfg, defaultPolicy(), buildNotifier(names))
+		if err != nil {
+			return &rotationErrMsg{err}
 		}
+		rollback, err := secretManager.Rollback(m.ctx, strings.TrimSpace(m.actionInputs[0].Value()), retire)
+		if err != nil {
+			return &rotationErrMsg{err}
+		}
+		return &rolledBackMsg{rollback: rollback}
+	}
+}
+
+// describes the outcome of a rollback for the CLI and the TUI.
+func rollbackSummary(rollback *secrets.Rollback) string {
+	summary := fmt.Sprintf("Rolled back to secret %s, secret %s only verifies tokens now.", rollback.Restored.ID, rollback.Faulty.ID)
+	if rollback.Retired {
+		summary = fmt.Sprintf("Rolled back to secret %s, secret %s was retired.", rollback.Restored.ID, rollback.Faulty.ID)
+	}
+	if rollback.Reason != "" {
+		summary += " Reason: " + rollback.Reason
+	}
+	return summary
+}
 
-		if storageProvider == nil {
-			return &rotationErrMsg{fmt.Errorf("failed to create storage provider for %s", m.provider)}
+// describes the outcome of a revocation for the CLI and the TUI.
+func revocationSummary(revocation *secrets.Revocation) string {
+	if revocation.Replacement == nil {
+		return fmt.Sprintf("Secret %s revoked.", revocation.ID)
+	}
+	return fmt.Sprintf("Secret %s revoked, secret %s now signs tokens.", revocation.ID, revocation.Replacement.ID)
+}
+
+func checkStatus(m model) tea.Cmd {
+	return func() tea.Msg {
+		if m.provider == "" {
+			return &rotationErrMsg{fmt.Errorf("provider not selected")}
 		}
 
-		ctx := context.Background()
-		if err := storageProvider.Setup(ctx, config); err != nil {
+		cfg, err := loadInputConfig(m)
+		if err != nil {
 			return &rotationErrMsg{err}
 		}
 
-		latestSecret, err := storageProvider.GetLatest(ctx)
+		lastRotated, nextRotation, err := rotationTimes(m.ctx, m.provider, cfg)
 		if err != nil {
 			return &rotationErrMsg{err}
 		}
 
 		return &statusMsg{
-			lastRotated: latestSecret.CreatedAt,
+			lastRotated:  lastRotated,
+			nextRotation: nextRotation,
 		}
 	}
 }
 
 func generateScriptCmd(m model) tea.Cmd {
 	return func() tea.Msg {
-		config := make(map[string]string)
-		for _, input := range m.configInputs {
-			key := strings.ToLower(strings.ReplaceAll(input.Placeholder, " ", ""))
-			config[key] = input.Value()
+		cfg, err := loadInputConfig(m)
+		if err != nil {
+			return &rotationErrMsg{err}
 		}
 
 		data := deployment.ScriptData{
 			Provider:       m.provider,
-			SecretID:       config["secretid"],
-			ProjectID:      config["projectid"],
-			Region:         config["region"],
-			VaultURI:       config["vaulturi"],
-			SecretName:     config["secretname"],
 			SentryDSN:      os.Getenv("SENTRY_DSN"),
 			SlackBotToken:  os.Getenv("SLACK_BOT_TOKEN"),
 			SlackChannelID: os.Getenv("SLACK_CHANNEL_ID"),
+			Schedule:       os.Getenv("ROTATION_SCHEDULE"),
+			Blackouts:      os.Getenv("ROTATION_BLACKOUTS"),
+			Algorithm:      os.Getenv("JWT_ALGORITHM"),
+		}
+		if jitter := os.Getenv("ROTATION_JITTER"); jitter != "" {
+			if data.Jitter, err = time.ParseDuration(jitter); err != nil {
+				return &rotationErrMsg{fmt.Errorf("invalid ROTATION_JITTER: %w", err)}
+			}
+		}
+		switch c := cfg.(type) {
+		case *storage.GCPConfig:
+			data.ProjectID = c.ProjectID
+			data.SecretID = c.SecretID
+		case *storage.AWSConfig:
+			data.SecretID = c.SecretID
+			data.Region = c.Region
+		case *storage.AzureConfig:
+			data.VaultURI = c.VaultURI
+			data.SecretName = c.SecretName
 		}
 
 		script, err := deployment.GenerateScript(data)
@@ -572,7 +897,9 @@ func generateScriptCmd(m model) tea.Cmd {
 
 type scriptGeneratedMsg struct{ filename string }
 type rotationMsg struct{}
-type statusMsg struct{ lastRotated time.Time }
+type statusMsg struct{ lastRotated, nextRotation time.Time }
+type revokedMsg struct{ revocation *secrets.Revocation }
+type rolledBackMsg struct{ rollback *secrets.Rollback }
 type rotationErrMsg struct{ err error }
 
 func (e *rotationErrMsg) Error() string {
@@ -582,7 +909,17 @@ func (e *rotationErrMsg) Error() string {
 type rotationStartedMsg struct{}
 
 func main() {
-	p := tea.NewProgram(initialModel())
+	if len(os.Args) > 1 {
+		if err := runCLI(os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	m := initialModel()
+	defer m.cancel()
+
+	p := tea.NewProgram(m)
 	if _, err := p.Run(); err != nil {
 		log.Fatalf("Error running program: %v", err)
 	}